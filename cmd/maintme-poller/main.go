@@ -23,10 +23,25 @@ func main() {
 	}
 
 	// Notifiers
-	notifier := &notifier.Writer{Writer: os.Stdout}
+	dispatcher := &notifier.Dispatcher{
+		DB:      m.DB,
+		SMTP:    m.SMTP,
+		BaseURL: m.BaseURL,
+		Default: &notifier.Writer{Writer: os.Stdout, BaseURL: m.BaseURL},
+	}
+
+	// Re-encrypt GitHub tokens after the token key is rotated.
+	go func() {
+		n, err := m.DB.GitHubTokensReencrypt(ctx)
+		if err != nil {
+			m.Logger.WithError(err).Error("Could not re-encrypt GitHub tokens")
+			return
+		}
+		m.Logger.Infof("Re-encrypted %v GitHub tokens", n)
+	}()
 
 	// Poller
-	poller := events.NewPoller(m.Logger, m.DB, notifier, m.Cache)
+	poller := events.NewPoller(m.Logger, m.DB, dispatcher, m.Hosts, m.Cache, m.App)
 	err = poller.Poll(ctx, 60*time.Second) // blocking
 	if err != nil {
 		m.Logger.WithError(err).Fatalf("Poller failed")
@@ -4,11 +4,17 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
+	"github.com/alexedwards/scs/engine/memstore"
 	"github.com/alexedwards/scs/engine/mysqlstore"
+	"github.com/alexedwards/scs/engine/pgstore"
 	"github.com/alexedwards/scs/session"
 	maintainer "github.com/bradleyfalzon/maintainer.me"
+	"github.com/bradleyfalzon/maintainer.me/db"
+	"github.com/bradleyfalzon/maintainer.me/events"
+	"github.com/bradleyfalzon/maintainer.me/notifier"
 	"github.com/bradleyfalzon/maintainer.me/web"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -26,8 +32,21 @@ func main() {
 	}
 
 	// Session Manager
-	sessionEngine := mysqlstore.New(m.DBConn, 5*time.Minute)
-	defer sessionEngine.StopCleanup()
+	var sessionEngine session.Engine
+	switch os.Getenv("DB_DRIVER") {
+	case db.DriverPostgres:
+		engine := pgstore.New(m.DBConn, 5*time.Minute)
+		defer engine.StopCleanup()
+		sessionEngine = engine
+	case db.DriverSQLite:
+		// SQLite is for single node installs, sessions do not persist
+		// across restarts.
+		sessionEngine = memstore.New(5 * time.Minute)
+	default:
+		engine := mysqlstore.New(m.DBConn, 5*time.Minute)
+		defer engine.StopCleanup()
+		sessionEngine = engine
+	}
 
 	sessionManager := session.Manage(
 		sessionEngine,
@@ -42,38 +61,121 @@ func main() {
 	)
 
 	// Web
-	public, err := web.NewPublic(m.Logger)
+	public, err := web.NewPublic(m.Logger, m.Hosts)
 	if err != nil {
 		m.Logger.WithError(err).Fatal("Could not instantiate web.Public")
 	}
 
-	console, err := web.NewConsole(m.Logger, m.DB, m.Cache, m.GHOAuthConfig)
+	dispatcher := &notifier.Dispatcher{
+		DB:      m.DB,
+		SMTP:    m.SMTP,
+		BaseURL: m.BaseURL,
+		Default: &notifier.Writer{Writer: os.Stdout, BaseURL: m.BaseURL},
+	}
+
+	console, err := web.NewConsole(m.Logger, m.DB, m.Cache, m.Hosts, dispatcher)
 	if err != nil {
 		m.Logger.WithError(err).Fatal("Could not instantiate web.Console")
 	}
 
+	api := web.NewAPI(m.Logger, m.DB, m.Cache, m.Hosts, dispatcher)
+
+	feeds := web.NewFeeds(m.Logger, m.DB, m.Hosts, m.BaseURL)
+
+	// Webhook events are processed the same way as polled events.
+	poller := events.NewPoller(m.Logger, m.DB, dispatcher, m.Hosts, m.Cache, m.App)
+	webhooks := web.NewWebhooks(m.Logger, m.DB, poller, m.AppWebhookSecret)
+
 	router := chi.NewRouter()
 	router.Use(sessionManager)
 
 	router.Use(middleware.DefaultCompress)
 	router.Use(middleware.Recoverer)
-	router.Use(middleware.NoCache)
-
-	router.Get("/", public.Home)
-	router.Get("/login", console.Login)
-	router.Get("/login/callback", console.LoginCallback)
-	//router.Get("/logout", console.Logout)
-	router.Route("/console", func(router chi.Router) {
-		router.Use(console.RequireLogin)
-		router.Get("/", console.Home)
-		router.Get("/repos", console.Repos)
-		router.Get("/filters", console.Filters)
-		router.Post("/filters", console.FiltersUpdate)
-		router.Get("/filters/{filterID}", console.Filter)
-		router.Post("/filters/{filterID}", console.FilterUpdate)
-		router.Delete("/conditions/{conditionID}", console.ConditionDelete)
-		router.Post("/conditions/", console.ConditionCreate)
-		router.Get("/events", console.Events)
+
+	// Feeds support conditional GET requests so must not use NoCache.
+	router.Get("/feeds/{token}/{format}", feeds.Feed)
+	router.Post("/webhooks/github/app", webhooks.App)
+	router.Post("/webhooks/github/{userID}", webhooks.GitHub)
+
+	router.Group(func(router chi.Router) {
+		router.Use(middleware.NoCache)
+
+		router.Get("/", public.Home)
+		router.Get("/login", console.Login)
+		router.Get("/login/callback", console.LoginCallback)
+		router.With(console.CSRF).Post("/logout", console.Logout)
+		router.Route("/console", func(router chi.Router) {
+			router.Use(console.CSRF)
+			router.Use(console.RequireLogin)
+			router.Get("/", console.Home)
+			router.Get("/repos", console.Repos)
+			router.Get("/settings", console.Settings)
+			router.Post("/settings", console.SettingsUpdate)
+			router.Post("/settings/feed", console.FeedTokenUpdate)
+			router.Post("/settings/webhook", console.WebhookSecretUpdate)
+			router.Post("/settings/pause", console.NotificationsPausedUpdate)
+			router.Post("/settings/delete", console.AccountDelete)
+			router.Get("/tokens", console.APITokens)
+			router.Post("/tokens", console.APITokenCreate)
+			router.Delete("/tokens/{tokenID}", console.APITokenDelete)
+			router.Get("/filters", console.Filters)
+			router.Post("/filters", console.FiltersUpdate)
+			router.Get("/filters/{filterID}", console.Filter)
+			router.Post("/filters/{filterID}", console.FilterUpdate)
+			router.Delete("/conditions/{conditionID}", console.ConditionDelete)
+			router.Post("/conditions/", console.ConditionCreate)
+			router.Get("/events", console.Events)
+			router.Get("/events/stream", console.EventStream)
+			router.Post("/events/read", console.EventsMarkRead)
+			router.Post("/events/{eventID}/{action}", console.EventUpdate)
+			router.Get("/channels", console.Channels)
+			router.Post("/channels", console.ChannelCreate)
+			router.Get("/channels/verify", console.ChannelVerifyConfirm)
+			router.Post("/channels/verify", console.ChannelVerify)
+			router.Delete("/channels/{channelID}", console.ChannelDelete)
+			router.Get("/mutes", console.Mutes)
+			router.Get("/mutes/new", console.MuteNew)
+			router.Post("/mutes", console.MuteCreate)
+			router.Delete("/mutes/{muteID}", console.MuteDelete)
+			router.Get("/teams", console.Teams)
+			router.Post("/teams", console.TeamCreate)
+			router.Get("/teams/{teamID}", console.Team)
+			router.Delete("/teams/{teamID}", console.TeamDelete)
+			router.Post("/teams/{teamID}/members", console.TeamMemberCreate)
+			router.Delete("/teams/{teamID}/members/{userID}", console.TeamMemberDelete)
+			router.Post("/teams/{teamID}/filters", console.TeamFilterCreate)
+			router.Delete("/teams/{teamID}/filters/{filterID}", console.TeamFilterDelete)
+			router.Get("/subscriptions", console.Subscriptions)
+			router.Post("/subscriptions", console.SubscriptionCreate)
+			router.Delete("/subscriptions/{subscriptionID}", console.SubscriptionDelete)
+		})
+		router.Route("/admin", func(router chi.Router) {
+			router.Use(console.CSRF)
+			router.Use(console.RequireAdmin)
+			router.Get("/", console.Admin)
+			router.Post("/users/{userID}/pause", console.AdminUserPause)
+			router.Post("/users/{userID}/poll", console.AdminUserPoll)
+			router.Post("/users/{userID}/impersonate", console.AdminUserImpersonate)
+			router.Post("/impersonate/stop", console.AdminImpersonateStop)
+		})
+		router.Route("/api/v1", func(router chi.Router) {
+			router.Use(web.SameOrigin)
+			router.Use(console.RequireLoginOrToken)
+			router.Get("/settings", api.Settings)
+			router.Put("/settings", api.SettingsUpdate)
+			router.Get("/filters", api.Filters)
+			router.Post("/filters", api.FilterCreate)
+			router.Get("/filters/{filterID}", api.Filter)
+			router.Put("/filters/{filterID}", api.FilterUpdate)
+			router.Delete("/filters/{filterID}", api.FilterDelete)
+			router.Post("/filters/{filterID}/conditions", api.ConditionCreate)
+			router.Delete("/conditions/{conditionID}", api.ConditionDelete)
+			router.Get("/events", api.Events)
+			router.Post("/events/{eventID}/{action}", api.EventUpdate)
+			router.Get("/channels", api.Channels)
+			router.Post("/channels", api.ChannelCreate)
+			router.Delete("/channels/{channelID}", api.ChannelDelete)
+		})
 	})
 
 	// HTTP Server
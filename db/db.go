@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -22,23 +24,215 @@ type DB interface {
 	User(ctx context.Context, userID int) (*User, error)
 	// UserUpdate updates a user in the database.
 	UserUpdate(context.Context, *User) error
+	// UserByGitHubLogin returns the user with the GitHub login on the GitHub
+	// host, or nil if no user exists.
+	UserByGitHubLogin(ctx context.Context, githubHost, login string) (*User, error)
+	// UserByGitHubID returns the user with the GitHub user ID on the GitHub
+	// host, returns nil if no user was found.
+	UserByGitHubID(ctx context.Context, githubHost string, githubID int) (*User, error)
+	// UserByFeedToken returns the user with the feed token, returns nil if no
+	// user was found.
+	UserByFeedToken(ctx context.Context, feedToken string) (*User, error)
+	// UserFeedTokenUpdate sets a user's feed token, a blank token disables
+	// the user's feed.
+	UserFeedTokenUpdate(ctx context.Context, userID int, feedToken string) error
+	// UserWebhookSecretUpdate sets a user's webhook secret, a blank secret
+	// disables the user's webhooks.
+	UserWebhookSecretUpdate(ctx context.Context, userID int, secret string) error
+	// UserNotificationsPausedUpdate pauses or resumes a user's notifications.
+	// Resuming polls the user's events and notifications from now, rather
+	// than since notifications were paused.
+	UserNotificationsPausedUpdate(ctx context.Context, userID int, paused bool) error
+	// UserDelete deletes a user and all their data, including teams the user
+	// is the only owner of.
+	UserDelete(ctx context.Context, userID int) error
 	// UsersFilters returns all filters for a User ID.
 	UsersFilters(ctx context.Context, userID int) ([]Filter, error)
 	// Filter returns a single filter from the database, returns nil if no filter found.
 	Filter(ctx context.Context, filterID int) (*Filter, error)
+	// FilterCreate inserts a filter, without its conditions, into the database.
+	FilterCreate(context.Context, *Filter) (filterID int, err error)
 	// FilterUpdate updates a filter in the database.
 	FilterUpdate(context.Context, *Filter) error
+	// FilterDelete deletes a filter and its conditions from the database, of
+	// either userID's own filter or a filter of a team userID owns.
+	FilterDelete(ctx context.Context, userID, filterID int) error
 	// Condition returns a single condition from the database, returns nil if no condition found.
 	Condition(ctx context.Context, conditionID int) (*Condition, error)
-	// ConditionDelete deletes a userID's condition from the database.
+	// ConditionDelete deletes a condition from the database, of either
+	// userID's own filter or a filter of a team userID owns.
 	ConditionDelete(ctsx context.Context, userID, conditionID int) error
 	// ConditionCreate inserts a condition into the database.
 	ConditionCreate(context.Context, *Condition) (conditionID int, err error)
+	// UsersMutes returns all of a user's mutes that have not expired.
+	UsersMutes(ctx context.Context, userID int) ([]Mute, error)
+	// MuteCreate inserts a mute into the database.
+	MuteCreate(context.Context, *Mute) (muteID int, err error)
+	// MuteDelete deletes a userID's mute from the database.
+	MuteDelete(ctx context.Context, userID, muteID int) error
+	// UsersTeamFilters returns the filters of all teams a user is a member
+	// of.
+	UsersTeamFilters(ctx context.Context, userID int) ([]Filter, error)
+	// TeamsFilters returns all of a team's filters.
+	TeamsFilters(ctx context.Context, teamID int) ([]Filter, error)
+	// Team returns a team, or nil if no team exists.
+	Team(ctx context.Context, teamID int) (*Team, error)
+	// TeamCreate inserts a team into the database, with ownerUserID as its
+	// owner.
+	TeamCreate(ctx context.Context, team *Team, ownerUserID int) (teamID int, err error)
+	// TeamDelete deletes a team, its memberships and filters.
+	TeamDelete(ctx context.Context, teamID int) error
+	// UsersTeams returns the memberships of all teams a user is a member of.
+	UsersTeams(ctx context.Context, userID int) ([]TeamMembership, error)
+	// TeamsMemberships returns all memberships of a team.
+	TeamsMemberships(ctx context.Context, teamID int) ([]TeamMembership, error)
+	// TeamMembership returns a user's membership of a team, or nil if the
+	// user is not a member.
+	TeamMembership(ctx context.Context, teamID, userID int) (*TeamMembership, error)
+	// TeamMembershipCreate adds a user to a team, or updates their role if
+	// they're already a member.
+	TeamMembershipCreate(context.Context, *TeamMembership) error
+	// TeamMembershipDelete removes a user from a team.
+	TeamMembershipDelete(ctx context.Context, teamID, userID int) error
+	// UsersSubscriptions returns all of a user's subscriptions.
+	UsersSubscriptions(ctx context.Context, userID int) ([]Subscription, error)
+	// SubscriptionCreate inserts a subscription into the database.
+	SubscriptionCreate(context.Context, *Subscription) (subscriptionID int, err error)
+	// SubscriptionDelete deletes a userID's subscription from the database.
+	SubscriptionDelete(ctx context.Context, userID, subscriptionID int) error
+	// SubscriptionFeedsDue returns the repository and organisation feeds with
+	// at least one subscription that are due to be polled.
+	SubscriptionFeedsDue(context.Context) ([]SubscriptionFeed, error)
+	// SubscriptionFeedsSubscriptions returns all subscriptions to a feed.
+	SubscriptionFeedsSubscriptions(ctx context.Context, feedID int) ([]Subscription, error)
+	// SetSubscriptionFeedPollResult sets the time of the latest event and
+	// the next poll for a feed.
+	SetSubscriptionFeedPollResult(ctx context.Context, feedID int, lastCreatedAt, nextPoll time.Time) error
+	// HeldNotificationCreate holds a notification until its DeliverAt time.
+	HeldNotificationCreate(context.Context, *HeldNotification) error
+	// HeldNotificationsDue returns a user's held notifications that are due to
+	// be delivered at now, in the order they were held.
+	HeldNotificationsDue(ctx context.Context, userID int, now time.Time) ([]HeldNotification, error)
+	// HeldNotificationsDelete deletes a user's held notifications after they
+	// have been delivered.
+	HeldNotificationsDelete(ctx context.Context, userID int, heldIDs []int) error
+	// UsersNotificationChannels returns all of a user's notification channels.
+	UsersNotificationChannels(ctx context.Context, userID int) ([]NotificationChannel, error)
+	// NotificationChannelCreate inserts a notification channel into the database.
+	NotificationChannelCreate(context.Context, *NotificationChannel) (channelID int, err error)
+	// NotificationChannelDelete deletes a userID's notification channel from the database.
+	NotificationChannelDelete(ctx context.Context, userID, channelID int) error
+	// NotificationChannelVerify marks a userID's notification channel with
+	// the verification token as verified, returns false if no unverified
+	// channel has the token.
+	NotificationChannelVerify(ctx context.Context, userID int, token string) (bool, error)
+	// EventsCreate stores a user's filtered events, ignoring events with a
+	// DedupKey already stored for the user. The returned slice reports
+	// whether each event was inserted.
+	EventsCreate(ctx context.Context, events []Event) (inserted []bool, err error)
+	// UsersEvents returns a page of a user's stored events matching query,
+	// most recent first.
+	UsersEvents(ctx context.Context, userID int, query EventQuery) ([]Event, error)
+	// UsersEventFacets returns counts of a user's stored events matching
+	// query, grouped by repository, type, actor and status.
+	UsersEventFacets(ctx context.Context, userID int, query EventQuery) (*EventFacets, error)
+	// UsersEventsByID returns a user's events with the IDs.
+	UsersEventsByID(ctx context.Context, userID int, eventIDs []int) ([]Event, error)
+	// UsersEventsAfter returns a user's accepted events with an ID greater
+	// than eventID, oldest first. As the poller and web server may be
+	// separate processes, this is used to subscribe to newly stored events.
+	UsersEventsAfter(ctx context.Context, userID, eventID int) ([]Event, error)
+	// UsersLatestEventID returns the ID of a user's most recently stored
+	// event, or 0 if the user has no events.
+	UsersLatestEventID(ctx context.Context, userID int) (int, error)
+	// UsersUnreadCount returns the number of unread events in a user's inbox.
+	UsersUnreadCount(ctx context.Context, userID int) (int, error)
+	// EventsMarkRead marks a user's events as read, or unread if read is false.
+	EventsMarkRead(ctx context.Context, userID int, eventIDs []int, read bool) error
+	// EventsMarkRepositoryRead marks all of a user's events in a repository as read.
+	EventsMarkRepositoryRead(ctx context.Context, userID int, repository string) error
+	// EventArchive archives and marks read a user's event, or unarchives if
+	// archived is false.
+	EventArchive(ctx context.Context, userID, eventID int, archived bool) error
+	// EventStar stars a user's event, or unstars if starred is false.
+	EventStar(ctx context.Context, userID, eventID int, starred bool) error
+	// UsersAPITokens returns all of a user's API tokens.
+	UsersAPITokens(ctx context.Context, userID int) ([]APIToken, error)
+	// APITokenByHash returns the API token with the hash, returns nil if no
+	// token was found.
+	APITokenByHash(ctx context.Context, tokenHash string) (*APIToken, error)
+	// APITokenCreate inserts an API token into the database.
+	APITokenCreate(context.Context, *APIToken) (tokenID int, err error)
+	// APITokenUsed records the time an API token was last used.
+	APITokenUsed(ctx context.Context, tokenID int, usedAt time.Time) error
+	// APITokenDelete deletes a userID's API token from the database.
+	APITokenDelete(ctx context.Context, userID, tokenID int) error
+	// Installation returns a GitHub App installation, returns nil if no
+	// installation was found.
+	Installation(ctx context.Context, installationID int) (*Installation, error)
+	// InstallationCreate inserts or updates a GitHub App installation.
+	InstallationCreate(context.Context, *Installation) error
+	// InstallationDelete deletes a GitHub App installation and its
+	// repositories.
+	InstallationDelete(ctx context.Context, installationID int) error
+	// InstallationRepositoriesCreate adds repositories to a GitHub App
+	// installation, ignoring repositories already added.
+	InstallationRepositoriesCreate(ctx context.Context, repos []InstallationRepository) error
+	// InstallationRepositoriesDelete removes repositories from a GitHub App
+	// installation.
+	InstallationRepositoriesDelete(ctx context.Context, installationID int, repositoryIDs []int) error
+	// InstallationRepositoriesDue returns the installation repositories
+	// scheduled to be polled.
+	InstallationRepositoriesDue(context.Context) ([]InstallationRepository, error)
+	// SetInstallationRepositoryPollResult sets the time of the latest event
+	// seen and the next poll of an installation's repository.
+	SetInstallationRepositoryPollResult(ctx context.Context, installationID, repositoryID int, lastCreatedAt, nextPoll time.Time) error
+	// SetUsersPollStatus records the time a user was polled, the poll's
+	// error, if any, and whether their GitHub token is valid.
+	SetUsersPollStatus(ctx context.Context, userID int, polledAt time.Time, pollError string, tokenValid bool) error
+	// UserPollPausedUpdate pauses or resumes polling a user.
+	UserPollPausedUpdate(ctx context.Context, userID int, paused bool) error
+	// UserPollNow schedules a user to be polled in the next poll.
+	UserPollNow(ctx context.Context, userID int) error
+	// AdminUsers returns all users, with the number of notification delivery
+	// failures since failuresSince.
+	AdminUsers(ctx context.Context, failuresSince time.Time) ([]AdminUser, error)
+	// DeliveryFailureCreate records a notification delivery failure.
+	DeliveryFailureCreate(context.Context, *DeliveryFailure) error
+	// SetUsersNotificationsSince sets the time of the latest notification
+	// seen for a user.
+	SetUsersNotificationsSince(ctx context.Context, userID int, since time.Time) error
 	// SetUsersNextUpdate
 	SetUsersPollResult(ctx context.Context, userID int, lastCreatedAt time.Time, nextUpdate time.Time) error
-	// GitHubLogin logs a user in via GitHub, if a user already exists with the same
-	// githubID, the user's accessToken is updated, else a new user is created.
-	GitHubLogin(ctx context.Context, email string, githubID int, githubLogin string, token *oauth2.Token) (userID int, err error)
+	// GitHubTokensReencrypt encrypts users' GitHub tokens that are not
+	// encrypted with the primary token key, such as after the key is rotated,
+	// and returns the number of tokens re-encrypted.
+	GitHubTokensReencrypt(ctx context.Context) (int, error)
+	// GitHubLogin logs a user in via a GitHub host, if a user already exists
+	// with the same githubHost and githubID, the user's accessToken is
+	// updated, else a new user is created.
+	GitHubLogin(ctx context.Context, githubHost, email string, githubID int, githubLogin string, token *oauth2.Token) (userID int, err error)
+}
+
+// Installation is an installation of the GitHub App on a user or
+// organisation account. Events for the installation's repositories are sent
+// to the user who installed the app.
+type Installation struct {
+	ID             int       `db:"id"` // ID is GitHub's installation ID.
+	AccountID      int       `db:"account_id"`
+	AccountLogin   string    `db:"account_login"`
+	SenderGitHubID int       `db:"sender_github_id"` // SenderGitHubID is the GitHub user ID who installed the app.
+	CreatedAt      time.Time `db:"created_at"`
+}
+
+// InstallationRepository is a repository the GitHub App has been granted
+// access to by an installation.
+type InstallationRepository struct {
+	InstallationID     int       `db:"installation_id"`
+	RepositoryID       int       `db:"repository_id"`
+	FullName           string    `db:"full_name"`             // FullName such as "golang/go".
+	EventLastCreatedAt time.Time `db:"event_last_created_at"` // the latest created at event polled
+	EventNextPoll      time.Time `db:"event_next_poll"`       // time when the next poll should occur
 }
 
 type Dates struct {
@@ -52,29 +246,150 @@ type User struct {
 	ID int `db:"id"`
 
 	Email          string `db:"email"`
+	GitHubHost     string `db:"github_host"` // GitHubHost is the name of the GitHub host the user logs in with.
 	GitHubID       int    `db:"github_id"`
 	GitHubLogin    string `db:"github_login"`
 	GitHubTokenRaw []byte `db:"github_token"`
 	GitHubToken    *oauth2.Token
+	// GitHubTokenValid is false if GitHub rejected the token when the user
+	// was last polled, such as when the user revoked the OAuth grant.
+	GitHubTokenValid bool `db:"github_token_valid"`
+
+	// Admin users may access the admin console.
+	Admin bool `db:"admin"`
 
 	FilterDefaultDiscard bool `db:"filter_default_discard"`
 
-	EventLastCreatedAt time.Time // the latest created at event for the customer
-	EventNextPoll      time.Time // time when the next update should occur
+	// Timezone is the user's IANA timezone name, such as "Australia/Adelaide".
+	Timezone string `db:"timezone"`
+	// QuietHoursStart and QuietHoursEnd are the hours of the day, in the
+	// user's timezone, between which notifications are held. If equal, there
+	// are no quiet hours.
+	QuietHoursStart int `db:"quiet_hours_start"`
+	QuietHoursEnd   int `db:"quiet_hours_end"`
+
+	// FeedToken is the secret in the URL of the user's feeds, or blank if
+	// the feeds are disabled.
+	FeedToken string `db:"feed_token"`
+	// WebhookSecret is the secret used to sign GitHub webhooks sent to the
+	// user, or blank if webhooks are disabled.
+	WebhookSecret string `db:"webhook_secret"`
+
+	// NotificationsEnabled polls the user's GitHub notifications as well as
+	// their events, and NotificationsMarkRead marks the notification threads
+	// read on GitHub when their events are read.
+	NotificationsEnabled  bool      `db:"notifications_enabled"`
+	NotificationsMarkRead bool      `db:"notifications_mark_read"`
+	NotificationsSince    time.Time `db:"notifications_since"` // the latest updated at notification
+
+	EventLastCreatedAt time.Time `db:"event_last_created_at"` // the latest created at event for the customer
+	EventNextPoll      time.Time `db:"event_next_poll"`       // time when the next update should occur
+
+	// NotificationsPaused users are not polled or notified, set by the user.
+	NotificationsPaused bool `db:"notifications_paused"`
+
+	// PollPaused users are not polled, set by an admin.
+	PollPaused bool       `db:"poll_paused"`
+	PolledAt   *time.Time `db:"polled_at"`  // PolledAt is the time the user was last polled, nil if never.
+	PollError  string     `db:"poll_error"` // PollError is the error from the last poll, blank if successful.
+}
+
+// userColumns are the columns selected from the users table into User.
+const userColumns = `id, email, github_host, github_id, github_login, github_token, github_token_valid, admin,
+	filter_default_discard, timezone, quiet_hours_start, quiet_hours_end, feed_token, webhook_secret,
+	notifications_enabled, notifications_mark_read, notifications_since, notifications_paused,
+	event_last_created_at, event_next_poll, poll_paused, polled_at, poll_error`
+
+// AdminUser is a user with the status of their polling and notification
+// delivery, as shown to admins.
+type AdminUser struct {
+	User
+	DeliveryFailures          int        `db:"delivery_failures"`            // the number of recent delivery failures
+	LastDeliveryFailureAt     *time.Time `db:"last_delivery_failure_at"`     // nil if no recent failures
+	LastDeliveryFailureReason string     `db:"last_delivery_failure_reason"` // blank if no recent failures
+}
+
+// DeliveryFailure is an error sending a notification to a user's channel.
+type DeliveryFailure struct {
+	ID        int       `db:"id"`
+	UserID    int       `db:"user_id"`
+	Channel   string    `db:"channel"`
+	Error     string    `db:"error"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// Location returns the user's timezone, or UTC if the timezone is invalid.
+func (u *User) Location() *time.Location {
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// QuietUntil returns the time the user's quiet hours finish if t is within
+// their quiet hours, else it returns the zero time.
+func (u *User) QuietUntil(t time.Time) time.Time {
+	start, end := u.QuietHoursStart, u.QuietHoursEnd
+	if start == end {
+		return time.Time{}
+	}
+
+	t = t.In(u.Location())
+	hour := t.Hour()
+	if start < end && (hour < start || hour >= end) {
+		return time.Time{}
+	}
+	if start > end && hour < start && hour >= end {
+		return time.Time{}
+	}
+
+	until := time.Date(t.Year(), t.Month(), t.Day(), end, 0, 0, 0, t.Location())
+	if !until.After(t) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until
 }
 
 // Filter represents a single filter from the filters table.
 type Filter struct {
 	Dates
 	ID     int `db:"id"`
-	UserID int `db:"user_id"`
+	UserID int `db:"user_id"` // UserID is the user who owns the filter, 0 for a team's filter.
+	TeamID int `db:"team_id"` // TeamID is the team that owns the filter, 0 for a user's filter.
 	// If discard is true, the filter matching causes an event to be discarded
 	// instead of accepted.
 	OnMatchDiscard bool `db:"on_match_discard"`
+	// Urgent events are notified immediately, even during quiet hours.
+	Urgent bool `db:"urgent"`
+	// Priority is set on events matching the filter, higher is more important.
+	Priority int `db:"priority"`
+	// Tag is a user defined label attached to events matching the filter.
+	Tag string `db:"tag"`
+	// ChannelsRaw is the comma separated form of Channels stored in the DB.
+	ChannelsRaw string `db:"channels"`
+	// Channels are the notifier channels events matching the filter are sent
+	// to, if empty, the event is sent to the default channel.
+	Channels []string `db:"-"`
 
 	Conditions []Condition
 }
 
+// SetChannels sets the filter's Channels, ignoring blank and duplicate names.
+func (f *Filter) SetChannels(channels []string) {
+	f.Channels = nil
+	seen := make(map[string]bool)
+	for _, channel := range channels {
+		channel = strings.TrimSpace(channel)
+		if channel == "" || seen[channel] {
+			continue
+		}
+		seen[channel] = true
+		f.Channels = append(f.Channels, channel)
+	}
+	f.ChannelsRaw = strings.Join(f.Channels, ",")
+}
+
 // ghfilter returns a ghfilter.Filter.
 func (f *Filter) ghfilter() ghfilter.Filter {
 	var ghf ghfilter.Filter
@@ -132,36 +447,383 @@ func (c Condition) String() string {
 	return c.GHCondition().String()
 }
 
+// Mute silences events from a repository, or a single issue or pull request
+// within a repository, until it expires.
+type Mute struct {
+	Dates
+	ID           int    `db:"id"`
+	UserID       int    `db:"user_id"`
+	RepositoryID int    `db:"repository_id"`
+	Repository   string `db:"repository"` // Repository is the full name, such as "golang/go".
+	// Number is the issue or pull request number, if 0 the entire repository
+	// is muted.
+	Number int `db:"number"`
+	// ExpiresAt is the time the mute stops applying, nil never expires.
+	ExpiresAt *time.Time `db:"expires_at"`
+}
+
+// Matches returns true if the mute applies to an event in repositoryID for
+// issue or pull request number at time now.
+func (m Mute) Matches(repositoryID, number int, now time.Time) bool {
+	if m.ExpiresAt != nil && !now.Before(*m.ExpiresAt) {
+		return false
+	}
+	return m.RepositoryID == repositoryID && (m.Number == 0 || m.Number == number)
+}
+
+// Team member roles, owners manage the team's members and filters.
+const (
+	TeamRoleOwner  = "owner"
+	TeamRoleMember = "member"
+)
+
+// Team is a group of users sharing filters, each member's own filters are
+// checked before the team's filters.
+type Team struct {
+	Dates
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+// TeamMembership is a user's membership of a team.
+type TeamMembership struct {
+	Dates
+	TeamID int    `db:"team_id"`
+	UserID int    `db:"user_id"`
+	Role   string `db:"role"` // Role is TeamRoleOwner or TeamRoleMember.
+
+	TeamName    string `db:"team_name"`    // TeamName is the team's name, not stored.
+	GitHubLogin string `db:"github_login"` // GitHubLogin is the user's GitHub login, not stored.
+}
+
+// Owner returns true if the membership has the owner role.
+func (m TeamMembership) Owner() bool {
+	return m.Role == TeamRoleOwner
+}
+
+// Subscription kinds.
+const (
+	SubscriptionRepository   = "repository"
+	SubscriptionOrganization = "organization"
+)
+
+// Subscription watches the events of a repository or organisation, in
+// addition to the events received by the user.
+type Subscription struct {
+	Dates
+	ID     int    `db:"id"`
+	UserID int    `db:"user_id"`
+	FeedID int    `db:"feed_id"` // FeedID is the SubscriptionFeed shared by all subscribers.
+	Kind   string `db:"kind"`    // Kind is SubscriptionRepository or SubscriptionOrganization.
+	Name   string `db:"name"`    // Name is the repository's full name, such as "golang/go", or the organisation's login.
+	// EventLastCreatedAt is the created at time of the latest event seen in
+	// the feed, nil if the feed has not been polled.
+	EventLastCreatedAt *time.Time `db:"event_last_created_at"`
+}
+
+// SubscriptionFeed is a repository or organisation's events on a GitHub host,
+// polled once for all of its subscribers.
+type SubscriptionFeed struct {
+	Dates
+	ID                 int        `db:"id"`
+	GitHubHost         string     `db:"github_host"`
+	Kind               string     `db:"kind"`
+	Name               string     `db:"name"`
+	EventLastCreatedAt *time.Time `db:"event_last_created_at"` // the latest created at event polled, if any
+	EventNextPoll      time.Time  `db:"event_next_poll"`       // time when the next poll should occur
+}
+
+// HeldNotification is a notification held during a user's quiet hours.
+type HeldNotification struct {
+	ID          int       `db:"id"`
+	UserID      int       `db:"user_id"`
+	Event       []byte    `db:"event"` // Event is the JSON encoded event, as rendered when it was held.
+	Priority    int       `db:"priority"`
+	Tag         string    `db:"tag"`
+	ChannelsRaw string    `db:"channels"`
+	DeliverAt   time.Time `db:"deliver_at"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// Notification channel types.
+const (
+	ChannelTypeEmail   = "email"   // Target is an email address.
+	ChannelTypeWebhook = "webhook" // Target is a URL receiving a JSON POST.
+	ChannelTypeSlack   = "slack"   // Target is a Slack compatible incoming webhook URL.
+)
+
+// NotificationChannel is a destination a user can route notifications to by
+// name, such as from a filter's Channels.
+type NotificationChannel struct {
+	Dates
+	ID     int    `db:"id"`
+	UserID int    `db:"user_id"`
+	Name   string `db:"name"`
+	Type   string `db:"type"`
+	Target string `db:"target"`
+	// VerifyToken must be confirmed by the user before the channel is used.
+	VerifyToken string     `db:"verify_token"`
+	VerifiedAt  *time.Time `db:"verified_at"` // VerifiedAt is nil until the channel is verified.
+}
+
+// Verified returns true if the channel has been verified.
+func (c NotificationChannel) Verified() bool {
+	return c.VerifiedAt != nil
+}
+
+// Event is a filtered GitHub event stored for a user.
+type Event struct {
+	ID           int       `db:"id"`
+	UserID       int       `db:"user_id"`
+	GitHubID     string    `db:"github_id"`  // GitHubID is GitHub's ID for the event, if known.
+	DedupKey     string    `db:"dedup_key"`  // DedupKey identifies the event's activity, unique per user.
+	CreatedAt    time.Time `db:"created_at"` // CreatedAt is the time the event was created on GitHub.
+	Type         string    `db:"type"`
+	Public       bool      `db:"public"`
+	Repository   string    `db:"repository"`
+	RepositoryID int       `db:"repository_id"`
+	Number       int       `db:"number"`
+	Actor        string    `db:"actor"`
+	Action       string    `db:"action"`
+	Subject      string    `db:"subject"`
+	Title        string    `db:"title"`
+	Body         string    `db:"body"`
+	Discarded    bool      `db:"discarded"`
+	Muted        bool      `db:"muted"`
+	Priority     int       `db:"priority"`
+	Tag          string    `db:"tag"`
+
+	ReadAt   *time.Time `db:"read_at"` // ReadAt is nil until an accepted event is read.
+	Archived bool       `db:"archived"`
+	Starred  bool       `db:"starred"`
+}
+
+// Unread returns true if the event is an accepted event that has not been read.
+func (e Event) Unread() bool {
+	return !e.Discarded && e.ReadAt == nil
+}
+
+// URL returns the event's issue or pull request on the GitHub host at
+// webURL, such as "https://github.com/", or the event's repository if the
+// event is not about an issue or pull request. GitHub redirects issue URLs to
+// pull requests.
+func (e Event) URL(webURL string) string {
+	if e.Number == 0 {
+		return webURL + e.Repository
+	}
+	return fmt.Sprintf("%s%s/issues/%d", webURL, e.Repository, e.Number)
+}
+
+// ThreadKey returns the key grouping events for an issue or pull request
+// number in a repository, such as "golang/go#123". If number is 0, the key
+// is blank.
+func ThreadKey(repository string, number int) string {
+	if number == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s#%d", repository, number)
+}
+
+// Thread is a group of events about the same issue or pull request, or a
+// single event that is not about an issue or pull request.
+type Thread struct {
+	Key          string // Key is the ThreadKey, or blank for events without a thread.
+	Repository   string
+	Number       int
+	Subject      string
+	Latest       time.Time // Latest is the time of the most recent event.
+	Participants []string  // Participants are the unique actors, in the order of their events.
+	Unread       bool      // Unread is true if any events are unread.
+	Events       []Event   // Events in the same order as provided to GroupThreads.
+}
+
+// GroupThreads groups events into threads, threads are ordered by the
+// position of their first event in events.
+func GroupThreads(events []Event) []*Thread {
+	var (
+		threads []*Thread
+		byKey   = make(map[string]*Thread)
+	)
+	for _, event := range events {
+		key := ThreadKey(event.Repository, event.Number)
+		thread, ok := byKey[key]
+		if !ok || key == "" {
+			thread = &Thread{
+				Key:        key,
+				Repository: event.Repository,
+				Number:     event.Number,
+				Subject:    event.Subject,
+			}
+			threads = append(threads, thread)
+			byKey[key] = thread
+		}
+
+		thread.Events = append(thread.Events, event)
+		if event.CreatedAt.After(thread.Latest) {
+			thread.Latest = event.CreatedAt
+		}
+		if event.Unread() {
+			thread.Unread = true
+		}
+		var seen bool
+		for _, p := range thread.Participants {
+			seen = seen || p == event.Actor
+		}
+		if !seen && event.Actor != "" {
+			thread.Participants = append(thread.Participants, event.Actor)
+		}
+	}
+	return threads
+}
+
+// Event folders used by EventQuery.
+const (
+	EventFolderInbox    = "inbox"    // Accepted events that have not been archived.
+	EventFolderUnread   = "unread"   // Accepted events that have not been read.
+	EventFolderStarred  = "starred"  // Starred events.
+	EventFolderArchived = "archived" // Archived events.
+)
+
+// Event statuses used by EventQuery.
+const (
+	EventStatusAccepted  = "accepted"
+	EventStatusDiscarded = "discarded"
+)
+
+// EventQuery restricts the events returned by UsersEvents and
+// UsersEventFacets, blank fields are not restricted.
+type EventQuery struct {
+	Search     string // Search is a full-text search of the title and body.
+	Repository string
+	Type       string
+	Actor      string
+	Status     string // Status is either EventStatusAccepted or EventStatusDiscarded.
+	Folder     string // Folder is one of the EventFolder constants.
+	Tag        string // Tag is the tag of the filter that accepted the event.
+
+	Page    int // Page is the page number, starting at 1.
+	PerPage int
+}
+
+// EventFacet is the number of events with a value.
+type EventFacet struct {
+	Value string `db:"value"`
+	Count int    `db:"count"`
+}
+
+// EventFacets are the counts of events grouped by field.
+type EventFacets struct {
+	Repositories []EventFacet
+	Types        []EventFacet
+	Actors       []EventFacet
+	Statuses     []EventFacet
+}
+
+// API token scopes.
+const (
+	APITokenScopeRead  = "read"  // Read only access.
+	APITokenScopeWrite = "write" // Read and write access.
+)
+
+// APIToken is a personal API token, only the token's hash is stored.
+type APIToken struct {
+	ID         int        `db:"id"`
+	UserID     int        `db:"user_id"`
+	Name       string     `db:"name"`
+	Scope      string     `db:"scope"`      // Scope is one of the APITokenScope constants.
+	TokenHash  string     `db:"token_hash"` // TokenHash is the hex encoded SHA-256 hash of the token.
+	LastUsedAt *time.Time `db:"last_used_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
 type SQLDB struct {
-	sqlx *sqlx.DB
+	sqlx      rebindDB
+	tokenKeys *TokenKeys
 }
 
 var _ DB = &SQLDB{}
 
-func NewSQLDB(driver string, dbConn *sql.DB) *SQLDB {
+// NewSQLDB returns a SQLDB using dbConn, users' GitHub tokens are encrypted
+// with tokenKeys. The driver is one of DriverMySQL, DriverPostgres or
+// DriverSQLite.
+func NewSQLDB(driver string, dbConn *sql.DB, tokenKeys *TokenKeys) *SQLDB {
 	return &SQLDB{
-		sqlx: sqlx.NewDb(dbConn, driver),
+		sqlx:      rebindDB{sqlx.NewDb(dbConn, driver)},
+		tokenKeys: tokenKeys,
 	}
 }
 
+// githubToken decrypts and unmarshals a user's GitHubTokenRaw into
+// GitHubToken.
+func (db *SQLDB) githubToken(user *User) error {
+	plaintext, err := db.tokenKeys.Decrypt(user.GitHubTokenRaw)
+	if err != nil {
+		return errors.Wrapf(err, "could not decrypt github token for userID %d", user.ID)
+	}
+	err = json.Unmarshal(plaintext, &user.GitHubToken)
+	return errors.Wrapf(err, "could not unmarshal github token for userID %d", user.ID)
+}
+
 // Users implements the DB interface.
-func (db *SQLDB) Users(_ context.Context) ([]User, error) {
-	// TODO only select users where next poll is before now.
-	return []User{
-		{
-			ID:       1,
-			Email:    "",
-			GitHubID: 1,
-			//GitHubToken: []
-			GitHubLogin:        "bradleyfalzon",
-			EventLastCreatedAt: time.Date(2017, 07, 03, 0, 0, 0, 0, time.UTC),
-		},
-	}, nil
+func (db *SQLDB) Users(ctx context.Context) ([]User, error) {
+	var users []User
+	err := db.sqlx.SelectContext(ctx, &users, "SELECT "+userColumns+" FROM users WHERE event_next_poll <= ? AND poll_paused = FALSE", time.Now())
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from users")
+	}
+
+	for i := range users {
+		if err := db.githubToken(&users[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return users, nil
 }
 
+// User implements the DB interface.
 func (db *SQLDB) User(ctx context.Context, userID int) (*User, error) {
 	user := &User{}
-	err := db.sqlx.GetContext(ctx, user, "SELECT id, email, github_id, github_login, github_token, filter_default_discard FROM users WHERE id = ?", userID)
+	err := db.sqlx.GetContext(ctx, user, "SELECT "+userColumns+" FROM users WHERE id = ?", userID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from users")
+	}
+
+	if err := db.githubToken(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// UserByGitHubID implements the DB interface.
+func (db *SQLDB) UserByGitHubID(ctx context.Context, githubHost string, githubID int) (*User, error) {
+	user := &User{}
+	err := db.sqlx.GetContext(ctx, user, "SELECT "+userColumns+" FROM users WHERE github_host = ? AND github_id = ?", githubHost, githubID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from users")
+	}
+
+	if err := db.githubToken(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// UserByGitHubLogin implements the DB interface.
+func (db *SQLDB) UserByGitHubLogin(ctx context.Context, githubHost, login string) (*User, error) {
+	user := &User{}
+	err := db.sqlx.GetContext(ctx, user, "SELECT "+userColumns+" FROM users WHERE github_host = ? AND github_login = ?", githubHost, login)
 	switch {
 	case err == sql.ErrNoRows:
 		return nil, nil
@@ -169,23 +831,126 @@ func (db *SQLDB) User(ctx context.Context, userID int) (*User, error) {
 		return nil, errors.Wrap(err, "could not select from users")
 	}
 
-	if err := json.Unmarshal(user.GitHubTokenRaw, &user.GitHubToken); err != nil {
-		return nil, errors.Wrapf(err, "could not unmarshal github token %q", user.GitHubTokenRaw)
+	if err := db.githubToken(user); err != nil {
+		return nil, err
 	}
 
 	return user, nil
 }
 
+// UserByFeedToken implements the DB interface.
+func (db *SQLDB) UserByFeedToken(ctx context.Context, feedToken string) (*User, error) {
+	if feedToken == "" {
+		return nil, nil
+	}
+
+	user := &User{}
+	err := db.sqlx.GetContext(ctx, user, "SELECT "+userColumns+" FROM users WHERE feed_token = ?", feedToken)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from users")
+	}
+
+	if err := db.githubToken(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// UserFeedTokenUpdate implements the DB interface.
+func (db *SQLDB) UserFeedTokenUpdate(ctx context.Context, userID int, feedToken string) error {
+	_, err := db.sqlx.ExecContext(ctx, "UPDATE users SET feed_token = ? WHERE id = ?", feedToken, userID)
+	return errors.Wrapf(err, "could not update feed token for user %d", userID)
+}
+
+// UserWebhookSecretUpdate implements the DB interface.
+func (db *SQLDB) UserWebhookSecretUpdate(ctx context.Context, userID int, secret string) error {
+	_, err := db.sqlx.ExecContext(ctx, "UPDATE users SET webhook_secret = ? WHERE id = ?", secret, userID)
+	return errors.Wrapf(err, "could not update webhook secret for user %d", userID)
+}
+
+// UserNotificationsPausedUpdate implements the DB interface.
+func (db *SQLDB) UserNotificationsPausedUpdate(ctx context.Context, userID int, paused bool) error {
+	if paused {
+		_, err := db.sqlx.ExecContext(ctx, "UPDATE users SET notifications_paused = TRUE WHERE id = ?", userID)
+		return errors.Wrapf(err, "could not pause notifications for user %d", userID)
+	}
+	now := time.Now()
+	_, err := db.sqlx.ExecContext(ctx, `
+UPDATE users SET notifications_paused = FALSE, notifications_since = ?, event_last_created_at = ?, event_next_poll = ?
+ WHERE id = ? AND notifications_paused = TRUE`, now, now, now, userID)
+	return errors.Wrapf(err, "could not resume notifications for user %d", userID)
+}
+
+// UserDelete implements the DB interface.
+func (db *SQLDB) UserDelete(ctx context.Context, userID int) error {
+	tx, err := db.sqlx.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "could not begin transaction")
+	}
+	defer tx.Rollback()
+
+	// Teams without another owner would be left unmanageable, the remaining
+	// tables are deleted by their foreign keys.
+	_, err = tx.ExecContext(ctx, `
+DELETE FROM teams
+ WHERE id IN (SELECT team_id FROM team_memberships WHERE user_id = ? AND role = ?)
+   AND id NOT IN (SELECT team_id FROM team_memberships WHERE user_id != ? AND role = ?)`,
+		userID, TeamRoleOwner, userID, TeamRoleOwner)
+	if err != nil {
+		return errors.Wrapf(err, "could not delete teams of user %d", userID)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = ?", userID); err != nil {
+		return errors.Wrapf(err, "could not delete user %d", userID)
+	}
+
+	return errors.Wrapf(tx.Commit(), "could not commit deleting user %d", userID)
+}
+
 // UserUpdate implements the DB interface.
 func (db *SQLDB) UserUpdate(ctx context.Context, user *User) error {
-	_, err := db.sqlx.ExecContext(ctx, "UPDATE users SET filter_default_discard = ? WHERE id = ?", user.FilterDefaultDiscard, user.ID)
+	_, err := db.sqlx.ExecContext(ctx, `
+UPDATE users SET filter_default_discard = ?, timezone = ?, quiet_hours_start = ?, quiet_hours_end = ?,
+       notifications_enabled = ?, notifications_mark_read = ?
+ WHERE id = ?`,
+		user.FilterDefaultDiscard, user.Timezone, user.QuietHoursStart, user.QuietHoursEnd,
+		user.NotificationsEnabled, user.NotificationsMarkRead, user.ID,
+	)
 	return errors.Wrapf(err, "could update user %d", user.ID)
 }
 
+// filterColumns are the columns selected from the filters table, a filter
+// has either a user_id or a team_id.
+const filterColumns = `id, COALESCE(user_id, 0) AS user_id, COALESCE(team_id, 0) AS team_id,
+       on_match_discard, urgent, priority, tag, channels, created_at, updated_at`
+
 // UsersFilters implements the DB interface.
 func (db *SQLDB) UsersFilters(ctx context.Context, userID int) ([]Filter, error) {
+	return db.filters(ctx, `SELECT `+filterColumns+` FROM filters WHERE user_id = ?`, userID)
+}
+
+// UsersTeamFilters implements the DB interface.
+func (db *SQLDB) UsersTeamFilters(ctx context.Context, userID int) ([]Filter, error) {
+	return db.filters(ctx, `
+SELECT `+filterColumns+`
+  FROM filters
+ WHERE team_id IN (SELECT team_id FROM team_memberships WHERE user_id = ?)
+ ORDER BY team_id, id`, userID)
+}
+
+// TeamsFilters implements the DB interface.
+func (db *SQLDB) TeamsFilters(ctx context.Context, teamID int) ([]Filter, error) {
+	return db.filters(ctx, `SELECT `+filterColumns+` FROM filters WHERE team_id = ?`, teamID)
+}
+
+// filters returns the filters selected by query, with their conditions.
+func (db *SQLDB) filters(ctx context.Context, query string, args ...interface{}) ([]Filter, error) {
 	var filters []Filter
-	err := db.sqlx.SelectContext(ctx, &filters, `SELECT id, user_id, on_match_discard, created_at, updated_at FROM filters WHERE user_id = ?`, userID)
+	err := db.sqlx.SelectContext(ctx, &filters, query, args...)
 	switch {
 	case err == sql.ErrNoRows:
 		return nil, nil
@@ -195,6 +960,8 @@ func (db *SQLDB) UsersFilters(ctx context.Context, userID int) ([]Filter, error)
 
 	// I feel terrible that I've written this. Let's hope no-one else uses this service.
 	for i := range filters {
+		filters[i].SetChannels(strings.Split(filters[i].ChannelsRaw, ","))
+
 		err = db.sqlx.SelectContext(ctx, &filters[i].Conditions, `SELECT * FROM conditions WHERE filter_id = ?`, filters[i].ID)
 		switch {
 		case err == sql.ErrNoRows:
@@ -209,13 +976,14 @@ func (db *SQLDB) UsersFilters(ctx context.Context, userID int) ([]Filter, error)
 // Filter implements the DB interface.
 func (db *SQLDB) Filter(ctx context.Context, filterID int) (*Filter, error) {
 	filter := &Filter{}
-	err := db.sqlx.GetContext(ctx, filter, `SELECT id, user_id, on_match_discard, created_at, updated_at FROM filters WHERE id = ?`, filterID)
+	err := db.sqlx.GetContext(ctx, filter, `SELECT `+filterColumns+` FROM filters WHERE id = ?`, filterID)
 	switch {
 	case err == sql.ErrNoRows:
 		return nil, nil
 	case err != nil:
 		return nil, errors.Wrap(err, "could not select from filters")
 	}
+	filter.SetChannels(strings.Split(filter.ChannelsRaw, ","))
 
 	err = db.sqlx.SelectContext(ctx, &filter.Conditions, `SELECT * FROM conditions WHERE filter_id = ?`, filterID)
 	switch {
@@ -227,12 +995,32 @@ func (db *SQLDB) Filter(ctx context.Context, filterID int) (*Filter, error) {
 	return filter, nil
 }
 
+// FilterCreate implements the DB interface.
+func (db *SQLDB) FilterCreate(ctx context.Context, filter *Filter) (int, error) {
+	filterID, err := db.insertNamed(ctx, db.sqlx, `
+INSERT INTO filters (user_id, team_id, on_match_discard, urgent, priority, tag, channels)
+VALUES (NULLIF(:user_id, 0), NULLIF(:team_id, 0), :on_match_discard, :urgent, :priority, :tag, :channels)`, filter)
+	return filterID, errors.Wrap(err, "could not insert filter")
+}
+
 // FilterUpdate implements the DB interface.
 func (db *SQLDB) FilterUpdate(ctx context.Context, filter *Filter) error {
-	_, err := db.sqlx.ExecContext(ctx, "UPDATE filters SET on_match_discard = ? WHERE id = ?", filter.OnMatchDiscard, filter.ID)
+	_, err := db.sqlx.ExecContext(ctx, "UPDATE filters SET on_match_discard = ?, urgent = ?, priority = ?, tag = ?, channels = ? WHERE id = ?",
+		filter.OnMatchDiscard, filter.Urgent, filter.Priority, filter.Tag, filter.ChannelsRaw, filter.ID,
+	)
 	return errors.Wrapf(err, "could update filter %d", filter.ID)
 }
 
+// FilterDelete implements the DB interface.
+func (db *SQLDB) FilterDelete(ctx context.Context, userID, filterID int) error {
+	_, err := db.sqlx.ExecContext(ctx, `
+DELETE FROM filters
+ WHERE id = ?
+   AND (user_id = ? OR team_id IN (SELECT team_id FROM team_memberships WHERE user_id = ? AND role = 'owner'))`,
+		filterID, userID, userID)
+	return errors.Wrap(err, "could not delete filter")
+}
+
 // Condition implements the DB interface.
 func (db *SQLDB) Condition(ctx context.Context, conditionID int) (*Condition, error) {
 	condition := &Condition{}
@@ -248,13 +1036,19 @@ func (db *SQLDB) Condition(ctx context.Context, conditionID int) (*Condition, er
 
 // ConditionDelete implements the DB interface.
 func (db *SQLDB) ConditionDelete(ctx context.Context, userID, conditionID int) error {
-	_, err := db.sqlx.ExecContext(ctx, `DELETE c FROM conditions c JOIN filters f ON c.filter_id = f.id WHERE f.user_id = ? AND c.id = ?`, userID, conditionID)
+	_, err := db.sqlx.ExecContext(ctx, `
+DELETE FROM conditions
+ WHERE id = ?
+   AND filter_id IN (
+       SELECT id FROM filters
+        WHERE user_id = ? OR team_id IN (SELECT team_id FROM team_memberships WHERE user_id = ? AND role = 'owner'))`,
+		conditionID, userID, userID)
 	return errors.Wrap(err, "could not delete condition")
 }
 
 // ConditionCreate implements the DB interface.
 func (db *SQLDB) ConditionCreate(ctx context.Context, condition *Condition) (int, error) {
-	result, err := db.sqlx.NamedExecContext(ctx, `
+	conditionID, err := db.insertNamed(ctx, db.sqlx, `
 INSERT INTO conditions (
 	filter_id, negate, type, payload_action, payload_issue_label, payload_issue_milestone_title, payload_issue_title_regexp,
 	payload_issue_body_regexp, public, organization_id, repository_id
@@ -262,54 +1056,833 @@ INSERT INTO conditions (
 	:filter_id, :negate, :type, :payload_action, :payload_issue_label, :payload_issue_milestone_title, :payload_issue_title_regexp,
 	:payload_issue_body_regexp, :public, :organization_id, :repository_id
 )`, condition)
+	return conditionID, errors.Wrap(err, "could not insert condition")
+}
+
+// UsersMutes implements the DB interface.
+func (db *SQLDB) UsersMutes(ctx context.Context, userID int) ([]Mute, error) {
+	var mutes []Mute
+	err := db.sqlx.SelectContext(ctx, &mutes, `
+SELECT id, user_id, repository_id, repository, number, expires_at, created_at, updated_at
+  FROM mutes
+ WHERE user_id = ? AND (expires_at IS NULL OR expires_at > ?)`, userID, time.Now())
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from mutes")
+	}
+	return mutes, nil
+}
+
+// MuteCreate implements the DB interface.
+func (db *SQLDB) MuteCreate(ctx context.Context, mute *Mute) (int, error) {
+	muteID, err := db.insertNamed(ctx, db.sqlx, `
+INSERT INTO mutes (user_id, repository_id, repository, number, expires_at)
+VALUES (:user_id, :repository_id, :repository, :number, :expires_at)`, mute)
+	return muteID, errors.Wrap(err, "could not insert mute")
+}
+
+// MuteDelete implements the DB interface.
+func (db *SQLDB) MuteDelete(ctx context.Context, userID, muteID int) error {
+	_, err := db.sqlx.ExecContext(ctx, `DELETE FROM mutes WHERE user_id = ? AND id = ?`, userID, muteID)
+	return errors.Wrap(err, "could not delete mute")
+}
+
+// Team implements the DB interface.
+func (db *SQLDB) Team(ctx context.Context, teamID int) (*Team, error) {
+	team := &Team{}
+	err := db.sqlx.GetContext(ctx, team, `SELECT id, name, created_at, updated_at FROM teams WHERE id = ?`, teamID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from teams")
+	}
+	return team, nil
+}
+
+// TeamCreate implements the DB interface.
+func (db *SQLDB) TeamCreate(ctx context.Context, team *Team, ownerUserID int) (int, error) {
+	tx, err := db.sqlx.Beginx()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not begin transaction")
+	}
+	defer tx.Rollback()
+
+	teamID, err := db.insert(ctx, tx, `INSERT INTO teams (name) VALUES (?)`, team.Name)
 	if err != nil {
-		return 0, errors.Wrap(err, "could not insert condition")
+		return 0, errors.Wrap(err, "could not insert team")
 	}
 
-	conditionID, err := result.LastInsertId()
+	_, err = tx.ExecContext(ctx, `INSERT INTO team_memberships (team_id, user_id, role) VALUES (?, ?, ?)`, teamID, ownerUserID, TeamRoleOwner)
 	if err != nil {
-		return 0, errors.Wrap(err, "could not get condition's ID")
+		return 0, errors.Wrap(err, "could not insert team membership")
 	}
 
-	return int(conditionID), nil
+	return teamID, errors.Wrap(tx.Commit(), "could not commit team")
+}
+
+// TeamDelete implements the DB interface.
+func (db *SQLDB) TeamDelete(ctx context.Context, teamID int) error {
+	_, err := db.sqlx.ExecContext(ctx, `DELETE FROM teams WHERE id = ?`, teamID)
+	return errors.Wrap(err, "could not delete team")
+}
+
+// teamMembershipColumns selects a team membership with its team's name and
+// user's GitHub login.
+const teamMembershipColumns = `
+SELECT m.team_id, m.user_id, m.role, m.created_at, m.updated_at, t.name AS team_name, u.github_login
+  FROM team_memberships m
+  JOIN teams t ON t.id = m.team_id
+  JOIN users u ON u.id = m.user_id`
+
+// UsersTeams implements the DB interface.
+func (db *SQLDB) UsersTeams(ctx context.Context, userID int) ([]TeamMembership, error) {
+	var memberships []TeamMembership
+	err := db.sqlx.SelectContext(ctx, &memberships, teamMembershipColumns+`
+ WHERE m.user_id = ?
+ ORDER BY t.name`, userID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from team_memberships")
+	}
+	return memberships, nil
+}
+
+// TeamsMemberships implements the DB interface.
+func (db *SQLDB) TeamsMemberships(ctx context.Context, teamID int) ([]TeamMembership, error) {
+	var memberships []TeamMembership
+	err := db.sqlx.SelectContext(ctx, &memberships, teamMembershipColumns+`
+ WHERE m.team_id = ?
+ ORDER BY u.github_login`, teamID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from team_memberships")
+	}
+	return memberships, nil
+}
+
+// TeamMembership implements the DB interface.
+func (db *SQLDB) TeamMembership(ctx context.Context, teamID, userID int) (*TeamMembership, error) {
+	membership := &TeamMembership{}
+	err := db.sqlx.GetContext(ctx, membership, teamMembershipColumns+`
+ WHERE m.team_id = ? AND m.user_id = ?`, teamID, userID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from team_memberships")
+	}
+	return membership, nil
+}
+
+// TeamMembershipCreate implements the DB interface.
+func (db *SQLDB) TeamMembershipCreate(ctx context.Context, membership *TeamMembership) error {
+	_, err := db.sqlx.NamedExecContext(ctx, `
+INSERT INTO team_memberships (team_id, user_id, role)
+VALUES (:team_id, :user_id, :role)
+`+db.onConflictUpdate("team_id, user_id", "role"), membership)
+	return errors.Wrap(err, "could not insert team membership")
+}
+
+// TeamMembershipDelete implements the DB interface.
+func (db *SQLDB) TeamMembershipDelete(ctx context.Context, teamID, userID int) error {
+	_, err := db.sqlx.ExecContext(ctx, `DELETE FROM team_memberships WHERE team_id = ? AND user_id = ?`, teamID, userID)
+	return errors.Wrap(err, "could not delete team membership")
+}
+
+// UsersSubscriptions implements the DB interface.
+func (db *SQLDB) UsersSubscriptions(ctx context.Context, userID int) ([]Subscription, error) {
+	var subscriptions []Subscription
+	err := db.sqlx.SelectContext(ctx, &subscriptions, `
+SELECT s.id, s.user_id, s.feed_id, s.kind, s.name, f.event_last_created_at, s.created_at, s.updated_at
+  FROM subscriptions s
+  JOIN subscription_feeds f ON f.id = s.feed_id
+ WHERE s.user_id = ?
+ ORDER BY s.kind, s.name`, userID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from subscriptions")
+	}
+	return subscriptions, nil
+}
+
+// SubscriptionCreate implements the DB interface.
+func (db *SQLDB) SubscriptionCreate(ctx context.Context, subscription *Subscription) (int, error) {
+	// Use the existing feed for the user's host, if any.
+	_, err := db.sqlx.ExecContext(ctx, `
+INSERT INTO subscription_feeds (github_host, kind, name)
+SELECT github_host, ?, ? FROM users WHERE id = ?
+`+db.onConflictIgnore("github_host, kind, name"), subscription.Kind, subscription.Name, subscription.UserID)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not insert subscription feed")
+	}
+
+	err = db.sqlx.GetContext(ctx, &subscription.FeedID, `
+SELECT f.id
+  FROM subscription_feeds f
+  JOIN users u ON u.github_host = f.github_host
+ WHERE u.id = ? AND f.kind = ? AND f.name = ?`, subscription.UserID, subscription.Kind, subscription.Name)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get subscription feed's ID")
+	}
+
+	subscriptionID, err := db.insertNamed(ctx, db.sqlx, `
+INSERT INTO subscriptions (user_id, feed_id, kind, name)
+VALUES (:user_id, :feed_id, :kind, :name)`, subscription)
+	return subscriptionID, errors.Wrap(err, "could not insert subscription")
+}
+
+// SubscriptionDelete implements the DB interface.
+func (db *SQLDB) SubscriptionDelete(ctx context.Context, userID, subscriptionID int) error {
+	_, err := db.sqlx.ExecContext(ctx, `DELETE FROM subscriptions WHERE user_id = ? AND id = ?`, userID, subscriptionID)
+	return errors.Wrap(err, "could not delete subscription")
+}
+
+// SubscriptionFeedsDue implements the DB interface.
+func (db *SQLDB) SubscriptionFeedsDue(ctx context.Context) ([]SubscriptionFeed, error) {
+	var feeds []SubscriptionFeed
+	err := db.sqlx.SelectContext(ctx, &feeds, `
+SELECT id, github_host, kind, name, event_last_created_at, event_next_poll, created_at, updated_at
+  FROM subscription_feeds f
+ WHERE event_next_poll <= ?
+   AND EXISTS (SELECT 1 FROM subscriptions s WHERE s.feed_id = f.id)`, time.Now())
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from subscription_feeds")
+	}
+	return feeds, nil
+}
+
+// SubscriptionFeedsSubscriptions implements the DB interface.
+func (db *SQLDB) SubscriptionFeedsSubscriptions(ctx context.Context, feedID int) ([]Subscription, error) {
+	var subscriptions []Subscription
+	err := db.sqlx.SelectContext(ctx, &subscriptions, `
+SELECT s.id, s.user_id, s.feed_id, s.kind, s.name, f.event_last_created_at, s.created_at, s.updated_at
+  FROM subscriptions s
+  JOIN subscription_feeds f ON f.id = s.feed_id
+ WHERE s.feed_id = ?
+ ORDER BY s.id`, feedID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from subscriptions")
+	}
+	return subscriptions, nil
+}
+
+// SetSubscriptionFeedPollResult implements the DB interface.
+func (db *SQLDB) SetSubscriptionFeedPollResult(ctx context.Context, feedID int, lastCreatedAt, nextPoll time.Time) error {
+	_, err := db.sqlx.ExecContext(ctx, `
+UPDATE subscription_feeds SET event_last_created_at = ?, event_next_poll = ?
+ WHERE id = ?`, lastCreatedAt, nextPoll, feedID)
+	return errors.Wrapf(err, "could not set poll result for subscription feed %d", feedID)
+}
+
+// HeldNotificationCreate implements the DB interface.
+func (db *SQLDB) HeldNotificationCreate(ctx context.Context, held *HeldNotification) error {
+	_, err := db.sqlx.NamedExecContext(ctx, `
+INSERT INTO held_notifications (user_id, event, priority, tag, channels, deliver_at)
+VALUES (:user_id, :event, :priority, :tag, :channels, :deliver_at)`, held)
+	return errors.Wrap(err, "could not insert held notification")
+}
+
+// HeldNotificationsDue implements the DB interface.
+func (db *SQLDB) HeldNotificationsDue(ctx context.Context, userID int, now time.Time) ([]HeldNotification, error) {
+	var held []HeldNotification
+	err := db.sqlx.SelectContext(ctx, &held, `
+SELECT id, user_id, event, priority, tag, channels, deliver_at, created_at
+  FROM held_notifications
+ WHERE user_id = ? AND deliver_at <= ?
+ ORDER BY id`, userID, now)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from held_notifications")
+	}
+	return held, nil
+}
+
+// HeldNotificationsDelete implements the DB interface.
+func (db *SQLDB) HeldNotificationsDelete(ctx context.Context, userID int, heldIDs []int) error {
+	if len(heldIDs) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In(`DELETE FROM held_notifications WHERE user_id = ? AND id IN (?)`, userID, heldIDs)
+	if err != nil {
+		return errors.Wrap(err, "could not build held_notifications delete query")
+	}
+	_, err = db.sqlx.ExecContext(ctx, query, args...)
+	return errors.Wrap(err, "could not delete held notifications")
+}
+
+// UsersNotificationChannels implements the DB interface.
+func (db *SQLDB) UsersNotificationChannels(ctx context.Context, userID int) ([]NotificationChannel, error) {
+	var channels []NotificationChannel
+	err := db.sqlx.SelectContext(ctx, &channels, `
+SELECT id, user_id, name, type, target, verify_token, verified_at, created_at, updated_at
+  FROM notification_channels
+ WHERE user_id = ?
+ ORDER BY name`, userID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from notification_channels")
+	}
+	return channels, nil
+}
+
+// NotificationChannelCreate implements the DB interface.
+func (db *SQLDB) NotificationChannelCreate(ctx context.Context, channel *NotificationChannel) (int, error) {
+	channelID, err := db.insertNamed(ctx, db.sqlx, `
+INSERT INTO notification_channels (user_id, name, type, target, verify_token)
+VALUES (:user_id, :name, :type, :target, :verify_token)`, channel)
+	return channelID, errors.Wrap(err, "could not insert notification channel")
+}
+
+// NotificationChannelDelete implements the DB interface.
+func (db *SQLDB) NotificationChannelDelete(ctx context.Context, userID, channelID int) error {
+	_, err := db.sqlx.ExecContext(ctx, `DELETE FROM notification_channels WHERE user_id = ? AND id = ?`, userID, channelID)
+	return errors.Wrap(err, "could not delete notification channel")
+}
+
+// NotificationChannelVerify implements the DB interface.
+func (db *SQLDB) NotificationChannelVerify(ctx context.Context, userID int, token string) (bool, error) {
+	result, err := db.sqlx.ExecContext(ctx, `
+UPDATE notification_channels SET verified_at = ?
+ WHERE user_id = ? AND verify_token = ? AND verified_at IS NULL`, time.Now(), userID, token)
+	if err != nil {
+		return false, errors.Wrap(err, "could not verify notification channel")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "could not get verified notification channels")
+	}
+	return affected > 0, nil
+}
+
+// EventsCreate implements the DB interface.
+func (db *SQLDB) EventsCreate(ctx context.Context, events []Event) ([]bool, error) {
+	tx, err := db.sqlx.Beginx()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not begin transaction")
+	}
+	defer tx.Rollback()
+
+	inserted := make([]bool, len(events))
+	for i, event := range events {
+		// Duplicates update nothing, so no rows are affected.
+		res, err := tx.NamedExecContext(ctx, `
+INSERT INTO events (
+	user_id, github_id, dedup_key, created_at, type, public, repository, repository_id, number,
+	actor, action, subject, title, body, discarded, muted, priority, tag
+) VALUES (
+	:user_id, :github_id, :dedup_key, :created_at, :type, :public, :repository, :repository_id, :number,
+	:actor, :action, :subject, :title, :body, :discarded, :muted, :priority, :tag
+) `+db.onConflictIgnore("user_id, dedup_key"), event)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not insert event")
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not get rows affected")
+		}
+		inserted[i] = affected > 0
+	}
+
+	return inserted, errors.Wrap(tx.Commit(), "could not commit events")
+}
+
+// eventsWhere returns the WHERE clause and its arguments for a user's events
+// matching query.
+func (db *SQLDB) eventsWhere(userID int, query EventQuery) (string, []interface{}) {
+	where := "WHERE user_id = ?"
+	args := []interface{}{userID}
+
+	if query.Search != "" {
+		search, searchArgs := db.eventsSearch(query.Search)
+		where += " AND " + search
+		args = append(args, searchArgs...)
+	}
+	if query.Repository != "" {
+		where += " AND repository = ?"
+		args = append(args, query.Repository)
+	}
+	if query.Type != "" {
+		where += " AND type = ?"
+		args = append(args, query.Type)
+	}
+	if query.Actor != "" {
+		where += " AND actor = ?"
+		args = append(args, query.Actor)
+	}
+	if query.Tag != "" {
+		where += " AND tag = ?"
+		args = append(args, query.Tag)
+	}
+	switch query.Status {
+	case EventStatusAccepted:
+		where += " AND discarded = FALSE"
+	case EventStatusDiscarded:
+		where += " AND discarded = TRUE"
+	}
+	switch query.Folder {
+	case EventFolderInbox:
+		where += " AND discarded = FALSE AND archived = FALSE"
+	case EventFolderUnread:
+		where += " AND discarded = FALSE AND read_at IS NULL"
+	case EventFolderStarred:
+		where += " AND starred = TRUE"
+	case EventFolderArchived:
+		where += " AND archived = TRUE"
+	}
+	return where, args
+}
+
+// UsersEvents implements the DB interface.
+func (db *SQLDB) UsersEvents(ctx context.Context, userID int, query EventQuery) ([]Event, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PerPage < 1 {
+		query.PerPage = 50
+	}
+
+	where, args := db.eventsWhere(userID, query)
+	args = append(args, query.PerPage, (query.Page-1)*query.PerPage)
+
+	var events []Event
+	err := db.sqlx.SelectContext(ctx, &events, `
+SELECT id, user_id, github_id, created_at, type, public, repository, repository_id, number,
+       actor, action, subject, title, body, discarded, muted, priority, tag, read_at, archived, starred
+  FROM events `+where+`
+ ORDER BY created_at DESC, id DESC
+ LIMIT ? OFFSET ?`, args...)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from events")
+	}
+	return events, nil
+}
+
+// UsersEventFacets implements the DB interface.
+func (db *SQLDB) UsersEventFacets(ctx context.Context, userID int, query EventQuery) (*EventFacets, error) {
+	where, args := db.eventsWhere(userID, query)
+
+	facets := &EventFacets{}
+	for _, facet := range []struct {
+		column string
+		dest   *[]EventFacet
+	}{
+		{"repository", &facets.Repositories},
+		{"type", &facets.Types},
+		{"actor", &facets.Actors},
+		{"CASE WHEN discarded THEN '" + EventStatusDiscarded + "' ELSE '" + EventStatusAccepted + "' END", &facets.Statuses},
+	} {
+		err := db.sqlx.SelectContext(ctx, facet.dest, `
+SELECT `+facet.column+` AS value, COUNT(*) AS count
+  FROM events `+where+`
+ GROUP BY value
+ ORDER BY count DESC, value
+ LIMIT 20`, args...)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "could not select event facets")
+		}
+	}
+	return facets, nil
+}
+
+// UsersEventsByID implements the DB interface.
+func (db *SQLDB) UsersEventsByID(ctx context.Context, userID int, eventIDs []int) ([]Event, error) {
+	if len(eventIDs) == 0 {
+		return nil, nil
+	}
+	query, args, err := sqlx.In(`
+SELECT id, user_id, github_id, created_at, type, public, repository, repository_id, number,
+       actor, action, subject, title, body, discarded, muted, priority, tag, read_at, archived, starred
+  FROM events
+ WHERE user_id = ? AND id IN (?)`, userID, eventIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	var events []Event
+	err = db.sqlx.SelectContext(ctx, &events, query, args...)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from events")
+	}
+	return events, nil
+}
+
+// UsersEventsAfter implements the DB interface.
+func (db *SQLDB) UsersEventsAfter(ctx context.Context, userID, eventID int) ([]Event, error) {
+	var events []Event
+	err := db.sqlx.SelectContext(ctx, &events, `
+SELECT id, user_id, github_id, created_at, type, public, repository, repository_id, number,
+       actor, action, subject, title, body, discarded, muted, priority, tag, read_at, archived, starred
+  FROM events
+ WHERE user_id = ? AND id > ? AND discarded = FALSE
+ ORDER BY id
+ LIMIT 100`, userID, eventID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from events")
+	}
+	return events, nil
+}
+
+// UsersLatestEventID implements the DB interface.
+func (db *SQLDB) UsersLatestEventID(ctx context.Context, userID int) (int, error) {
+	var eventID int
+	err := db.sqlx.GetContext(ctx, &eventID, `SELECT COALESCE(MAX(id), 0) FROM events WHERE user_id = ?`, userID)
+	return eventID, errors.Wrap(err, "could not select latest event id")
+}
+
+// UsersUnreadCount implements the DB interface.
+func (db *SQLDB) UsersUnreadCount(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := db.sqlx.GetContext(ctx, &count, `SELECT COUNT(*) FROM events WHERE user_id = ? AND discarded = FALSE AND read_at IS NULL`, userID)
+	return count, errors.Wrap(err, "could not count unread events")
+}
+
+// EventsMarkRead implements the DB interface.
+func (db *SQLDB) EventsMarkRead(ctx context.Context, userID int, eventIDs []int, read bool) error {
+	if len(eventIDs) == 0 {
+		return nil
+	}
+	var readAt *time.Time
+	if read {
+		now := time.Now()
+		readAt = &now
+	}
+	query, args, err := sqlx.In(`UPDATE events SET read_at = ? WHERE user_id = ? AND id IN (?)`, readAt, userID, eventIDs)
+	if err != nil {
+		return errors.Wrap(err, "could not build events read query")
+	}
+	_, err = db.sqlx.ExecContext(ctx, query, args...)
+	return errors.Wrap(err, "could not mark events read")
+}
+
+// EventsMarkRepositoryRead implements the DB interface.
+func (db *SQLDB) EventsMarkRepositoryRead(ctx context.Context, userID int, repository string) error {
+	_, err := db.sqlx.ExecContext(ctx, `UPDATE events SET read_at = ? WHERE user_id = ? AND repository = ? AND read_at IS NULL`, time.Now(), userID, repository)
+	return errors.Wrapf(err, "could not mark repository %q events read", repository)
+}
+
+// EventArchive implements the DB interface.
+func (db *SQLDB) EventArchive(ctx context.Context, userID, eventID int, archived bool) error {
+	_, err := db.sqlx.ExecContext(ctx, `UPDATE events SET archived = ?, read_at = COALESCE(read_at, ?) WHERE user_id = ? AND id = ?`, archived, time.Now(), userID, eventID)
+	return errors.Wrapf(err, "could not archive event %d", eventID)
+}
+
+// EventStar implements the DB interface.
+func (db *SQLDB) EventStar(ctx context.Context, userID, eventID int, starred bool) error {
+	_, err := db.sqlx.ExecContext(ctx, `UPDATE events SET starred = ? WHERE user_id = ? AND id = ?`, starred, userID, eventID)
+	return errors.Wrapf(err, "could not star event %d", eventID)
+}
+
+// UsersAPITokens implements the DB interface.
+func (db *SQLDB) UsersAPITokens(ctx context.Context, userID int) ([]APIToken, error) {
+	var tokens []APIToken
+	err := db.sqlx.SelectContext(ctx, &tokens, `
+SELECT id, user_id, name, scope, token_hash, last_used_at, created_at
+  FROM api_tokens
+ WHERE user_id = ?
+ ORDER BY created_at`, userID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from api_tokens")
+	}
+	return tokens, nil
+}
+
+// APITokenByHash implements the DB interface.
+func (db *SQLDB) APITokenByHash(ctx context.Context, tokenHash string) (*APIToken, error) {
+	token := &APIToken{}
+	err := db.sqlx.GetContext(ctx, token, `
+SELECT id, user_id, name, scope, token_hash, last_used_at, created_at
+  FROM api_tokens
+ WHERE token_hash = ?`, tokenHash)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from api_tokens")
+	}
+	return token, nil
+}
+
+// APITokenCreate implements the DB interface.
+func (db *SQLDB) APITokenCreate(ctx context.Context, token *APIToken) (int, error) {
+	tokenID, err := db.insertNamed(ctx, db.sqlx, `
+INSERT INTO api_tokens (user_id, name, scope, token_hash)
+VALUES (:user_id, :name, :scope, :token_hash)`, token)
+	return tokenID, errors.Wrap(err, "could not insert api token")
+}
+
+// APITokenUsed implements the DB interface.
+func (db *SQLDB) APITokenUsed(ctx context.Context, tokenID int, usedAt time.Time) error {
+	_, err := db.sqlx.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, usedAt, tokenID)
+	return errors.Wrapf(err, "could not update api token %d", tokenID)
+}
+
+// APITokenDelete implements the DB interface.
+func (db *SQLDB) APITokenDelete(ctx context.Context, userID, tokenID int) error {
+	_, err := db.sqlx.ExecContext(ctx, `DELETE FROM api_tokens WHERE user_id = ? AND id = ?`, userID, tokenID)
+	return errors.Wrap(err, "could not delete api token")
+}
+
+// Installation implements the DB interface.
+func (db *SQLDB) Installation(ctx context.Context, installationID int) (*Installation, error) {
+	installation := &Installation{}
+	err := db.sqlx.GetContext(ctx, installation, `SELECT id, account_id, account_login, sender_github_id, created_at FROM installations WHERE id = ?`, installationID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from installations")
+	}
+	return installation, nil
+}
+
+// InstallationCreate implements the DB interface.
+func (db *SQLDB) InstallationCreate(ctx context.Context, installation *Installation) error {
+	_, err := db.sqlx.NamedExecContext(ctx, `
+INSERT INTO installations (id, account_id, account_login, sender_github_id)
+VALUES (:id, :account_id, :account_login, :sender_github_id)
+`+db.onConflictUpdate("id", "account_login"), installation)
+	return errors.Wrapf(err, "could not insert installation %d", installation.ID)
+}
+
+// InstallationDelete implements the DB interface.
+func (db *SQLDB) InstallationDelete(ctx context.Context, installationID int) error {
+	_, err := db.sqlx.ExecContext(ctx, `DELETE FROM installations WHERE id = ?`, installationID)
+	return errors.Wrapf(err, "could not delete installation %d", installationID)
+}
+
+// InstallationRepositoriesCreate implements the DB interface.
+func (db *SQLDB) InstallationRepositoriesCreate(ctx context.Context, repos []InstallationRepository) error {
+	for _, repo := range repos {
+		_, err := db.sqlx.NamedExecContext(ctx, `
+INSERT INTO installation_repositories (installation_id, repository_id, full_name)
+VALUES (:installation_id, :repository_id, :full_name)
+`+db.onConflictUpdate("installation_id, repository_id", "full_name"), repo)
+		if err != nil {
+			return errors.Wrapf(err, "could not insert installation repository %q", repo.FullName)
+		}
+	}
+	return nil
+}
+
+// InstallationRepositoriesDelete implements the DB interface.
+func (db *SQLDB) InstallationRepositoriesDelete(ctx context.Context, installationID int, repositoryIDs []int) error {
+	if len(repositoryIDs) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In(`DELETE FROM installation_repositories WHERE installation_id = ? AND repository_id IN (?)`, installationID, repositoryIDs)
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+	_, err = db.sqlx.ExecContext(ctx, query, args...)
+	return errors.Wrap(err, "could not delete installation repositories")
+}
+
+// InstallationRepositoriesDue implements the DB interface.
+func (db *SQLDB) InstallationRepositoriesDue(ctx context.Context) ([]InstallationRepository, error) {
+	var repos []InstallationRepository
+	err := db.sqlx.SelectContext(ctx, &repos, `
+SELECT installation_id, repository_id, full_name, event_last_created_at, event_next_poll
+  FROM installation_repositories
+ WHERE event_next_poll <= ?`, time.Now())
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from installation_repositories")
+	}
+	return repos, nil
+}
+
+// SetInstallationRepositoryPollResult implements the DB interface.
+func (db *SQLDB) SetInstallationRepositoryPollResult(ctx context.Context, installationID, repositoryID int, lastCreatedAt, nextPoll time.Time) error {
+	_, err := db.sqlx.ExecContext(ctx, `
+UPDATE installation_repositories SET event_last_created_at = ?, event_next_poll = ?
+ WHERE installation_id = ? AND repository_id = ?`, lastCreatedAt, nextPoll, installationID, repositoryID)
+	return errors.Wrapf(err, "could not set poll result for installation %d repository %d", installationID, repositoryID)
+}
+
+// SetUsersNotificationsSince implements the DB interface.
+func (db *SQLDB) SetUsersNotificationsSince(ctx context.Context, userID int, since time.Time) error {
+	_, err := db.sqlx.ExecContext(ctx, "UPDATE users SET notifications_since = ? WHERE id = ?", since, userID)
+	return errors.Wrapf(err, "could not set notifications since for userID %d", userID)
+}
+
+// SetUsersPollStatus implements the DB interface.
+func (db *SQLDB) SetUsersPollStatus(ctx context.Context, userID int, polledAt time.Time, pollError string, tokenValid bool) error {
+	if len(pollError) > 1024 {
+		pollError = pollError[:1024]
+	}
+	_, err := db.sqlx.ExecContext(ctx, "UPDATE users SET polled_at = ?, poll_error = ?, github_token_valid = ? WHERE id = ?", polledAt, pollError, tokenValid, userID)
+	return errors.Wrapf(err, "could not set poll status for userID %d", userID)
+}
+
+// UserPollPausedUpdate implements the DB interface.
+func (db *SQLDB) UserPollPausedUpdate(ctx context.Context, userID int, paused bool) error {
+	_, err := db.sqlx.ExecContext(ctx, "UPDATE users SET poll_paused = ? WHERE id = ?", paused, userID)
+	return errors.Wrapf(err, "could not update poll paused for userID %d", userID)
+}
+
+// UserPollNow implements the DB interface.
+func (db *SQLDB) UserPollNow(ctx context.Context, userID int) error {
+	_, err := db.sqlx.ExecContext(ctx, "UPDATE users SET event_next_poll = ? WHERE id = ?", time.Now(), userID)
+	return errors.Wrapf(err, "could not update next poll for userID %d", userID)
+}
+
+// AdminUsers implements the DB interface.
+func (db *SQLDB) AdminUsers(ctx context.Context, failuresSince time.Time) ([]AdminUser, error) {
+	var rows []struct {
+		AdminUser
+		LastDeliveryFailure sql.NullString `db:"last_delivery_failure"` // parsed into LastDeliveryFailureAt
+	}
+	err := db.sqlx.SelectContext(ctx, &rows, `
+SELECT `+userColumns+`,
+       (SELECT COUNT(*) FROM delivery_failures f WHERE f.user_id = users.id AND f.created_at > ?) AS delivery_failures,
+       (SELECT MAX(f.created_at) FROM delivery_failures f WHERE f.user_id = users.id AND f.created_at > ?) AS last_delivery_failure,
+       COALESCE((SELECT f.error FROM delivery_failures f WHERE f.user_id = users.id AND f.created_at > ?
+                  ORDER BY f.created_at DESC, f.id DESC LIMIT 1), '') AS last_delivery_failure_reason
+  FROM users
+ ORDER BY id`, failuresSince, failuresSince, failuresSince)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not select from users")
+	}
+
+	users := make([]AdminUser, len(rows))
+	for i, row := range rows {
+		users[i] = row.AdminUser
+		if row.LastDeliveryFailure.Valid {
+			lastFailureAt, err := db.parseTime(row.LastDeliveryFailure.String)
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not parse last delivery failure for userID %d", row.ID)
+			}
+			users[i].LastDeliveryFailureAt = &lastFailureAt
+		}
+		if err := db.githubToken(&users[i].User); err != nil {
+			return nil, err
+		}
+	}
+
+	return users, nil
+}
+
+// DeliveryFailureCreate implements the DB interface.
+func (db *SQLDB) DeliveryFailureCreate(ctx context.Context, failure *DeliveryFailure) error {
+	if len(failure.Error) > 1024 {
+		failure.Error = failure.Error[:1024]
+	}
+	_, err := db.sqlx.NamedExecContext(ctx, `
+INSERT INTO delivery_failures (user_id, channel, error)
+VALUES (:user_id, :channel, :error)`, failure)
+	return errors.Wrap(err, "could not insert delivery failure")
 }
 
 // SetUsersPollResult implements the DB interface.
 func (db *SQLDB) SetUsersPollResult(ctx context.Context, userID int, lastCreatedAt, nextPoll time.Time) error {
-	// TODO do
-	return nil
+	_, err := db.sqlx.ExecContext(ctx, "UPDATE users SET event_last_created_at = ?, event_next_poll = ? WHERE id = ?", lastCreatedAt, nextPoll, userID)
+	return errors.Wrapf(err, "could not set poll result for userID %d", userID)
 }
 
 // GitHubLogin implements the DB interface.
-func (db *SQLDB) GitHubLogin(ctx context.Context, email string, githubID int, githubLogin string, token *oauth2.Token) (int, error) {
+func (db *SQLDB) GitHubLogin(ctx context.Context, githubHost, email string, githubID int, githubLogin string, token *oauth2.Token) (int, error) {
 	jsonToken, err := json.Marshal(token)
 	if err != nil {
 		return 0, errors.Wrap(err, "could not marshal oauth2.token")
 	}
+	encToken, err := db.tokenKeys.Encrypt(jsonToken)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not encrypt oauth2.token")
+	}
 
 	// Check if user exists
 	var userID int
-	err = db.sqlx.QueryRowContext(ctx, "SELECT id FROM users WHERE github_id = ?", githubID).Scan(&userID)
+	err = db.sqlx.QueryRowContext(ctx, "SELECT id FROM users WHERE github_host = ? AND github_id = ?", githubHost, githubID).Scan(&userID)
 	switch {
 	case err == sql.ErrNoRows:
 		// Add token to new user
-		res, err := db.sqlx.ExecContext(ctx, "INSERT INTO users (email, github_id, github_login, github_token) VALUES (?, ?, ?, ?)", email, githubID, githubLogin, jsonToken)
-		if err != nil {
-			return 0, errors.Wrapf(err, "error inserting new githubID %q", githubID)
-		}
-		id, err := res.LastInsertId()
-		if err != nil {
-			return 0, errors.Wrap(err, "error in lastInsertId")
-		}
-		return int(id), nil
+		id, err := db.insert(ctx, db.sqlx, "INSERT INTO users (email, github_host, github_id, github_login, github_token) VALUES (?, ?, ?, ?, ?)", email, githubHost, githubID, githubLogin, encToken)
+		return id, errors.Wrapf(err, "error inserting new githubID %q", githubID)
 	case err != nil:
 		return 0, errors.Wrapf(err, "error getting userID for githubID %q", githubID)
 	}
 
 	// Add token to existing user and update email
-	_, err = db.sqlx.ExecContext(ctx, "UPDATE users SET email = ?, github_login = ?, github_token = ? WHERE id = ?", email, githubLogin, jsonToken, userID)
+	_, err = db.sqlx.ExecContext(ctx, "UPDATE users SET email = ?, github_login = ?, github_token = ? WHERE id = ?", email, githubLogin, encToken, userID)
 	if err != nil {
 		return 0, errors.Wrapf(err, "could update userID %d", userID)
 	}
 	return userID, nil
 }
+
+// GitHubTokensReencrypt implements the DB interface.
+func (db *SQLDB) GitHubTokensReencrypt(ctx context.Context) (int, error) {
+	var lastID, count int
+	for {
+		var rows []struct {
+			ID    int    `db:"id"`
+			Token []byte `db:"github_token"`
+		}
+		err := db.sqlx.SelectContext(ctx, &rows, "SELECT id, github_token FROM users WHERE id > ? ORDER BY id LIMIT 100", lastID)
+		if err != nil {
+			return count, errors.Wrap(err, "could not select from users")
+		}
+		if len(rows) == 0 {
+			return count, nil
+		}
+
+		for _, row := range rows {
+			lastID = row.ID
+			if db.tokenKeys.Current(row.Token) {
+				continue
+			}
+
+			plaintext, err := db.tokenKeys.Decrypt(row.Token)
+			if err != nil {
+				return count, errors.Wrapf(err, "could not decrypt github token for userID %d", row.ID)
+			}
+			encToken, err := db.tokenKeys.Encrypt(plaintext)
+			if err != nil {
+				return count, errors.Wrapf(err, "could not encrypt github token for userID %d", row.ID)
+			}
+
+			// Unchanged if the user logged in since, replacing their token.
+			_, err = db.sqlx.ExecContext(ctx, "UPDATE users SET github_token = ? WHERE id = ? AND github_token = ?", encToken, row.ID, row.Token)
+			if err != nil {
+				return count, errors.Wrapf(err, "could not update github token for userID %d", row.ID)
+			}
+			count++
+		}
+	}
+}
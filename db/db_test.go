@@ -0,0 +1,13 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/bradleyfalzon/maintainer.me/db/dbtest"
+)
+
+// TestSQLDB runs against an in-memory SQLite database, or the database set by
+// DBTEST_DRIVER and DBTEST_DSN.
+func TestSQLDB(t *testing.T) {
+	dbtest.Run(t, dbtest.NewSQLDB)
+}
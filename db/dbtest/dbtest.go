@@ -0,0 +1,170 @@
+// Package dbtest is a conformance test suite for implementations of db.DB,
+// such as db.SQLDB and memdb.DB, run from a test with:
+//
+//	func TestDB(t *testing.T) {
+//		dbtest.Run(t, func(t *testing.T) db.DB { return memdb.New() })
+//		dbtest.Run(t, dbtest.NewSQLDB)
+//	}
+package dbtest
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/maintainer.me/db"
+	"github.com/bradleyfalzon/maintainer.me/ghhost"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	migrate "github.com/rubenv/sql-migrate"
+	"golang.org/x/oauth2"
+)
+
+var ctx = context.Background()
+
+// Run runs the conformance tests against the db.DB returned by newDB, which
+// is called for each test and must return an empty database.
+func Run(t *testing.T, newDB func(t *testing.T) db.DB) {
+	tests := []struct {
+		name string
+		test func(*testing.T, db.DB)
+	}{
+		{"GitHubLogin", testGitHubLogin},
+		{"UserSettings", testUserSettings},
+		{"UsersPolling", testUsersPolling},
+		{"NotificationsPaused", testNotificationsPaused},
+		{"Filters", testFilters},
+		{"Teams", testTeams},
+		{"Mutes", testMutes},
+		{"Subscriptions", testSubscriptions},
+		{"HeldNotifications", testHeldNotifications},
+		{"NotificationChannels", testNotificationChannels},
+		{"Events", testEvents},
+		{"APITokens", testAPITokens},
+		{"Installations", testInstallations},
+		{"AdminUsers", testAdminUsers},
+		{"UserDelete", testUserDelete},
+		{"Concurrency", testConcurrency},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, newDB(t))
+		})
+	}
+}
+
+// tables are emptied by NewSQLDB, tables referenced by a foreign key are
+// after the tables referencing them.
+var tables = []string{
+	"delivery_failures", "subscriptions", "subscription_feeds", "installation_repositories", "installations",
+	"api_tokens", "events", "notification_channels", "held_notifications", "mutes", "conditions", "filters",
+	"team_memberships", "teams", "users",
+}
+
+// NewSQLDB returns an empty db.SQLDB for Run, migrated by its driver's
+// migrations. The driver and data source name are set by the environment
+// DBTEST_DRIVER and DBTEST_DSN, by default a new in-memory SQLite database is
+// used. The tables of a DBTEST_DSN database are emptied, and MySQL requires
+// parseTime=true.
+func NewSQLDB(t *testing.T) db.DB {
+	driver, dsn := os.Getenv("DBTEST_DRIVER"), os.Getenv("DBTEST_DSN")
+	if driver == "" {
+		driver, dsn = db.DriverSQLite, "file::memory:?_foreign_keys=1"
+	}
+
+	dbConn, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Fatalf("could not open %s database: %v", driver, err)
+	}
+	if driver == db.DriverSQLite {
+		// Each connection to an in-memory database is a separate database.
+		dbConn.SetMaxOpenConns(1)
+	}
+
+	_, file, _, _ := runtime.Caller(0)
+	migrations := &migrate.FileMigrationSource{Dir: filepath.Join(filepath.Dir(file), "..", "..", "migrations", driver)}
+	if _, err := migrate.ExecMax(dbConn, driver, migrations, migrate.Up, 0); err != nil {
+		t.Fatalf("could not run %s migrations: %v", driver, err)
+	}
+	for _, table := range tables {
+		if _, err := dbConn.Exec("DELETE FROM " + table); err != nil {
+			t.Fatalf("could not empty table %s: %v", table, err)
+		}
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("could not generate token key: %v", err)
+	}
+	tokenKeys, err := db.ParseTokenKeys("test:" + base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		t.Fatalf("could not parse token key: %v", err)
+	}
+
+	return db.NewSQLDB(driver, dbConn, tokenKeys)
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newUser logs in a new GitHub.com user with githubID, and returns the user.
+func newUser(t *testing.T, d db.DB, githubID int) *db.User {
+	t.Helper()
+	login := fmt.Sprintf("user%d", githubID)
+	userID, err := d.GitHubLogin(ctx, ghhost.GitHubCom, login+"@example.com", githubID, login, &oauth2.Token{AccessToken: "token-" + login})
+	check(t, err)
+	return getUser(t, d, userID)
+}
+
+// getUser returns the user with userID, failing if the user doesn't exist.
+func getUser(t *testing.T, d db.DB, userID int) *db.User {
+	t.Helper()
+	user, err := d.User(ctx, userID)
+	check(t, err)
+	if user == nil {
+		t.Fatalf("User(%d) returned nil", userID)
+	}
+	return user
+}
+
+// polled returns true if the user is returned by Users to be polled.
+func polled(t *testing.T, d db.DB, userID int) bool {
+	t.Helper()
+	users, err := d.Users(ctx)
+	check(t, err)
+	for _, user := range users {
+		if user.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// titles returns the titles of events.
+func titles(events []db.Event) []string {
+	var titles []string
+	for _, event := range events {
+		titles = append(titles, event.Title)
+	}
+	return titles
+}
+
+// closeTo returns true if the times are within a second of each other, as
+// databases store times with different precisions.
+func closeTo(a, b time.Time) bool {
+	d := a.Sub(b)
+	return d > -time.Second && d < time.Second
+}
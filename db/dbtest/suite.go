@@ -0,0 +1,997 @@
+package dbtest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradleyfalzon/maintainer.me/db"
+	"github.com/bradleyfalzon/maintainer.me/ghhost"
+	"golang.org/x/oauth2"
+)
+
+func testGitHubLogin(t *testing.T, d db.DB) {
+	userID, err := d.GitHubLogin(ctx, ghhost.GitHubCom, "a@example.com", 1, "a", &oauth2.Token{AccessToken: "token1"})
+	check(t, err)
+
+	user := getUser(t, d, userID)
+	switch {
+	case user.ID != userID || user.Email != "a@example.com" || user.GitHubHost != ghhost.GitHubCom || user.GitHubID != 1 || user.GitHubLogin != "a":
+		t.Errorf("User(%d) returned %+v, want the logged in user", userID, user)
+	case user.GitHubToken == nil || user.GitHubToken.AccessToken != "token1":
+		t.Errorf("user's GitHubToken is %+v, want access token %q", user.GitHubToken, "token1")
+	case !user.GitHubTokenValid || !user.FilterDefaultDiscard || user.Timezone != "UTC" || user.Admin || user.NotificationsPaused || user.PollPaused:
+		t.Errorf("new user %+v doesn't have the default settings", user)
+	}
+
+	// Logging in again updates the existing user.
+	again, err := d.GitHubLogin(ctx, ghhost.GitHubCom, "b@example.com", 1, "b", &oauth2.Token{AccessToken: "token2"})
+	check(t, err)
+	if again != userID {
+		t.Fatalf("GitHubLogin for an existing user returned userID %d, want %d", again, userID)
+	}
+	user, err = d.UserByGitHubID(ctx, ghhost.GitHubCom, 1)
+	check(t, err)
+	if user == nil || user.Email != "b@example.com" || user.GitHubLogin != "b" || user.GitHubToken == nil || user.GitHubToken.AccessToken != "token2" {
+		t.Errorf("UserByGitHubID returned %+v, want the updated email, login and token", user)
+	}
+
+	// The same GitHub ID on another host is another user.
+	otherID, err := d.GitHubLogin(ctx, "github.example.com", "b@example.com", 1, "b", &oauth2.Token{AccessToken: "token3"})
+	check(t, err)
+	if otherID == userID {
+		t.Fatalf("GitHubLogin on another host returned the same userID %d", userID)
+	}
+	user, err = d.UserByGitHubLogin(ctx, "github.example.com", "b")
+	check(t, err)
+	if user == nil || user.ID != otherID {
+		t.Errorf("UserByGitHubLogin returned %+v, want userID %d", user, otherID)
+	}
+
+	for name, lookup := range map[string]func() (*db.User, error){
+		"User":              func() (*db.User, error) { return d.User(ctx, otherID+userID) },
+		"UserByGitHubID":    func() (*db.User, error) { return d.UserByGitHubID(ctx, ghhost.GitHubCom, 2) },
+		"UserByGitHubLogin": func() (*db.User, error) { return d.UserByGitHubLogin(ctx, ghhost.GitHubCom, "missing") },
+	} {
+		user, err := lookup()
+		check(t, err)
+		if user != nil {
+			t.Errorf("%s for a missing user returned %+v, want nil", name, user)
+		}
+	}
+
+	if _, err := d.GitHubTokensReencrypt(ctx); err != nil {
+		t.Fatalf("GitHubTokensReencrypt returned error: %v", err)
+	}
+	if user := getUser(t, d, userID); user.GitHubToken == nil || user.GitHubToken.AccessToken != "token2" {
+		t.Errorf("user's GitHubToken after re-encrypting is %+v, want access token %q", user.GitHubToken, "token2")
+	}
+}
+
+func testUserSettings(t *testing.T, d db.DB) {
+	user := newUser(t, d, 1)
+
+	user.FilterDefaultDiscard = false
+	user.Timezone = "Australia/Adelaide"
+	user.QuietHoursStart, user.QuietHoursEnd = 22, 7
+	user.NotificationsEnabled, user.NotificationsMarkRead = true, true
+	check(t, d.UserUpdate(ctx, user))
+
+	got := getUser(t, d, user.ID)
+	if got.FilterDefaultDiscard || got.Timezone != user.Timezone || got.QuietHoursStart != 22 || got.QuietHoursEnd != 7 ||
+		!got.NotificationsEnabled || !got.NotificationsMarkRead {
+		t.Errorf("user after UserUpdate is %+v, want %+v", got, user)
+	}
+
+	check(t, d.UserFeedTokenUpdate(ctx, user.ID, "feedtoken"))
+	got, err := d.UserByFeedToken(ctx, "feedtoken")
+	check(t, err)
+	if got == nil || got.ID != user.ID {
+		t.Errorf("UserByFeedToken returned %+v, want userID %d", got, user.ID)
+	}
+
+	// A blank feed token disables the feed.
+	check(t, d.UserFeedTokenUpdate(ctx, user.ID, ""))
+	for _, token := range []string{"feedtoken", ""} {
+		got, err := d.UserByFeedToken(ctx, token)
+		check(t, err)
+		if got != nil {
+			t.Errorf("UserByFeedToken(%q) for a disabled feed returned %+v, want nil", token, got)
+		}
+	}
+
+	check(t, d.UserWebhookSecretUpdate(ctx, user.ID, "secret"))
+	if got := getUser(t, d, user.ID); got.WebhookSecret != "secret" {
+		t.Errorf("user's WebhookSecret is %q, want %q", got.WebhookSecret, "secret")
+	}
+}
+
+func testUsersPolling(t *testing.T, d db.DB) {
+	user := newUser(t, d, 1)
+	if !polled(t, d, user.ID) {
+		t.Errorf("new user is not due to be polled")
+	}
+
+	lastCreatedAt, nextPoll := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	check(t, d.SetUsersPollResult(ctx, user.ID, lastCreatedAt, nextPoll))
+	if polled(t, d, user.ID) {
+		t.Errorf("user is due to be polled before their next poll")
+	}
+	if got := getUser(t, d, user.ID); !closeTo(got.EventLastCreatedAt, lastCreatedAt) || !closeTo(got.EventNextPoll, nextPoll) {
+		t.Errorf("user's poll result is %v and %v, want %v and %v", got.EventLastCreatedAt, got.EventNextPoll, lastCreatedAt, nextPoll)
+	}
+
+	check(t, d.UserPollNow(ctx, user.ID))
+	if !polled(t, d, user.ID) {
+		t.Errorf("user is not due to be polled after UserPollNow")
+	}
+
+	check(t, d.UserPollPausedUpdate(ctx, user.ID, true))
+	if polled(t, d, user.ID) {
+		t.Errorf("user with polling paused is due to be polled")
+	}
+	if got := getUser(t, d, user.ID); !got.PollPaused {
+		t.Errorf("user's PollPaused is false after pausing")
+	}
+	check(t, d.UserPollPausedUpdate(ctx, user.ID, false))
+	if !polled(t, d, user.ID) {
+		t.Errorf("user is not due to be polled after resuming polling")
+	}
+
+	polledAt := time.Now()
+	check(t, d.SetUsersPollStatus(ctx, user.ID, polledAt, strings.Repeat("x", 2000), false))
+	got := getUser(t, d, user.ID)
+	switch {
+	case got.PolledAt == nil || !closeTo(*got.PolledAt, polledAt):
+		t.Errorf("user's PolledAt is %v, want %v", got.PolledAt, polledAt)
+	case len(got.PollError) != 1024:
+		t.Errorf("user's PollError has length %d, want the error truncated to 1024", len(got.PollError))
+	case got.GitHubTokenValid:
+		t.Errorf("user's GitHubTokenValid is true, want false")
+	}
+
+	since := time.Now().Add(-time.Minute)
+	check(t, d.SetUsersNotificationsSince(ctx, user.ID, since))
+	if got := getUser(t, d, user.ID); !closeTo(got.NotificationsSince, since) {
+		t.Errorf("user's NotificationsSince is %v, want %v", got.NotificationsSince, since)
+	}
+}
+
+func testNotificationsPaused(t *testing.T, d db.DB) {
+	user := newUser(t, d, 1)
+	check(t, d.SetUsersPollResult(ctx, user.ID, time.Now().Add(-24*time.Hour), time.Now().Add(time.Hour)))
+
+	check(t, d.UserNotificationsPausedUpdate(ctx, user.ID, true))
+	if got := getUser(t, d, user.ID); !got.NotificationsPaused {
+		t.Errorf("user's NotificationsPaused is false after pausing")
+	}
+
+	// Resuming polls from now, rather than since notifications were paused.
+	resumed := time.Now()
+	check(t, d.UserNotificationsPausedUpdate(ctx, user.ID, false))
+	got := getUser(t, d, user.ID)
+	switch {
+	case got.NotificationsPaused:
+		t.Errorf("user's NotificationsPaused is true after resuming")
+	case !closeTo(got.EventLastCreatedAt, resumed) || !closeTo(got.NotificationsSince, resumed):
+		t.Errorf("user's EventLastCreatedAt %v and NotificationsSince %v, want %v", got.EventLastCreatedAt, got.NotificationsSince, resumed)
+	case !polled(t, d, user.ID):
+		t.Errorf("user is not due to be polled after resuming")
+	}
+}
+
+func testFilters(t *testing.T, d db.DB) {
+	user, other := newUser(t, d, 1), newUser(t, d, 2)
+
+	filter := &db.Filter{UserID: user.ID, Urgent: true, Priority: 2, Tag: "ci"}
+	filter.SetChannels([]string{"email", "slack"})
+	filterID, err := d.FilterCreate(ctx, filter)
+	check(t, err)
+	conditionID, err := d.ConditionCreate(ctx, &db.Condition{FilterID: filterID, Type: "PushEvent", RepositoryID: 10})
+	check(t, err)
+
+	got, err := d.Filter(ctx, filterID)
+	check(t, err)
+	switch {
+	case got == nil:
+		t.Fatalf("Filter(%d) returned nil", filterID)
+	case got.UserID != user.ID || got.TeamID != 0 || got.OnMatchDiscard || !got.Urgent || got.Priority != 2 || got.Tag != "ci":
+		t.Errorf("Filter(%d) returned %+v, want %+v", filterID, got, filter)
+	case !reflect.DeepEqual(got.Channels, []string{"email", "slack"}):
+		t.Errorf("filter's Channels are %q, want %q", got.Channels, []string{"email", "slack"})
+	case len(got.Conditions) != 1 || got.Conditions[0].ID != conditionID || got.Conditions[0].Type != "PushEvent" || got.Conditions[0].RepositoryID != 10:
+		t.Errorf("filter's Conditions are %+v, want condition %d", got.Conditions, conditionID)
+	}
+
+	filters, err := d.UsersFilters(ctx, user.ID)
+	check(t, err)
+	if len(filters) != 1 || filters[0].ID != filterID || len(filters[0].Conditions) != 1 {
+		t.Errorf("UsersFilters returned %+v, want filter %d with its condition", filters, filterID)
+	}
+	filters, err = d.UsersFilters(ctx, other.ID)
+	check(t, err)
+	if len(filters) != 0 {
+		t.Errorf("UsersFilters for another user returned %+v, want none", filters)
+	}
+
+	got.OnMatchDiscard, got.Urgent, got.Priority, got.Tag = true, false, 0, ""
+	got.SetChannels(nil)
+	check(t, d.FilterUpdate(ctx, got))
+	got, err = d.Filter(ctx, filterID)
+	check(t, err)
+	if got == nil || !got.OnMatchDiscard || got.Urgent || got.Priority != 0 || got.Tag != "" || len(got.Channels) != 0 {
+		t.Errorf("filter after FilterUpdate is %+v", got)
+	}
+
+	// Only the filter's owner may delete its conditions and the filter.
+	check(t, d.ConditionDelete(ctx, other.ID, conditionID))
+	if condition, err := d.Condition(ctx, conditionID); err != nil || condition == nil || condition.FilterID != filterID {
+		t.Fatalf("Condition(%d) after another user's ConditionDelete returned %+v, %v", conditionID, condition, err)
+	}
+	check(t, d.ConditionDelete(ctx, user.ID, conditionID))
+	if condition, err := d.Condition(ctx, conditionID); err != nil || condition != nil {
+		t.Fatalf("Condition(%d) after ConditionDelete returned %+v, %v", conditionID, condition, err)
+	}
+
+	conditionID, err = d.ConditionCreate(ctx, &db.Condition{FilterID: filterID, Type: "IssuesEvent"})
+	check(t, err)
+	check(t, d.FilterDelete(ctx, other.ID, filterID))
+	if got, err := d.Filter(ctx, filterID); err != nil || got == nil {
+		t.Fatalf("Filter(%d) after another user's FilterDelete returned %+v, %v", filterID, got, err)
+	}
+	check(t, d.FilterDelete(ctx, user.ID, filterID))
+	if got, err := d.Filter(ctx, filterID); err != nil || got != nil {
+		t.Errorf("Filter(%d) after FilterDelete returned %+v, %v", filterID, got, err)
+	}
+	if condition, err := d.Condition(ctx, conditionID); err != nil || condition != nil {
+		t.Errorf("Condition(%d) after FilterDelete returned %+v, %v", conditionID, condition, err)
+	}
+}
+
+func testTeams(t *testing.T, d db.DB) {
+	owner, member := newUser(t, d, 1), newUser(t, d, 2)
+
+	teamID, err := d.TeamCreate(ctx, &db.Team{Name: "gophers"}, owner.ID)
+	check(t, err)
+	if team, err := d.Team(ctx, teamID); err != nil || team == nil || team.Name != "gophers" {
+		t.Fatalf("Team(%d) returned %+v, %v", teamID, team, err)
+	}
+
+	membership, err := d.TeamMembership(ctx, teamID, owner.ID)
+	check(t, err)
+	if membership == nil || !membership.Owner() || membership.TeamName != "gophers" || membership.GitHubLogin != owner.GitHubLogin {
+		t.Errorf("TeamMembership for the team's creator returned %+v, want owner", membership)
+	}
+	membership, err = d.TeamMembership(ctx, teamID, member.ID)
+	check(t, err)
+	if membership != nil {
+		t.Errorf("TeamMembership for a non-member returned %+v, want nil", membership)
+	}
+
+	check(t, d.TeamMembershipCreate(ctx, &db.TeamMembership{TeamID: teamID, UserID: member.ID, Role: db.TeamRoleMember}))
+	memberships, err := d.TeamsMemberships(ctx, teamID)
+	check(t, err)
+	if len(memberships) != 2 || memberships[0].UserID != owner.ID || memberships[1].UserID != member.ID || memberships[1].Owner() {
+		t.Errorf("TeamsMemberships returned %+v, want the owner and member ordered by login", memberships)
+	}
+
+	// Adding an existing member updates their role.
+	check(t, d.TeamMembershipCreate(ctx, &db.TeamMembership{TeamID: teamID, UserID: member.ID, Role: db.TeamRoleOwner}))
+	if membership, err := d.TeamMembership(ctx, teamID, member.ID); err != nil || membership == nil || !membership.Owner() {
+		t.Errorf("TeamMembership after updating the role returned %+v, %v, want owner", membership, err)
+	}
+	check(t, d.TeamMembershipCreate(ctx, &db.TeamMembership{TeamID: teamID, UserID: member.ID, Role: db.TeamRoleMember}))
+
+	memberships, err = d.UsersTeams(ctx, member.ID)
+	check(t, err)
+	if len(memberships) != 1 || memberships[0].TeamID != teamID || memberships[0].TeamName != "gophers" {
+		t.Errorf("UsersTeams returned %+v, want team %d", memberships, teamID)
+	}
+
+	filterID, err := d.FilterCreate(ctx, &db.Filter{TeamID: teamID, Tag: "team"})
+	check(t, err)
+	filters, err := d.UsersTeamFilters(ctx, member.ID)
+	check(t, err)
+	if len(filters) != 1 || filters[0].ID != filterID || filters[0].TeamID != teamID || filters[0].UserID != 0 {
+		t.Errorf("UsersTeamFilters returned %+v, want filter %d", filters, filterID)
+	}
+	filters, err = d.TeamsFilters(ctx, teamID)
+	check(t, err)
+	if len(filters) != 1 || filters[0].ID != filterID {
+		t.Errorf("TeamsFilters returned %+v, want filter %d", filters, filterID)
+	}
+	filters, err = d.UsersFilters(ctx, member.ID)
+	check(t, err)
+	if len(filters) != 0 {
+		t.Errorf("UsersFilters returned the team's filters %+v", filters)
+	}
+
+	// Only owners may delete a team's filters.
+	check(t, d.FilterDelete(ctx, member.ID, filterID))
+	if got, err := d.Filter(ctx, filterID); err != nil || got == nil {
+		t.Fatalf("Filter(%d) after a member's FilterDelete returned %+v, %v", filterID, got, err)
+	}
+	check(t, d.FilterDelete(ctx, owner.ID, filterID))
+	if got, err := d.Filter(ctx, filterID); err != nil || got != nil {
+		t.Fatalf("Filter(%d) after an owner's FilterDelete returned %+v, %v", filterID, got, err)
+	}
+
+	filterID, err = d.FilterCreate(ctx, &db.Filter{TeamID: teamID})
+	check(t, err)
+	check(t, d.TeamMembershipDelete(ctx, teamID, member.ID))
+	if memberships, err := d.UsersTeams(ctx, member.ID); err != nil || len(memberships) != 0 {
+		t.Errorf("UsersTeams after TeamMembershipDelete returned %+v, %v", memberships, err)
+	}
+	if filters, err := d.UsersTeamFilters(ctx, member.ID); err != nil || len(filters) != 0 {
+		t.Errorf("UsersTeamFilters after TeamMembershipDelete returned %+v, %v", filters, err)
+	}
+
+	check(t, d.TeamDelete(ctx, teamID))
+	if team, err := d.Team(ctx, teamID); err != nil || team != nil {
+		t.Errorf("Team(%d) after TeamDelete returned %+v, %v", teamID, team, err)
+	}
+	if memberships, err := d.UsersTeams(ctx, owner.ID); err != nil || len(memberships) != 0 {
+		t.Errorf("UsersTeams after TeamDelete returned %+v, %v", memberships, err)
+	}
+	if got, err := d.Filter(ctx, filterID); err != nil || got != nil {
+		t.Errorf("Filter(%d) after TeamDelete returned %+v, %v", filterID, got, err)
+	}
+}
+
+func testMutes(t *testing.T, d db.DB) {
+	user, other := newUser(t, d, 1), newUser(t, d, 2)
+
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	for _, mute := range []db.Mute{
+		{UserID: user.ID, RepositoryID: 1, Repository: "golang/go"},
+		{UserID: user.ID, RepositoryID: 2, Repository: "golang/tools", Number: 5, ExpiresAt: &future},
+		{UserID: user.ID, RepositoryID: 3, Repository: "golang/net", ExpiresAt: &past},
+	} {
+		mute := mute
+		_, err := d.MuteCreate(ctx, &mute)
+		check(t, err)
+	}
+
+	mutes, err := d.UsersMutes(ctx, user.ID)
+	check(t, err)
+	if len(mutes) != 2 {
+		t.Fatalf("UsersMutes returned %+v, want the 2 mutes that haven't expired", mutes)
+	}
+	for _, mute := range mutes {
+		if mute.RepositoryID == 2 && (mute.Number != 5 || mute.Repository != "golang/tools" || mute.ExpiresAt == nil || !closeTo(*mute.ExpiresAt, future)) {
+			t.Errorf("UsersMutes returned %+v, want number 5 expiring at %v", mute, future)
+		}
+	}
+	if mutes, err := d.UsersMutes(ctx, other.ID); err != nil || len(mutes) != 0 {
+		t.Errorf("UsersMutes for another user returned %+v, %v", mutes, err)
+	}
+
+	check(t, d.MuteDelete(ctx, other.ID, mutes[0].ID))
+	if mutes, err := d.UsersMutes(ctx, user.ID); err != nil || len(mutes) != 2 {
+		t.Errorf("UsersMutes after another user's MuteDelete returned %+v, %v", mutes, err)
+	}
+	check(t, d.MuteDelete(ctx, user.ID, mutes[0].ID))
+	if mutes, err := d.UsersMutes(ctx, user.ID); err != nil || len(mutes) != 1 {
+		t.Errorf("UsersMutes after MuteDelete returned %+v, %v", mutes, err)
+	}
+}
+
+func testSubscriptions(t *testing.T, d db.DB) {
+	user, other := newUser(t, d, 1), newUser(t, d, 2)
+
+	repo := &db.Subscription{UserID: user.ID, Kind: db.SubscriptionRepository, Name: "golang/go"}
+	repoID, err := d.SubscriptionCreate(ctx, repo)
+	check(t, err)
+	org := &db.Subscription{UserID: user.ID, Kind: db.SubscriptionOrganization, Name: "golang"}
+	orgID, err := d.SubscriptionCreate(ctx, org)
+	check(t, err)
+	otherRepo := &db.Subscription{UserID: other.ID, Kind: db.SubscriptionRepository, Name: "golang/go"}
+	_, err = d.SubscriptionCreate(ctx, otherRepo)
+	check(t, err)
+	if otherRepo.FeedID != repo.FeedID {
+		t.Errorf("subscriptions to the same repository have feeds %d and %d, want the same feed", repo.FeedID, otherRepo.FeedID)
+	}
+
+	if _, err := d.SubscriptionCreate(ctx, &db.Subscription{UserID: user.ID, Kind: db.SubscriptionRepository, Name: "golang/go"}); err == nil {
+		t.Errorf("SubscriptionCreate for an existing subscription returned nil error")
+	}
+
+	subscriptions, err := d.UsersSubscriptions(ctx, user.ID)
+	check(t, err)
+	if len(subscriptions) != 2 || subscriptions[0].ID != orgID || subscriptions[1].ID != repoID || subscriptions[1].FeedID != repo.FeedID {
+		t.Fatalf("UsersSubscriptions returned %+v, want subscriptions %d and %d ordered by kind", subscriptions, orgID, repoID)
+	}
+	if subscriptions[1].EventLastCreatedAt != nil {
+		t.Errorf("subscription's EventLastCreatedAt is %v before its feed was polled, want nil", subscriptions[1].EventLastCreatedAt)
+	}
+
+	feeds, err := d.SubscriptionFeedsDue(ctx)
+	check(t, err)
+	if len(feeds) != 2 {
+		t.Fatalf("SubscriptionFeedsDue returned %+v, want 2 feeds", feeds)
+	}
+	for _, feed := range feeds {
+		if feed.ID == repo.FeedID && (feed.GitHubHost != ghhost.GitHubCom || feed.Kind != db.SubscriptionRepository || feed.Name != "golang/go") {
+			t.Errorf("SubscriptionFeedsDue returned %+v, want the golang/go repository on %s", feed, ghhost.GitHubCom)
+		}
+	}
+
+	subscriptions, err = d.SubscriptionFeedsSubscriptions(ctx, repo.FeedID)
+	check(t, err)
+	if len(subscriptions) != 2 {
+		t.Errorf("SubscriptionFeedsSubscriptions returned %+v, want 2 subscriptions", subscriptions)
+	}
+
+	lastCreatedAt := time.Now().Add(-time.Minute)
+	check(t, d.SetSubscriptionFeedPollResult(ctx, repo.FeedID, lastCreatedAt, time.Now().Add(time.Hour)))
+	feeds, err = d.SubscriptionFeedsDue(ctx)
+	check(t, err)
+	if len(feeds) != 1 || feeds[0].ID != org.FeedID {
+		t.Errorf("SubscriptionFeedsDue after SetSubscriptionFeedPollResult returned %+v, want feed %d", feeds, org.FeedID)
+	}
+	subscriptions, err = d.UsersSubscriptions(ctx, other.ID)
+	check(t, err)
+	if len(subscriptions) != 1 || subscriptions[0].EventLastCreatedAt == nil || !closeTo(*subscriptions[0].EventLastCreatedAt, lastCreatedAt) {
+		t.Errorf("UsersSubscriptions returned %+v, want the feed's EventLastCreatedAt %v", subscriptions, lastCreatedAt)
+	}
+
+	check(t, d.SubscriptionDelete(ctx, other.ID, orgID))
+	if subscriptions, err := d.UsersSubscriptions(ctx, user.ID); err != nil || len(subscriptions) != 2 {
+		t.Errorf("UsersSubscriptions after another user's SubscriptionDelete returned %+v, %v", subscriptions, err)
+	}
+
+	// Feeds without subscriptions are not polled.
+	check(t, d.SubscriptionDelete(ctx, user.ID, orgID))
+	if feeds, err := d.SubscriptionFeedsDue(ctx); err != nil || len(feeds) != 0 {
+		t.Errorf("SubscriptionFeedsDue after SubscriptionDelete returned %+v, %v", feeds, err)
+	}
+}
+
+func testHeldNotifications(t *testing.T, d db.DB) {
+	user := newUser(t, d, 1)
+
+	now := time.Now()
+	for _, held := range []db.HeldNotification{
+		{UserID: user.ID, Event: []byte(`{"id":"1"}`), Priority: 1, Tag: "ci", ChannelsRaw: "email", DeliverAt: now.Add(-time.Minute)},
+		{UserID: user.ID, Event: []byte(`{"id":"2"}`), DeliverAt: now.Add(time.Hour)},
+	} {
+		held := held
+		check(t, d.HeldNotificationCreate(ctx, &held))
+	}
+
+	due, err := d.HeldNotificationsDue(ctx, user.ID, now)
+	check(t, err)
+	if len(due) != 1 || string(due[0].Event) != `{"id":"1"}` || due[0].Priority != 1 || due[0].Tag != "ci" || due[0].ChannelsRaw != "email" {
+		t.Fatalf("HeldNotificationsDue returned %+v, want the first notification", due)
+	}
+
+	later, err := d.HeldNotificationsDue(ctx, user.ID, now.Add(2*time.Hour))
+	check(t, err)
+	if len(later) != 2 || later[0].ID != due[0].ID {
+		t.Fatalf("HeldNotificationsDue returned %+v, want both notifications in the order they were held", later)
+	}
+
+	check(t, d.HeldNotificationsDelete(ctx, user.ID, nil))
+	check(t, d.HeldNotificationsDelete(ctx, user.ID, []int{due[0].ID}))
+	remaining, err := d.HeldNotificationsDue(ctx, user.ID, now.Add(2*time.Hour))
+	check(t, err)
+	if len(remaining) != 1 || remaining[0].ID != later[1].ID {
+		t.Errorf("HeldNotificationsDue after HeldNotificationsDelete returned %+v, want notification %d", remaining, later[1].ID)
+	}
+}
+
+func testNotificationChannels(t *testing.T, d db.DB) {
+	user, other := newUser(t, d, 1), newUser(t, d, 2)
+
+	for _, channel := range []db.NotificationChannel{
+		{UserID: user.ID, Name: "slack", Type: db.ChannelTypeSlack, Target: "https://hooks.slack.com/services/x", VerifyToken: "verify-slack"},
+		{UserID: user.ID, Name: "email", Type: db.ChannelTypeEmail, Target: "a@example.com", VerifyToken: "verify-email"},
+	} {
+		channel := channel
+		_, err := d.NotificationChannelCreate(ctx, &channel)
+		check(t, err)
+	}
+	if _, err := d.NotificationChannelCreate(ctx, &db.NotificationChannel{UserID: user.ID, Name: "email", Type: db.ChannelTypeEmail, Target: "b@example.com", VerifyToken: "verify-email2"}); err == nil {
+		t.Errorf("NotificationChannelCreate with an existing name returned nil error")
+	}
+
+	channels, err := d.UsersNotificationChannels(ctx, user.ID)
+	check(t, err)
+	if len(channels) != 2 || channels[0].Name != "email" || channels[1].Name != "slack" || channels[0].Target != "a@example.com" {
+		t.Fatalf("UsersNotificationChannels returned %+v, want the email and slack channels ordered by name", channels)
+	}
+	if channels[0].Verified() {
+		t.Errorf("new channel is verified")
+	}
+
+	for _, test := range []struct {
+		userID int
+		token  string
+		want   bool
+	}{
+		{other.ID, "verify-email", false},
+		{user.ID, "verify-email", true},
+		{user.ID, "verify-email", false}, // already verified
+	} {
+		verified, err := d.NotificationChannelVerify(ctx, test.userID, test.token)
+		check(t, err)
+		if verified != test.want {
+			t.Errorf("NotificationChannelVerify(%d, %q) returned %v, want %v", test.userID, test.token, verified, test.want)
+		}
+	}
+	channels, err = d.UsersNotificationChannels(ctx, user.ID)
+	check(t, err)
+	if !channels[0].Verified() || channels[1].Verified() {
+		t.Errorf("UsersNotificationChannels returned %+v, want only the email channel verified", channels)
+	}
+
+	check(t, d.NotificationChannelDelete(ctx, other.ID, channels[0].ID))
+	if channels, err := d.UsersNotificationChannels(ctx, user.ID); err != nil || len(channels) != 2 {
+		t.Errorf("UsersNotificationChannels after another user's NotificationChannelDelete returned %+v, %v", channels, err)
+	}
+	check(t, d.NotificationChannelDelete(ctx, user.ID, channels[0].ID))
+	if channels, err := d.UsersNotificationChannels(ctx, user.ID); err != nil || len(channels) != 1 {
+		t.Errorf("UsersNotificationChannels after NotificationChannelDelete returned %+v, %v", channels, err)
+	}
+}
+
+func testEvents(t *testing.T, d db.DB) {
+	user, other, none := newUser(t, d, 1), newUser(t, d, 2), newUser(t, d, 3)
+
+	created := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	events := []db.Event{
+		{UserID: user.ID, DedupKey: "1", CreatedAt: created, Type: "PushEvent", Repository: "golang/go", RepositoryID: 1, Actor: "alice", Title: "pushed to master", Body: "commit"},
+		{UserID: user.ID, DedupKey: "2", CreatedAt: created.Add(time.Minute), Type: "IssuesEvent", Repository: "golang/go", RepositoryID: 1, Number: 5, Actor: "bob", Title: "opened flaky test", Body: "the test is flaky", Priority: 1, Tag: "tests"},
+		{UserID: user.ID, DedupKey: "3", CreatedAt: created.Add(2 * time.Minute), Type: "IssuesEvent", Repository: "golang/tools", RepositoryID: 2, Number: 6, Actor: "bob", Title: "closed issue", Discarded: true},
+		{UserID: other.ID, DedupKey: "1", CreatedAt: created, Type: "PushEvent", Repository: "golang/go", RepositoryID: 1, Actor: "alice", Title: "pushed to master"},
+		{UserID: user.ID, DedupKey: "1", CreatedAt: created, Type: "PushEvent", Repository: "golang/go", RepositoryID: 1, Actor: "alice", Title: "duplicate"},
+	}
+	inserted, err := d.EventsCreate(ctx, events)
+	check(t, err)
+	if want := []bool{true, true, true, true, false}; !reflect.DeepEqual(inserted, want) {
+		t.Errorf("EventsCreate returned %v, want %v", inserted, want)
+	}
+	inserted, err = d.EventsCreate(ctx, events[1:2])
+	check(t, err)
+	if want := []bool{false}; !reflect.DeepEqual(inserted, want) {
+		t.Errorf("EventsCreate for a stored event returned %v, want %v", inserted, want)
+	}
+
+	stored, err := d.UsersEvents(ctx, user.ID, db.EventQuery{})
+	check(t, err)
+	if want := []string{"closed issue", "opened flaky test", "pushed to master"}; !reflect.DeepEqual(titles(stored), want) {
+		t.Fatalf("UsersEvents returned %q, want %q", titles(stored), want)
+	}
+	if e := stored[1]; e.UserID != user.ID || !closeTo(e.CreatedAt, events[1].CreatedAt) || e.Type != "IssuesEvent" || e.Repository != "golang/go" ||
+		e.RepositoryID != 1 || e.Number != 5 || e.Actor != "bob" || e.Body != "the test is flaky" || e.Priority != 1 || e.Tag != "tests" ||
+		e.Discarded || e.ReadAt != nil || e.Archived || e.Starred {
+		t.Errorf("UsersEvents returned %+v, want %+v", e, events[1])
+	}
+	closedID, flakyID, pushedID := stored[0].ID, stored[1].ID, stored[2].ID
+
+	for _, test := range []struct {
+		query db.EventQuery
+		want  []string
+	}{
+		{db.EventQuery{Repository: "golang/go"}, []string{"opened flaky test", "pushed to master"}},
+		{db.EventQuery{Type: "IssuesEvent"}, []string{"closed issue", "opened flaky test"}},
+		{db.EventQuery{Actor: "alice"}, []string{"pushed to master"}},
+		{db.EventQuery{Tag: "tests"}, []string{"opened flaky test"}},
+		{db.EventQuery{Search: "flaky"}, []string{"opened flaky test"}},
+		{db.EventQuery{Status: db.EventStatusAccepted}, []string{"opened flaky test", "pushed to master"}},
+		{db.EventQuery{Status: db.EventStatusDiscarded}, []string{"closed issue"}},
+		{db.EventQuery{Folder: db.EventFolderInbox}, []string{"opened flaky test", "pushed to master"}},
+		{db.EventQuery{Type: "IssuesEvent", Status: db.EventStatusAccepted}, []string{"opened flaky test"}},
+		{db.EventQuery{PerPage: 1, Page: 2}, []string{"opened flaky test"}},
+		{db.EventQuery{PerPage: 2, Page: 3}, nil},
+	} {
+		events, err := d.UsersEvents(ctx, user.ID, test.query)
+		check(t, err)
+		if got := titles(events); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("UsersEvents(%+v) returned %q, want %q", test.query, got, test.want)
+		}
+	}
+
+	facets, err := d.UsersEventFacets(ctx, user.ID, db.EventQuery{})
+	check(t, err)
+	want := &db.EventFacets{
+		Repositories: []db.EventFacet{{Value: "golang/go", Count: 2}, {Value: "golang/tools", Count: 1}},
+		Types:        []db.EventFacet{{Value: "IssuesEvent", Count: 2}, {Value: "PushEvent", Count: 1}},
+		Actors:       []db.EventFacet{{Value: "bob", Count: 2}, {Value: "alice", Count: 1}},
+		Statuses:     []db.EventFacet{{Value: db.EventStatusAccepted, Count: 2}, {Value: db.EventStatusDiscarded, Count: 1}},
+	}
+	if !reflect.DeepEqual(facets, want) {
+		t.Errorf("UsersEventFacets returned %+v, want %+v", facets, want)
+	}
+
+	otherEvents, err := d.UsersEvents(ctx, other.ID, db.EventQuery{})
+	check(t, err)
+	if len(otherEvents) != 1 {
+		t.Fatalf("UsersEvents for another user returned %q, want their event", titles(otherEvents))
+	}
+	byID, err := d.UsersEventsByID(ctx, user.ID, []int{flakyID, otherEvents[0].ID})
+	check(t, err)
+	if len(byID) != 1 || byID[0].ID != flakyID {
+		t.Errorf("UsersEventsByID returned %q, want only the user's event", titles(byID))
+	}
+
+	after, err := d.UsersEventsAfter(ctx, user.ID, 0)
+	check(t, err)
+	if want := []string{"pushed to master", "opened flaky test"}; !reflect.DeepEqual(titles(after), want) {
+		t.Errorf("UsersEventsAfter returned %q, want accepted events oldest first %q", titles(after), want)
+	}
+	after, err = d.UsersEventsAfter(ctx, user.ID, pushedID)
+	check(t, err)
+	if len(after) != 1 || after[0].ID != flakyID {
+		t.Errorf("UsersEventsAfter(%d) returned %q, want the newer event", pushedID, titles(after))
+	}
+
+	for userID, want := range map[int]int{user.ID: closedID, none.ID: 0} {
+		latest, err := d.UsersLatestEventID(ctx, userID)
+		check(t, err)
+		if latest != want {
+			t.Errorf("UsersLatestEventID(%d) returned %d, want %d", userID, latest, want)
+		}
+	}
+
+	unread := func(want int) {
+		t.Helper()
+		count, err := d.UsersUnreadCount(ctx, user.ID)
+		check(t, err)
+		if count != want {
+			t.Errorf("UsersUnreadCount returned %d, want %d", count, want)
+		}
+	}
+	folder := func(folder string, want ...string) {
+		t.Helper()
+		events, err := d.UsersEvents(ctx, user.ID, db.EventQuery{Folder: folder})
+		check(t, err)
+		if got := titles(events); !reflect.DeepEqual(got, want) && len(got)+len(want) > 0 {
+			t.Errorf("UsersEvents in folder %q returned %q, want %q", folder, got, want)
+		}
+	}
+
+	unread(2)
+	check(t, d.EventsMarkRead(ctx, user.ID, []int{pushedID}, true))
+	unread(1)
+	folder(db.EventFolderUnread, "opened flaky test")
+	check(t, d.EventsMarkRead(ctx, user.ID, []int{pushedID}, false))
+	unread(2)
+	check(t, d.EventsMarkRead(ctx, other.ID, []int{flakyID}, true))
+	unread(2)
+	check(t, d.EventsMarkRead(ctx, user.ID, nil, true))
+	unread(2)
+	check(t, d.EventsMarkRepositoryRead(ctx, user.ID, "golang/go"))
+	unread(0)
+	check(t, d.EventsMarkRead(ctx, user.ID, []int{pushedID, flakyID}, false))
+	unread(2)
+
+	// Archiving an event also marks it read.
+	check(t, d.EventArchive(ctx, user.ID, flakyID, true))
+	folder(db.EventFolderInbox, "pushed to master")
+	folder(db.EventFolderArchived, "opened flaky test")
+	unread(1)
+	check(t, d.EventArchive(ctx, user.ID, flakyID, false))
+	folder(db.EventFolderInbox, "opened flaky test", "pushed to master")
+	folder(db.EventFolderArchived)
+	unread(1)
+
+	check(t, d.EventStar(ctx, user.ID, pushedID, true))
+	folder(db.EventFolderStarred, "pushed to master")
+	check(t, d.EventStar(ctx, other.ID, flakyID, true))
+	folder(db.EventFolderStarred, "pushed to master")
+	check(t, d.EventStar(ctx, user.ID, pushedID, false))
+	folder(db.EventFolderStarred)
+}
+
+func testAPITokens(t *testing.T, d db.DB) {
+	user, other := newUser(t, d, 1), newUser(t, d, 2)
+
+	hash := strings.Repeat("a", 64)
+	tokenID, err := d.APITokenCreate(ctx, &db.APIToken{UserID: user.ID, Name: "ci", Scope: db.APITokenScopeRead, TokenHash: hash})
+	check(t, err)
+	if _, err := d.APITokenCreate(ctx, &db.APIToken{UserID: other.ID, Name: "ci", Scope: db.APITokenScopeRead, TokenHash: hash}); err == nil {
+		t.Errorf("APITokenCreate with an existing hash returned nil error")
+	}
+
+	token, err := d.APITokenByHash(ctx, hash)
+	check(t, err)
+	if token == nil || token.ID != tokenID || token.UserID != user.ID || token.Name != "ci" || token.Scope != db.APITokenScopeRead || token.LastUsedAt != nil {
+		t.Fatalf("APITokenByHash returned %+v, want token %d", token, tokenID)
+	}
+	if token, err := d.APITokenByHash(ctx, strings.Repeat("b", 64)); err != nil || token != nil {
+		t.Errorf("APITokenByHash for a missing hash returned %+v, %v", token, err)
+	}
+
+	usedAt := time.Now()
+	check(t, d.APITokenUsed(ctx, tokenID, usedAt))
+	tokens, err := d.UsersAPITokens(ctx, user.ID)
+	check(t, err)
+	if len(tokens) != 1 || tokens[0].ID != tokenID || tokens[0].LastUsedAt == nil || !closeTo(*tokens[0].LastUsedAt, usedAt) {
+		t.Errorf("UsersAPITokens returned %+v, want token %d last used at %v", tokens, tokenID, usedAt)
+	}
+
+	check(t, d.APITokenDelete(ctx, other.ID, tokenID))
+	if token, err := d.APITokenByHash(ctx, hash); err != nil || token == nil {
+		t.Fatalf("APITokenByHash after another user's APITokenDelete returned %+v, %v", token, err)
+	}
+	check(t, d.APITokenDelete(ctx, user.ID, tokenID))
+	if token, err := d.APITokenByHash(ctx, hash); err != nil || token != nil {
+		t.Errorf("APITokenByHash after APITokenDelete returned %+v, %v", token, err)
+	}
+}
+
+func testInstallations(t *testing.T, d db.DB) {
+	installation := &db.Installation{ID: 100, AccountID: 200, AccountLogin: "golang", SenderGitHubID: 1}
+	check(t, d.InstallationCreate(ctx, installation))
+	got, err := d.Installation(ctx, 100)
+	check(t, err)
+	if got == nil || got.ID != 100 || got.AccountID != 200 || got.AccountLogin != "golang" || got.SenderGitHubID != 1 {
+		t.Fatalf("Installation returned %+v, want %+v", got, installation)
+	}
+	if got, err := d.Installation(ctx, 101); err != nil || got != nil {
+		t.Errorf("Installation for a missing installation returned %+v, %v", got, err)
+	}
+
+	// Creating an existing installation updates its login.
+	installation.AccountLogin = "golang-renamed"
+	check(t, d.InstallationCreate(ctx, installation))
+	if got, err := d.Installation(ctx, 100); err != nil || got == nil || got.AccountLogin != "golang-renamed" {
+		t.Errorf("Installation after renaming returned %+v, %v", got, err)
+	}
+
+	repos := []db.InstallationRepository{
+		{InstallationID: 100, RepositoryID: 1, FullName: "golang/go"},
+		{InstallationID: 100, RepositoryID: 2, FullName: "golang/tools"},
+	}
+	check(t, d.InstallationRepositoriesCreate(ctx, repos))
+	check(t, d.InstallationRepositoriesCreate(ctx, []db.InstallationRepository{{InstallationID: 100, RepositoryID: 1, FullName: "golang/go2"}}))
+
+	due, err := d.InstallationRepositoriesDue(ctx)
+	check(t, err)
+	if len(due) != 2 {
+		t.Fatalf("InstallationRepositoriesDue returned %+v, want 2 repositories", due)
+	}
+	for _, repo := range due {
+		if repo.RepositoryID == 1 && repo.FullName != "golang/go2" {
+			t.Errorf("InstallationRepositoriesDue returned %+v, want the renamed repository", repo)
+		}
+	}
+
+	check(t, d.SetInstallationRepositoryPollResult(ctx, 100, 1, time.Now(), time.Now().Add(time.Hour)))
+	due, err = d.InstallationRepositoriesDue(ctx)
+	check(t, err)
+	if len(due) != 1 || due[0].RepositoryID != 2 {
+		t.Errorf("InstallationRepositoriesDue after SetInstallationRepositoryPollResult returned %+v, want repository 2", due)
+	}
+
+	check(t, d.InstallationRepositoriesDelete(ctx, 100, nil))
+	check(t, d.InstallationRepositoriesDelete(ctx, 100, []int{2}))
+	if due, err := d.InstallationRepositoriesDue(ctx); err != nil || len(due) != 0 {
+		t.Errorf("InstallationRepositoriesDue after InstallationRepositoriesDelete returned %+v, %v", due, err)
+	}
+
+	check(t, d.InstallationRepositoriesCreate(ctx, repos[1:]))
+	check(t, d.InstallationDelete(ctx, 100))
+	if got, err := d.Installation(ctx, 100); err != nil || got != nil {
+		t.Errorf("Installation after InstallationDelete returned %+v, %v", got, err)
+	}
+	if due, err := d.InstallationRepositoriesDue(ctx); err != nil || len(due) != 0 {
+		t.Errorf("InstallationRepositoriesDue after InstallationDelete returned %+v, %v", due, err)
+	}
+}
+
+func testAdminUsers(t *testing.T, d db.DB) {
+	user, other := newUser(t, d, 1), newUser(t, d, 2)
+
+	long := strings.Repeat("x", 2000)
+	check(t, d.DeliveryFailureCreate(ctx, &db.DeliveryFailure{UserID: user.ID, Channel: "email", Error: "first"}))
+	check(t, d.DeliveryFailureCreate(ctx, &db.DeliveryFailure{UserID: user.ID, Channel: "slack", Error: long}))
+
+	users, err := d.AdminUsers(ctx, time.Now().Add(-time.Hour))
+	check(t, err)
+	if len(users) != 2 || users[0].ID != user.ID || users[1].ID != other.ID {
+		t.Fatalf("AdminUsers returned %+v, want users %d and %d", users, user.ID, other.ID)
+	}
+	switch {
+	case users[0].DeliveryFailures != 2:
+		t.Errorf("user's DeliveryFailures is %d, want 2", users[0].DeliveryFailures)
+	case users[0].LastDeliveryFailureAt == nil || !closeTo(*users[0].LastDeliveryFailureAt, time.Now()):
+		t.Errorf("user's LastDeliveryFailureAt is %v, want now", users[0].LastDeliveryFailureAt)
+	case users[0].LastDeliveryFailureReason != long[:1024]:
+		t.Errorf("user's LastDeliveryFailureReason is %q, want the latest error truncated to 1024", users[0].LastDeliveryFailureReason)
+	case users[0].GitHubToken == nil:
+		t.Errorf("user's GitHubToken is nil")
+	case users[1].DeliveryFailures != 0 || users[1].LastDeliveryFailureAt != nil || users[1].LastDeliveryFailureReason != "":
+		t.Errorf("AdminUsers returned %+v, want no delivery failures", users[1])
+	}
+
+	users, err = d.AdminUsers(ctx, time.Now().Add(time.Hour))
+	check(t, err)
+	if len(users) != 2 || users[0].DeliveryFailures != 0 || users[0].LastDeliveryFailureAt != nil {
+		t.Errorf("AdminUsers returned %+v, want no failures since an hour from now", users)
+	}
+
+	check(t, d.UserPollPausedUpdate(ctx, user.ID, true))
+	users, err = d.AdminUsers(ctx, time.Now())
+	check(t, err)
+	if len(users) != 2 || !users[0].PollPaused {
+		t.Errorf("AdminUsers returned %+v, want all users including the paused user", users)
+	}
+}
+
+func testUserDelete(t *testing.T, d db.DB) {
+	user, other := newUser(t, d, 1), newUser(t, d, 2)
+
+	soleTeamID, err := d.TeamCreate(ctx, &db.Team{Name: "sole"}, user.ID)
+	check(t, err)
+	sharedTeamID, err := d.TeamCreate(ctx, &db.Team{Name: "shared"}, user.ID)
+	check(t, err)
+	check(t, d.TeamMembershipCreate(ctx, &db.TeamMembership{TeamID: sharedTeamID, UserID: other.ID, Role: db.TeamRoleOwner}))
+	othersTeamID, err := d.TeamCreate(ctx, &db.Team{Name: "other's"}, other.ID)
+	check(t, err)
+	check(t, d.TeamMembershipCreate(ctx, &db.TeamMembership{TeamID: othersTeamID, UserID: user.ID, Role: db.TeamRoleMember}))
+
+	filterID, err := d.FilterCreate(ctx, &db.Filter{UserID: user.ID})
+	check(t, err)
+	conditionID, err := d.ConditionCreate(ctx, &db.Condition{FilterID: filterID, Type: "PushEvent"})
+	check(t, err)
+	teamFilterID, err := d.FilterCreate(ctx, &db.Filter{TeamID: soleTeamID})
+	check(t, err)
+	_, err = d.EventsCreate(ctx, []db.Event{
+		{UserID: user.ID, DedupKey: "1", CreatedAt: time.Now(), Type: "PushEvent"},
+		{UserID: other.ID, DedupKey: "1", CreatedAt: time.Now(), Type: "PushEvent"},
+	})
+	check(t, err)
+	hash := strings.Repeat("a", 64)
+	_, err = d.APITokenCreate(ctx, &db.APIToken{UserID: user.ID, Scope: db.APITokenScopeRead, TokenHash: hash})
+	check(t, err)
+	_, err = d.MuteCreate(ctx, &db.Mute{UserID: user.ID, RepositoryID: 1})
+	check(t, err)
+	_, err = d.SubscriptionCreate(ctx, &db.Subscription{UserID: user.ID, Kind: db.SubscriptionRepository, Name: "golang/go"})
+	check(t, err)
+	_, err = d.NotificationChannelCreate(ctx, &db.NotificationChannel{UserID: user.ID, Name: "email", Type: db.ChannelTypeEmail, Target: "a@example.com", VerifyToken: "verify"})
+	check(t, err)
+	check(t, d.HeldNotificationCreate(ctx, &db.HeldNotification{UserID: user.ID, Event: []byte("{}"), DeliverAt: time.Now()}))
+	check(t, d.DeliveryFailureCreate(ctx, &db.DeliveryFailure{UserID: user.ID, Channel: "email", Error: "failed"}))
+
+	check(t, d.UserDelete(ctx, user.ID))
+
+	if got, err := d.User(ctx, user.ID); err != nil || got != nil {
+		t.Errorf("User after UserDelete returned %+v, %v", got, err)
+	}
+	for teamID, exists := range map[int]bool{soleTeamID: false, sharedTeamID: true, othersTeamID: true} {
+		team, err := d.Team(ctx, teamID)
+		check(t, err)
+		if (team != nil) != exists {
+			t.Errorf("Team(%d) after UserDelete returned %+v, want exists %v", teamID, team, exists)
+		}
+		if !exists {
+			continue
+		}
+		memberships, err := d.TeamsMemberships(ctx, teamID)
+		check(t, err)
+		if len(memberships) != 1 || memberships[0].UserID != other.ID {
+			t.Errorf("TeamsMemberships(%d) after UserDelete returned %+v, want only user %d", teamID, memberships, other.ID)
+		}
+	}
+	for _, id := range []int{filterID, teamFilterID} {
+		if got, err := d.Filter(ctx, id); err != nil || got != nil {
+			t.Errorf("Filter(%d) after UserDelete returned %+v, %v", id, got, err)
+		}
+	}
+	if got, err := d.Condition(ctx, conditionID); err != nil || got != nil {
+		t.Errorf("Condition after UserDelete returned %+v, %v", got, err)
+	}
+	if got, err := d.APITokenByHash(ctx, hash); err != nil || got != nil {
+		t.Errorf("APITokenByHash after UserDelete returned %+v, %v", got, err)
+	}
+
+	for name, count := range map[string]func() (int, error){
+		"UsersEvents": func() (int, error) {
+			events, err := d.UsersEvents(ctx, user.ID, db.EventQuery{})
+			return len(events), err
+		},
+		"UsersMutes": func() (int, error) {
+			mutes, err := d.UsersMutes(ctx, user.ID)
+			return len(mutes), err
+		},
+		"UsersSubscriptions": func() (int, error) {
+			subscriptions, err := d.UsersSubscriptions(ctx, user.ID)
+			return len(subscriptions), err
+		},
+		"UsersNotificationChannels": func() (int, error) {
+			channels, err := d.UsersNotificationChannels(ctx, user.ID)
+			return len(channels), err
+		},
+		"HeldNotificationsDue": func() (int, error) {
+			held, err := d.HeldNotificationsDue(ctx, user.ID, time.Now().Add(time.Hour))
+			return len(held), err
+		},
+		"SubscriptionFeedsDue": func() (int, error) {
+			feeds, err := d.SubscriptionFeedsDue(ctx)
+			return len(feeds), err
+		},
+	} {
+		n, err := count()
+		check(t, err)
+		if n != 0 {
+			t.Errorf("%s after UserDelete returned %d results, want none", name, n)
+		}
+	}
+
+	if events, err := d.UsersEvents(ctx, other.ID, db.EventQuery{}); err != nil || len(events) != 1 {
+		t.Errorf("UsersEvents for another user after UserDelete returned %q, %v", titles(events), err)
+	}
+	users, err := d.AdminUsers(ctx, time.Now().Add(-time.Hour))
+	check(t, err)
+	if len(users) != 1 || users[0].ID != other.ID || users[0].DeliveryFailures != 0 {
+		t.Errorf("AdminUsers after UserDelete returned %+v, want only user %d", users, other.ID)
+	}
+}
+
+func testConcurrency(t *testing.T, d db.DB) {
+	const n = 10
+
+	var (
+		wg      sync.WaitGroup
+		userIDs = make([]int, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			login := fmt.Sprintf("user%d", i)
+			userID, err := d.GitHubLogin(ctx, ghhost.GitHubCom, login+"@example.com", i+1, login, &oauth2.Token{AccessToken: "token"})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			userIDs[i] = userID
+		}(i)
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	seen := make(map[int]bool)
+	for _, userID := range userIDs {
+		if seen[userID] {
+			t.Fatalf("concurrent GitHubLogin returned duplicate userID %d", userID)
+		}
+		seen[userID] = true
+	}
+
+	userID := userIDs[0]
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			inserted, err := d.EventsCreate(ctx, []db.Event{{UserID: userID, DedupKey: fmt.Sprint(i), CreatedAt: time.Now(), Type: "PushEvent"}})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(inserted) != 1 || !inserted[0] {
+				t.Errorf("EventsCreate returned %v, want the event inserted", inserted)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := d.UsersEvents(ctx, userID, db.EventQuery{}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	count, err := d.UsersUnreadCount(ctx, userID)
+	check(t, err)
+	if count != n {
+		t.Errorf("UsersUnreadCount after concurrent EventsCreate returned %d, want %d", count, n)
+	}
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Drivers supported by SQLDB, each uses the migrations in the directory of
+// the same name.
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite3"
+)
+
+// rebindDB is a sqlx.DB that rebinds queries written with ? placeholders to
+// the driver's placeholders, such as $1 for PostgreSQL. Named queries are
+// already bound for the driver by sqlx.
+type rebindDB struct {
+	*sqlx.DB
+}
+
+func (db rebindDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.ExecContext(ctx, db.Rebind(query), args...)
+}
+
+func (db rebindDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRowContext(ctx, db.Rebind(query), args...)
+}
+
+func (db rebindDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return db.DB.GetContext(ctx, dest, db.Rebind(query), args...)
+}
+
+func (db rebindDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return db.DB.SelectContext(ctx, dest, db.Rebind(query), args...)
+}
+
+func (db rebindDB) Beginx() (rebindTx, error) {
+	tx, err := db.DB.Beginx()
+	return rebindTx{tx}, err
+}
+
+// rebindTx is a sqlx.Tx that rebinds queries like rebindDB.
+type rebindTx struct {
+	*sqlx.Tx
+}
+
+func (tx rebindTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, tx.Rebind(query), args...)
+}
+
+func (tx rebindTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, tx.Rebind(query), args...)
+}
+
+// execer executes queries on a rebindDB or rebindTx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// insert executes an INSERT query and returns the new row's id. PostgreSQL
+// doesn't support LastInsertId, so the id is returned using RETURNING.
+func (db *SQLDB) insert(ctx context.Context, e execer, query string, args ...interface{}) (int, error) {
+	if db.sqlx.DriverName() == DriverPostgres {
+		var id int
+		err := e.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := e.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// insertNamed is insert for a query with named parameters from arg.
+func (db *SQLDB) insertNamed(ctx context.Context, e execer, query string, arg interface{}) (int, error) {
+	query, args, err := sqlx.Named(query, arg)
+	if err != nil {
+		return 0, err
+	}
+	return db.insert(ctx, e, query, args...)
+}
+
+// onConflictIgnore returns the clause appended to an INSERT to ignore rows
+// that conflict with the unique key of columns, such as "user_id, name". No
+// rows are affected when a row is ignored.
+func (db *SQLDB) onConflictIgnore(columns string) string {
+	if db.sqlx.DriverName() == DriverMySQL {
+		return "ON DUPLICATE KEY UPDATE id = id"
+	}
+	return "ON CONFLICT (" + columns + ") DO NOTHING"
+}
+
+// onConflictUpdate returns the clause appended to an INSERT to update the
+// existing row's update columns with the inserted values, when the row
+// conflicts with the unique key of columns.
+func (db *SQLDB) onConflictUpdate(columns string, update ...string) string {
+	var set []string
+	for _, column := range update {
+		if db.sqlx.DriverName() == DriverMySQL {
+			set = append(set, column+" = VALUES("+column+")")
+		} else {
+			set = append(set, column+" = excluded."+column)
+		}
+	}
+	if db.sqlx.DriverName() == DriverMySQL {
+		return "ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+	}
+	return "ON CONFLICT (" + columns + ") DO UPDATE SET " + strings.Join(set, ", ")
+}
+
+// eventsSearch returns the condition and its arguments matching events whose
+// title or body contains search. MySQL and PostgreSQL use their full-text
+// indexes, SQLite matches substrings.
+func (db *SQLDB) eventsSearch(search string) (string, []interface{}) {
+	switch db.sqlx.DriverName() {
+	case DriverMySQL:
+		return "MATCH (title, body) AGAINST (? IN BOOLEAN MODE)", []interface{}{search}
+	case DriverPostgres:
+		return "to_tsvector('simple', title || ' ' || body) @@ plainto_tsquery('simple', ?)", []interface{}{search}
+	}
+	like := "%" + search + "%"
+	return "(title LIKE ? OR body LIKE ?)", []interface{}{like, like}
+}
+
+// sqliteTimeLayouts are the layouts go-sqlite3 parses times with, the first is
+// the layout it stores a time.Time with and CURRENT_TIMESTAMP is stored as
+// "2006-01-02 15:04:05".
+var sqliteTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseTime parses a time selected into a string, such as an aggregate of a
+// time column. go-sqlite3 only parses the times of table columns, so an
+// aggregate is the time as stored by SQLite, the other drivers return a
+// time.Time which database/sql formats as RFC 3339.
+func (db *SQLDB) parseTime(value string) (time.Time, error) {
+	if db.sqlx.DriverName() != DriverSQLite {
+		return time.Parse(time.RFC3339Nano, value)
+	}
+	value = strings.TrimSuffix(value, "Z")
+	for _, layout := range sqliteTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("unknown time format %q", value)
+}
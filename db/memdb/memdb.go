@@ -0,0 +1,1665 @@
+// Package memdb is an in-memory implementation of db.DB, such as for testing
+// the poller and web console without a SQL database.
+package memdb
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradleyfalzon/maintainer.me/db"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// DB is an in-memory db.DB, it is safe for concurrent use. Like SQLDB, values
+// are copied in and out of the DB, deleting a row deletes the rows that
+// reference it and users' GitHub tokens are stored as JSON, but are not
+// encrypted.
+type DB struct {
+	mu  sync.Mutex
+	ids map[string]int // ids is the last ID used by each table.
+
+	users             []db.User
+	filters           []db.Filter // filters are stored without their Conditions.
+	conditions        []db.Condition
+	mutes             []db.Mute
+	teams             []db.Team
+	memberships       []db.TeamMembership
+	feeds             []db.SubscriptionFeed
+	subscriptions     []db.Subscription
+	held              []db.HeldNotification
+	channels          []db.NotificationChannel
+	events            []db.Event
+	apiTokens         []db.APIToken
+	installations     []db.Installation
+	installationRepos []db.InstallationRepository
+	deliveryFailures  []db.DeliveryFailure
+}
+
+var _ db.DB = &DB{}
+
+// New returns an empty DB.
+func New() *DB {
+	return &DB{ids: make(map[string]int)}
+}
+
+// nextID returns the next ID of a table, IDs start at 1 and are never reused.
+func (m *DB) nextID(table string) int {
+	m.ids[table]++
+	return m.ids[table]
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+// idSet returns the set of ids.
+func idSet(ids []int) map[int]bool {
+	set := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// user returns a copy of a stored user with their GitHubToken.
+func user(stored db.User) (*db.User, error) {
+	u := stored
+	u.GitHubTokenRaw = copyBytes(stored.GitHubTokenRaw)
+	u.PolledAt = copyTime(stored.PolledAt)
+	if err := json.Unmarshal(u.GitHubTokenRaw, &u.GitHubToken); err != nil {
+		return nil, errors.Wrapf(err, "could not unmarshal github token for userID %d", u.ID)
+	}
+	return &u, nil
+}
+
+// userWhere returns the first user matching match, or nil if no user matches.
+func (m *DB) userWhere(match func(db.User) bool) (*db.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if match(u) {
+			return user(u)
+		}
+	}
+	return nil, nil
+}
+
+// userExists returns true if a user with userID is stored, the caller must
+// hold m.mu.
+func (m *DB) userExists(userID int) bool {
+	for _, u := range m.users {
+		if u.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// updateUser calls update with the stored user, if the user exists.
+func (m *DB) updateUser(userID int, update func(*db.User)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			update(&m.users[i])
+		}
+	}
+}
+
+// Users implements the db.DB interface.
+func (m *DB) Users(ctx context.Context) ([]db.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var (
+		users []db.User
+		now   = time.Now()
+	)
+	for _, stored := range m.users {
+		if stored.EventNextPoll.After(now) || stored.PollPaused {
+			continue
+		}
+		u, err := user(stored)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, nil
+}
+
+// User implements the db.DB interface.
+func (m *DB) User(ctx context.Context, userID int) (*db.User, error) {
+	return m.userWhere(func(u db.User) bool {
+		return u.ID == userID
+	})
+}
+
+// UserByGitHubID implements the db.DB interface.
+func (m *DB) UserByGitHubID(ctx context.Context, githubHost string, githubID int) (*db.User, error) {
+	return m.userWhere(func(u db.User) bool {
+		return u.GitHubHost == githubHost && u.GitHubID == githubID
+	})
+}
+
+// UserByGitHubLogin implements the db.DB interface.
+func (m *DB) UserByGitHubLogin(ctx context.Context, githubHost, login string) (*db.User, error) {
+	return m.userWhere(func(u db.User) bool {
+		return u.GitHubHost == githubHost && u.GitHubLogin == login
+	})
+}
+
+// UserByFeedToken implements the db.DB interface.
+func (m *DB) UserByFeedToken(ctx context.Context, feedToken string) (*db.User, error) {
+	if feedToken == "" {
+		return nil, nil
+	}
+	return m.userWhere(func(u db.User) bool {
+		return u.FeedToken == feedToken
+	})
+}
+
+// UserFeedTokenUpdate implements the db.DB interface.
+func (m *DB) UserFeedTokenUpdate(ctx context.Context, userID int, feedToken string) error {
+	m.updateUser(userID, func(u *db.User) {
+		u.FeedToken = feedToken
+	})
+	return nil
+}
+
+// UserWebhookSecretUpdate implements the db.DB interface.
+func (m *DB) UserWebhookSecretUpdate(ctx context.Context, userID int, secret string) error {
+	m.updateUser(userID, func(u *db.User) {
+		u.WebhookSecret = secret
+	})
+	return nil
+}
+
+// UserNotificationsPausedUpdate implements the db.DB interface.
+func (m *DB) UserNotificationsPausedUpdate(ctx context.Context, userID int, paused bool) error {
+	m.updateUser(userID, func(u *db.User) {
+		if !paused && u.NotificationsPaused {
+			now := time.Now()
+			u.NotificationsSince, u.EventLastCreatedAt, u.EventNextPoll = now, now, now
+		}
+		u.NotificationsPaused = paused
+	})
+	return nil
+}
+
+// UserAdminUpdate grants or revokes a user's access to the admin console.
+// It's not part of the db.DB interface, as admins are set directly in the
+// database.
+func (m *DB) UserAdminUpdate(userID int, admin bool) {
+	m.updateUser(userID, func(u *db.User) {
+		u.Admin = admin
+	})
+}
+
+// UserDelete implements the db.DB interface.
+func (m *DB) UserDelete(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Teams without another owner would be left unmanageable.
+	owners := make(map[int]int)
+	for _, membership := range m.memberships {
+		if membership.Owner() && membership.UserID != userID {
+			owners[membership.TeamID]++
+		}
+	}
+	for _, membership := range m.teamMemberships(func(tm db.TeamMembership) bool { return tm.UserID == userID }) {
+		if membership.Owner() && owners[membership.TeamID] == 0 {
+			m.teamDelete(membership.TeamID)
+		}
+	}
+
+	m.filtersDelete(func(f db.Filter) bool {
+		return f.UserID != 0 && f.UserID == userID
+	})
+
+	users := m.users[:0]
+	for _, u := range m.users {
+		if u.ID != userID {
+			users = append(users, u)
+		}
+	}
+	m.users = users
+
+	memberships := m.memberships[:0]
+	for _, membership := range m.memberships {
+		if membership.UserID != userID {
+			memberships = append(memberships, membership)
+		}
+	}
+	m.memberships = memberships
+
+	mutes := m.mutes[:0]
+	for _, mute := range m.mutes {
+		if mute.UserID != userID {
+			mutes = append(mutes, mute)
+		}
+	}
+	m.mutes = mutes
+
+	subscriptions := m.subscriptions[:0]
+	for _, subscription := range m.subscriptions {
+		if subscription.UserID != userID {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	m.subscriptions = subscriptions
+
+	held := m.held[:0]
+	for _, h := range m.held {
+		if h.UserID != userID {
+			held = append(held, h)
+		}
+	}
+	m.held = held
+
+	channels := m.channels[:0]
+	for _, channel := range m.channels {
+		if channel.UserID != userID {
+			channels = append(channels, channel)
+		}
+	}
+	m.channels = channels
+
+	events := m.events[:0]
+	for _, event := range m.events {
+		if event.UserID != userID {
+			events = append(events, event)
+		}
+	}
+	m.events = events
+
+	tokens := m.apiTokens[:0]
+	for _, token := range m.apiTokens {
+		if token.UserID != userID {
+			tokens = append(tokens, token)
+		}
+	}
+	m.apiTokens = tokens
+
+	failures := m.deliveryFailures[:0]
+	for _, failure := range m.deliveryFailures {
+		if failure.UserID != userID {
+			failures = append(failures, failure)
+		}
+	}
+	m.deliveryFailures = failures
+
+	return nil
+}
+
+// UserUpdate implements the db.DB interface.
+func (m *DB) UserUpdate(ctx context.Context, user *db.User) error {
+	m.updateUser(user.ID, func(u *db.User) {
+		u.FilterDefaultDiscard = user.FilterDefaultDiscard
+		u.Timezone = user.Timezone
+		u.QuietHoursStart = user.QuietHoursStart
+		u.QuietHoursEnd = user.QuietHoursEnd
+		u.NotificationsEnabled = user.NotificationsEnabled
+		u.NotificationsMarkRead = user.NotificationsMarkRead
+	})
+	return nil
+}
+
+// filter returns a copy of a stored filter with its channels and conditions,
+// the caller must hold m.mu.
+func (m *DB) filter(stored db.Filter) db.Filter {
+	f := stored
+	f.SetChannels(strings.Split(f.ChannelsRaw, ","))
+	f.Conditions = nil
+	for _, condition := range m.conditions {
+		if condition.FilterID == f.ID {
+			f.Conditions = append(f.Conditions, condition)
+		}
+	}
+	return f
+}
+
+// filtersWhere returns the filters matching match, in the order they were
+// created.
+func (m *DB) filtersWhere(match func(db.Filter) bool) []db.Filter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var filters []db.Filter
+	for _, f := range m.filters {
+		if match(f) {
+			filters = append(filters, m.filter(f))
+		}
+	}
+	return filters
+}
+
+// ownsFilter returns true if the filter is userID's or belongs to a team
+// userID owns, the caller must hold m.mu.
+func (m *DB) ownsFilter(userID int, filter db.Filter) bool {
+	if filter.UserID != 0 && filter.UserID == userID {
+		return true
+	}
+	for _, membership := range m.memberships {
+		if filter.TeamID != 0 && membership.TeamID == filter.TeamID && membership.UserID == userID && membership.Owner() {
+			return true
+		}
+	}
+	return false
+}
+
+// filtersDelete deletes the filters matching match and their conditions, the
+// caller must hold m.mu.
+func (m *DB) filtersDelete(match func(db.Filter) bool) {
+	deleted := make(map[int]bool)
+	filters := m.filters[:0]
+	for _, f := range m.filters {
+		if match(f) {
+			deleted[f.ID] = true
+			continue
+		}
+		filters = append(filters, f)
+	}
+	m.filters = filters
+
+	conditions := m.conditions[:0]
+	for _, c := range m.conditions {
+		if !deleted[c.FilterID] {
+			conditions = append(conditions, c)
+		}
+	}
+	m.conditions = conditions
+}
+
+// UsersFilters implements the db.DB interface.
+func (m *DB) UsersFilters(ctx context.Context, userID int) ([]db.Filter, error) {
+	return m.filtersWhere(func(f db.Filter) bool {
+		return f.UserID != 0 && f.UserID == userID
+	}), nil
+}
+
+// UsersTeamFilters implements the db.DB interface.
+func (m *DB) UsersTeamFilters(ctx context.Context, userID int) ([]db.Filter, error) {
+	m.mu.Lock()
+	teams := make(map[int]bool)
+	for _, membership := range m.memberships {
+		if membership.UserID == userID {
+			teams[membership.TeamID] = true
+		}
+	}
+	m.mu.Unlock()
+
+	filters := m.filtersWhere(func(f db.Filter) bool {
+		return teams[f.TeamID]
+	})
+	sort.SliceStable(filters, func(i, j int) bool {
+		return filters[i].TeamID < filters[j].TeamID
+	})
+	return filters, nil
+}
+
+// TeamsFilters implements the db.DB interface.
+func (m *DB) TeamsFilters(ctx context.Context, teamID int) ([]db.Filter, error) {
+	return m.filtersWhere(func(f db.Filter) bool {
+		return f.TeamID != 0 && f.TeamID == teamID
+	}), nil
+}
+
+// Filter implements the db.DB interface.
+func (m *DB) Filter(ctx context.Context, filterID int) (*db.Filter, error) {
+	filters := m.filtersWhere(func(f db.Filter) bool {
+		return f.ID == filterID
+	})
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	return &filters[0], nil
+}
+
+// FilterCreate implements the db.DB interface.
+func (m *DB) FilterCreate(ctx context.Context, filter *db.Filter) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := *filter
+	f.ID = m.nextID("filters")
+	f.Channels, f.Conditions = nil, nil
+	f.CreatedAt = time.Now()
+	f.UpdatedAt = f.CreatedAt
+	m.filters = append(m.filters, f)
+	return f.ID, nil
+}
+
+// FilterUpdate implements the db.DB interface.
+func (m *DB) FilterUpdate(ctx context.Context, filter *db.Filter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.filters {
+		if m.filters[i].ID == filter.ID {
+			f := &m.filters[i]
+			f.OnMatchDiscard, f.Urgent, f.Priority, f.Tag, f.ChannelsRaw = filter.OnMatchDiscard, filter.Urgent, filter.Priority, filter.Tag, filter.ChannelsRaw
+		}
+	}
+	return nil
+}
+
+// FilterDelete implements the db.DB interface.
+func (m *DB) FilterDelete(ctx context.Context, userID, filterID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.filtersDelete(func(f db.Filter) bool {
+		return f.ID == filterID && m.ownsFilter(userID, f)
+	})
+	return nil
+}
+
+// Condition implements the db.DB interface.
+func (m *DB) Condition(ctx context.Context, conditionID int) (*db.Condition, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.conditions {
+		if c.ID == conditionID {
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+// ConditionDelete implements the db.DB interface.
+func (m *DB) ConditionDelete(ctx context.Context, userID, conditionID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	owned := make(map[int]bool)
+	for _, f := range m.filters {
+		owned[f.ID] = m.ownsFilter(userID, f)
+	}
+
+	conditions := m.conditions[:0]
+	for _, c := range m.conditions {
+		if c.ID != conditionID || !owned[c.FilterID] {
+			conditions = append(conditions, c)
+		}
+	}
+	m.conditions = conditions
+	return nil
+}
+
+// ConditionCreate implements the db.DB interface.
+func (m *DB) ConditionCreate(ctx context.Context, condition *db.Condition) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var exists bool
+	for _, f := range m.filters {
+		exists = exists || f.ID == condition.FilterID
+	}
+	if !exists {
+		return 0, errors.Errorf("could not insert condition: filter %d does not exist", condition.FilterID)
+	}
+
+	c := *condition
+	c.ID = m.nextID("conditions")
+	c.ComparePublic = false // not stored by SQLDB
+	c.CreatedAt = time.Now()
+	c.UpdatedAt = c.CreatedAt
+	m.conditions = append(m.conditions, c)
+	return c.ID, nil
+}
+
+// UsersMutes implements the db.DB interface.
+func (m *DB) UsersMutes(ctx context.Context, userID int) ([]db.Mute, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var (
+		mutes []db.Mute
+		now   = time.Now()
+	)
+	for _, mute := range m.mutes {
+		if mute.UserID != userID || (mute.ExpiresAt != nil && !mute.ExpiresAt.After(now)) {
+			continue
+		}
+		mute.ExpiresAt = copyTime(mute.ExpiresAt)
+		mutes = append(mutes, mute)
+	}
+	return mutes, nil
+}
+
+// MuteCreate implements the db.DB interface.
+func (m *DB) MuteCreate(ctx context.Context, mute *db.Mute) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.userExists(mute.UserID) {
+		return 0, errors.Errorf("could not insert mute: user %d does not exist", mute.UserID)
+	}
+
+	mu := *mute
+	mu.ID = m.nextID("mutes")
+	mu.ExpiresAt = copyTime(mute.ExpiresAt)
+	mu.CreatedAt = time.Now()
+	mu.UpdatedAt = mu.CreatedAt
+	m.mutes = append(m.mutes, mu)
+	return mu.ID, nil
+}
+
+// MuteDelete implements the db.DB interface.
+func (m *DB) MuteDelete(ctx context.Context, userID, muteID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mutes := m.mutes[:0]
+	for _, mute := range m.mutes {
+		if mute.UserID != userID || mute.ID != muteID {
+			mutes = append(mutes, mute)
+		}
+	}
+	m.mutes = mutes
+	return nil
+}
+
+// Team implements the db.DB interface.
+func (m *DB) Team(ctx context.Context, teamID int) (*db.Team, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, team := range m.teams {
+		if team.ID == teamID {
+			return &team, nil
+		}
+	}
+	return nil, nil
+}
+
+// TeamCreate implements the db.DB interface.
+func (m *DB) TeamCreate(ctx context.Context, team *db.Team, ownerUserID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.userExists(ownerUserID) {
+		return 0, errors.Errorf("could not insert team membership: user %d does not exist", ownerUserID)
+	}
+
+	t := *team
+	t.ID = m.nextID("teams")
+	t.CreatedAt = time.Now()
+	t.UpdatedAt = t.CreatedAt
+	m.teams = append(m.teams, t)
+
+	m.memberships = append(m.memberships, db.TeamMembership{
+		Dates:  t.Dates,
+		TeamID: t.ID,
+		UserID: ownerUserID,
+		Role:   db.TeamRoleOwner,
+	})
+	return t.ID, nil
+}
+
+// teamDelete deletes a team, its memberships and filters, the caller must
+// hold m.mu.
+func (m *DB) teamDelete(teamID int) {
+	teams := m.teams[:0]
+	for _, team := range m.teams {
+		if team.ID != teamID {
+			teams = append(teams, team)
+		}
+	}
+	m.teams = teams
+
+	memberships := m.memberships[:0]
+	for _, membership := range m.memberships {
+		if membership.TeamID != teamID {
+			memberships = append(memberships, membership)
+		}
+	}
+	m.memberships = memberships
+
+	m.filtersDelete(func(f db.Filter) bool {
+		return f.TeamID != 0 && f.TeamID == teamID
+	})
+}
+
+// TeamDelete implements the db.DB interface.
+func (m *DB) TeamDelete(ctx context.Context, teamID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.teamDelete(teamID)
+	return nil
+}
+
+// teamMemberships returns the memberships matching match, with their team's
+// name and user's GitHub login, the caller must hold m.mu.
+func (m *DB) teamMemberships(match func(db.TeamMembership) bool) []db.TeamMembership {
+	var memberships []db.TeamMembership
+	for _, membership := range m.memberships {
+		if !match(membership) {
+			continue
+		}
+		for _, team := range m.teams {
+			if team.ID == membership.TeamID {
+				membership.TeamName = team.Name
+			}
+		}
+		for _, u := range m.users {
+			if u.ID == membership.UserID {
+				membership.GitHubLogin = u.GitHubLogin
+			}
+		}
+		memberships = append(memberships, membership)
+	}
+	return memberships
+}
+
+// UsersTeams implements the db.DB interface.
+func (m *DB) UsersTeams(ctx context.Context, userID int) ([]db.TeamMembership, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	memberships := m.teamMemberships(func(tm db.TeamMembership) bool {
+		return tm.UserID == userID
+	})
+	sort.SliceStable(memberships, func(i, j int) bool {
+		return memberships[i].TeamName < memberships[j].TeamName
+	})
+	return memberships, nil
+}
+
+// TeamsMemberships implements the db.DB interface.
+func (m *DB) TeamsMemberships(ctx context.Context, teamID int) ([]db.TeamMembership, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	memberships := m.teamMemberships(func(tm db.TeamMembership) bool {
+		return tm.TeamID == teamID
+	})
+	sort.SliceStable(memberships, func(i, j int) bool {
+		return memberships[i].GitHubLogin < memberships[j].GitHubLogin
+	})
+	return memberships, nil
+}
+
+// TeamMembership implements the db.DB interface.
+func (m *DB) TeamMembership(ctx context.Context, teamID, userID int) (*db.TeamMembership, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	memberships := m.teamMemberships(func(tm db.TeamMembership) bool {
+		return tm.TeamID == teamID && tm.UserID == userID
+	})
+	if len(memberships) == 0 {
+		return nil, nil
+	}
+	return &memberships[0], nil
+}
+
+// TeamMembershipCreate implements the db.DB interface.
+func (m *DB) TeamMembershipCreate(ctx context.Context, membership *db.TeamMembership) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.memberships {
+		if m.memberships[i].TeamID == membership.TeamID && m.memberships[i].UserID == membership.UserID {
+			m.memberships[i].Role = membership.Role
+			return nil
+		}
+	}
+
+	var teamExists bool
+	for _, team := range m.teams {
+		teamExists = teamExists || team.ID == membership.TeamID
+	}
+	switch {
+	case !teamExists:
+		return errors.Errorf("could not insert team membership: team %d does not exist", membership.TeamID)
+	case !m.userExists(membership.UserID):
+		return errors.Errorf("could not insert team membership: user %d does not exist", membership.UserID)
+	}
+
+	now := time.Now()
+	m.memberships = append(m.memberships, db.TeamMembership{
+		Dates:  db.Dates{CreatedAt: now, UpdatedAt: now},
+		TeamID: membership.TeamID,
+		UserID: membership.UserID,
+		Role:   membership.Role,
+	})
+	return nil
+}
+
+// TeamMembershipDelete implements the db.DB interface.
+func (m *DB) TeamMembershipDelete(ctx context.Context, teamID, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	memberships := m.memberships[:0]
+	for _, membership := range m.memberships {
+		if membership.TeamID != teamID || membership.UserID != userID {
+			memberships = append(memberships, membership)
+		}
+	}
+	m.memberships = memberships
+	return nil
+}
+
+// subscriptionsWhere returns the subscriptions matching match, with their
+// feed's EventLastCreatedAt, the caller must hold m.mu.
+func (m *DB) subscriptionsWhere(match func(db.Subscription) bool) []db.Subscription {
+	var subscriptions []db.Subscription
+	for _, subscription := range m.subscriptions {
+		if !match(subscription) {
+			continue
+		}
+		for _, feed := range m.feeds {
+			if feed.ID == subscription.FeedID {
+				subscription.EventLastCreatedAt = copyTime(feed.EventLastCreatedAt)
+			}
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions
+}
+
+// UsersSubscriptions implements the db.DB interface.
+func (m *DB) UsersSubscriptions(ctx context.Context, userID int) ([]db.Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subscriptions := m.subscriptionsWhere(func(s db.Subscription) bool {
+		return s.UserID == userID
+	})
+	sort.SliceStable(subscriptions, func(i, j int) bool {
+		if subscriptions[i].Kind != subscriptions[j].Kind {
+			return subscriptions[i].Kind < subscriptions[j].Kind
+		}
+		return subscriptions[i].Name < subscriptions[j].Name
+	})
+	return subscriptions, nil
+}
+
+// SubscriptionCreate implements the db.DB interface.
+func (m *DB) SubscriptionCreate(ctx context.Context, subscription *db.Subscription) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var githubHost string
+	for _, u := range m.users {
+		if u.ID == subscription.UserID {
+			githubHost = u.GitHubHost
+		}
+	}
+	if githubHost == "" {
+		return 0, errors.Errorf("could not get subscription feed's ID: user %d does not exist", subscription.UserID)
+	}
+
+	// Use the existing feed for the user's host, if any.
+	subscription.FeedID = 0
+	for _, feed := range m.feeds {
+		if feed.GitHubHost == githubHost && feed.Kind == subscription.Kind && feed.Name == subscription.Name {
+			subscription.FeedID = feed.ID
+		}
+	}
+	if subscription.FeedID == 0 {
+		now := time.Now()
+		feed := db.SubscriptionFeed{
+			Dates:         db.Dates{CreatedAt: now, UpdatedAt: now},
+			ID:            m.nextID("subscription_feeds"),
+			GitHubHost:    githubHost,
+			Kind:          subscription.Kind,
+			Name:          subscription.Name,
+			EventNextPoll: now,
+		}
+		m.feeds = append(m.feeds, feed)
+		subscription.FeedID = feed.ID
+	}
+
+	for _, s := range m.subscriptions {
+		if s.UserID == subscription.UserID && s.Kind == subscription.Kind && s.Name == subscription.Name {
+			return 0, errors.Errorf("could not insert subscription: user %d is already subscribed to %s %q", s.UserID, s.Kind, s.Name)
+		}
+	}
+
+	s := *subscription
+	s.ID = m.nextID("subscriptions")
+	s.EventLastCreatedAt = nil // read from the feed
+	s.CreatedAt = time.Now()
+	s.UpdatedAt = s.CreatedAt
+	m.subscriptions = append(m.subscriptions, s)
+	return s.ID, nil
+}
+
+// SubscriptionDelete implements the db.DB interface.
+func (m *DB) SubscriptionDelete(ctx context.Context, userID, subscriptionID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subscriptions := m.subscriptions[:0]
+	for _, s := range m.subscriptions {
+		if s.UserID != userID || s.ID != subscriptionID {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+	m.subscriptions = subscriptions
+	return nil
+}
+
+// SubscriptionFeedsDue implements the db.DB interface.
+func (m *DB) SubscriptionFeedsDue(ctx context.Context) ([]db.SubscriptionFeed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subscribed := make(map[int]bool)
+	for _, s := range m.subscriptions {
+		subscribed[s.FeedID] = true
+	}
+
+	var (
+		feeds []db.SubscriptionFeed
+		now   = time.Now()
+	)
+	for _, feed := range m.feeds {
+		if feed.EventNextPoll.After(now) || !subscribed[feed.ID] {
+			continue
+		}
+		feed.EventLastCreatedAt = copyTime(feed.EventLastCreatedAt)
+		feeds = append(feeds, feed)
+	}
+	return feeds, nil
+}
+
+// SubscriptionFeedsSubscriptions implements the db.DB interface.
+func (m *DB) SubscriptionFeedsSubscriptions(ctx context.Context, feedID int) ([]db.Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.subscriptionsWhere(func(s db.Subscription) bool {
+		return s.FeedID == feedID
+	}), nil
+}
+
+// SetSubscriptionFeedPollResult implements the db.DB interface.
+func (m *DB) SetSubscriptionFeedPollResult(ctx context.Context, feedID int, lastCreatedAt, nextPoll time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.feeds {
+		if m.feeds[i].ID == feedID {
+			m.feeds[i].EventLastCreatedAt = &lastCreatedAt
+			m.feeds[i].EventNextPoll = nextPoll
+		}
+	}
+	return nil
+}
+
+// HeldNotificationCreate implements the db.DB interface.
+func (m *DB) HeldNotificationCreate(ctx context.Context, held *db.HeldNotification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.userExists(held.UserID) {
+		return errors.Errorf("could not insert held notification: user %d does not exist", held.UserID)
+	}
+
+	h := *held
+	h.ID = m.nextID("held_notifications")
+	h.Event = copyBytes(held.Event)
+	h.CreatedAt = time.Now()
+	m.held = append(m.held, h)
+	return nil
+}
+
+// HeldNotificationsDue implements the db.DB interface.
+func (m *DB) HeldNotificationsDue(ctx context.Context, userID int, now time.Time) ([]db.HeldNotification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var held []db.HeldNotification
+	for _, h := range m.held {
+		if h.UserID != userID || h.DeliverAt.After(now) {
+			continue
+		}
+		h.Event = copyBytes(h.Event)
+		held = append(held, h)
+	}
+	return held, nil
+}
+
+// HeldNotificationsDelete implements the db.DB interface.
+func (m *DB) HeldNotificationsDelete(ctx context.Context, userID int, heldIDs []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := idSet(heldIDs)
+	held := m.held[:0]
+	for _, h := range m.held {
+		if h.UserID != userID || !ids[h.ID] {
+			held = append(held, h)
+		}
+	}
+	m.held = held
+	return nil
+}
+
+// UsersNotificationChannels implements the db.DB interface.
+func (m *DB) UsersNotificationChannels(ctx context.Context, userID int) ([]db.NotificationChannel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var channels []db.NotificationChannel
+	for _, channel := range m.channels {
+		if channel.UserID != userID {
+			continue
+		}
+		channel.VerifiedAt = copyTime(channel.VerifiedAt)
+		channels = append(channels, channel)
+	}
+	sort.SliceStable(channels, func(i, j int) bool {
+		return channels[i].Name < channels[j].Name
+	})
+	return channels, nil
+}
+
+// NotificationChannelCreate implements the db.DB interface.
+func (m *DB) NotificationChannelCreate(ctx context.Context, channel *db.NotificationChannel) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.userExists(channel.UserID) {
+		return 0, errors.Errorf("could not insert notification channel: user %d does not exist", channel.UserID)
+	}
+	for _, c := range m.channels {
+		switch {
+		case c.UserID == channel.UserID && c.Name == channel.Name:
+			return 0, errors.Errorf("could not insert notification channel: user %d already has channel %q", c.UserID, c.Name)
+		case c.VerifyToken == channel.VerifyToken:
+			return 0, errors.New("could not insert notification channel: duplicate verify token")
+		}
+	}
+
+	c := *channel
+	c.ID = m.nextID("notification_channels")
+	c.VerifiedAt = nil
+	c.CreatedAt = time.Now()
+	c.UpdatedAt = c.CreatedAt
+	m.channels = append(m.channels, c)
+	return c.ID, nil
+}
+
+// NotificationChannelDelete implements the db.DB interface.
+func (m *DB) NotificationChannelDelete(ctx context.Context, userID, channelID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	channels := m.channels[:0]
+	for _, c := range m.channels {
+		if c.UserID != userID || c.ID != channelID {
+			channels = append(channels, c)
+		}
+	}
+	m.channels = channels
+	return nil
+}
+
+// NotificationChannelVerify implements the db.DB interface.
+func (m *DB) NotificationChannelVerify(ctx context.Context, userID int, token string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var verified bool
+	for i := range m.channels {
+		c := &m.channels[i]
+		if c.UserID == userID && c.VerifyToken == token && c.VerifiedAt == nil {
+			now := time.Now()
+			c.VerifiedAt = &now
+			verified = true
+		}
+	}
+	return verified, nil
+}
+
+// EventsCreate implements the db.DB interface.
+func (m *DB) EventsCreate(ctx context.Context, events []db.Event) ([]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, event := range events {
+		if !m.userExists(event.UserID) {
+			return nil, errors.Errorf("could not insert event: user %d does not exist", event.UserID)
+		}
+	}
+
+	inserted := make([]bool, len(events))
+	for i, event := range events {
+		var duplicate bool
+		for _, e := range m.events {
+			duplicate = duplicate || (e.UserID == event.UserID && e.DedupKey == event.DedupKey)
+		}
+		if duplicate {
+			continue
+		}
+
+		// An event is stored unread, its state is only set by the user.
+		event.ID = m.nextID("events")
+		event.ReadAt, event.Archived, event.Starred = nil, false, false
+		m.events = append(m.events, event)
+		inserted[i] = true
+	}
+	return inserted, nil
+}
+
+// containsFold returns true if substr is within s, ignoring case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// eventMatches returns true if a user's event matches query. Search matches
+// substrings of the title or body ignoring case, like SQLDB with SQLite.
+func eventMatches(e db.Event, userID int, query db.EventQuery) bool {
+	switch {
+	case e.UserID != userID:
+	case query.Search != "" && !containsFold(e.Title, query.Search) && !containsFold(e.Body, query.Search):
+	case query.Repository != "" && e.Repository != query.Repository:
+	case query.Type != "" && e.Type != query.Type:
+	case query.Actor != "" && e.Actor != query.Actor:
+	case query.Tag != "" && e.Tag != query.Tag:
+	case query.Status == db.EventStatusAccepted && e.Discarded:
+	case query.Status == db.EventStatusDiscarded && !e.Discarded:
+	case query.Folder == db.EventFolderInbox && (e.Discarded || e.Archived):
+	case query.Folder == db.EventFolderUnread && (e.Discarded || e.ReadAt != nil):
+	case query.Folder == db.EventFolderStarred && !e.Starred:
+	case query.Folder == db.EventFolderArchived && !e.Archived:
+	default:
+		return true
+	}
+	return false
+}
+
+// eventsWhere returns copies of the events matching match, in the order they
+// were stored, the caller must hold m.mu.
+func (m *DB) eventsWhere(match func(db.Event) bool) []db.Event {
+	var events []db.Event
+	for _, e := range m.events {
+		if match(e) {
+			e.ReadAt = copyTime(e.ReadAt)
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// UsersEvents implements the db.DB interface.
+func (m *DB) UsersEvents(ctx context.Context, userID int, query db.EventQuery) ([]db.Event, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PerPage < 1 {
+		query.PerPage = 50
+	}
+
+	m.mu.Lock()
+	events := m.eventsWhere(func(e db.Event) bool {
+		return eventMatches(e, userID, query)
+	})
+	m.mu.Unlock()
+
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].CreatedAt.Equal(events[j].CreatedAt) {
+			return events[i].CreatedAt.After(events[j].CreatedAt)
+		}
+		return events[i].ID > events[j].ID
+	})
+
+	offset := (query.Page - 1) * query.PerPage
+	if offset >= len(events) {
+		return nil, nil
+	}
+	events = events[offset:]
+	if len(events) > query.PerPage {
+		events = events[:query.PerPage]
+	}
+	return events, nil
+}
+
+// eventFacets returns the 20 values with the most events, ordered by their
+// count then value.
+func eventFacets(counts map[string]int) []db.EventFacet {
+	var facets []db.EventFacet
+	for value, count := range counts {
+		facets = append(facets, db.EventFacet{Value: value, Count: count})
+	}
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Value < facets[j].Value
+	})
+	if len(facets) > 20 {
+		facets = facets[:20]
+	}
+	return facets
+}
+
+// UsersEventFacets implements the db.DB interface.
+func (m *DB) UsersEventFacets(ctx context.Context, userID int, query db.EventQuery) (*db.EventFacets, error) {
+	m.mu.Lock()
+	events := m.eventsWhere(func(e db.Event) bool {
+		return eventMatches(e, userID, query)
+	})
+	m.mu.Unlock()
+
+	var (
+		repositories = make(map[string]int)
+		types        = make(map[string]int)
+		actors       = make(map[string]int)
+		statuses     = make(map[string]int)
+	)
+	for _, e := range events {
+		repositories[e.Repository]++
+		types[e.Type]++
+		actors[e.Actor]++
+		if e.Discarded {
+			statuses[db.EventStatusDiscarded]++
+		} else {
+			statuses[db.EventStatusAccepted]++
+		}
+	}
+
+	return &db.EventFacets{
+		Repositories: eventFacets(repositories),
+		Types:        eventFacets(types),
+		Actors:       eventFacets(actors),
+		Statuses:     eventFacets(statuses),
+	}, nil
+}
+
+// UsersEventsByID implements the db.DB interface.
+func (m *DB) UsersEventsByID(ctx context.Context, userID int, eventIDs []int) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := idSet(eventIDs)
+	return m.eventsWhere(func(e db.Event) bool {
+		return e.UserID == userID && ids[e.ID]
+	}), nil
+}
+
+// UsersEventsAfter implements the db.DB interface.
+func (m *DB) UsersEventsAfter(ctx context.Context, userID, eventID int) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := m.eventsWhere(func(e db.Event) bool {
+		return e.UserID == userID && e.ID > eventID && !e.Discarded
+	})
+	if len(events) > 100 {
+		events = events[:100]
+	}
+	return events, nil
+}
+
+// UsersLatestEventID implements the db.DB interface.
+func (m *DB) UsersLatestEventID(ctx context.Context, userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var eventID int
+	for _, e := range m.events {
+		if e.UserID == userID && e.ID > eventID {
+			eventID = e.ID
+		}
+	}
+	return eventID, nil
+}
+
+// UsersUnreadCount implements the db.DB interface.
+func (m *DB) UsersUnreadCount(ctx context.Context, userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int
+	for _, e := range m.events {
+		if e.UserID == userID && e.Unread() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// updateEvents calls update with each of a user's stored events matching
+// match.
+func (m *DB) updateEvents(userID int, match func(db.Event) bool, update func(*db.Event)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.events {
+		if m.events[i].UserID == userID && match(m.events[i]) {
+			update(&m.events[i])
+		}
+	}
+}
+
+// EventsMarkRead implements the db.DB interface.
+func (m *DB) EventsMarkRead(ctx context.Context, userID int, eventIDs []int, read bool) error {
+	ids := idSet(eventIDs)
+	now := time.Now()
+	m.updateEvents(userID, func(e db.Event) bool {
+		return ids[e.ID]
+	}, func(e *db.Event) {
+		e.ReadAt = nil
+		if read {
+			e.ReadAt = copyTime(&now)
+		}
+	})
+	return nil
+}
+
+// EventsMarkRepositoryRead implements the db.DB interface.
+func (m *DB) EventsMarkRepositoryRead(ctx context.Context, userID int, repository string) error {
+	now := time.Now()
+	m.updateEvents(userID, func(e db.Event) bool {
+		return e.Repository == repository && e.ReadAt == nil
+	}, func(e *db.Event) {
+		e.ReadAt = copyTime(&now)
+	})
+	return nil
+}
+
+// EventArchive implements the db.DB interface.
+func (m *DB) EventArchive(ctx context.Context, userID, eventID int, archived bool) error {
+	now := time.Now()
+	m.updateEvents(userID, func(e db.Event) bool {
+		return e.ID == eventID
+	}, func(e *db.Event) {
+		e.Archived = archived
+		if e.ReadAt == nil {
+			e.ReadAt = &now
+		}
+	})
+	return nil
+}
+
+// EventStar implements the db.DB interface.
+func (m *DB) EventStar(ctx context.Context, userID, eventID int, starred bool) error {
+	m.updateEvents(userID, func(e db.Event) bool {
+		return e.ID == eventID
+	}, func(e *db.Event) {
+		e.Starred = starred
+	})
+	return nil
+}
+
+// UsersAPITokens implements the db.DB interface.
+func (m *DB) UsersAPITokens(ctx context.Context, userID int) ([]db.APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tokens []db.APIToken
+	for _, token := range m.apiTokens {
+		if token.UserID == userID {
+			token.LastUsedAt = copyTime(token.LastUsedAt)
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+// APITokenByHash implements the db.DB interface.
+func (m *DB) APITokenByHash(ctx context.Context, tokenHash string) (*db.APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, token := range m.apiTokens {
+		if token.TokenHash == tokenHash {
+			token.LastUsedAt = copyTime(token.LastUsedAt)
+			return &token, nil
+		}
+	}
+	return nil, nil
+}
+
+// APITokenCreate implements the db.DB interface.
+func (m *DB) APITokenCreate(ctx context.Context, token *db.APIToken) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.userExists(token.UserID) {
+		return 0, errors.Errorf("could not insert api token: user %d does not exist", token.UserID)
+	}
+	for _, t := range m.apiTokens {
+		if t.TokenHash == token.TokenHash {
+			return 0, errors.New("could not insert api token: duplicate token hash")
+		}
+	}
+
+	t := *token
+	t.ID = m.nextID("api_tokens")
+	t.LastUsedAt = nil
+	t.CreatedAt = time.Now()
+	m.apiTokens = append(m.apiTokens, t)
+	return t.ID, nil
+}
+
+// APITokenUsed implements the db.DB interface.
+func (m *DB) APITokenUsed(ctx context.Context, tokenID int, usedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.apiTokens {
+		if m.apiTokens[i].ID == tokenID {
+			m.apiTokens[i].LastUsedAt = &usedAt
+		}
+	}
+	return nil
+}
+
+// APITokenDelete implements the db.DB interface.
+func (m *DB) APITokenDelete(ctx context.Context, userID, tokenID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokens := m.apiTokens[:0]
+	for _, t := range m.apiTokens {
+		if t.UserID != userID || t.ID != tokenID {
+			tokens = append(tokens, t)
+		}
+	}
+	m.apiTokens = tokens
+	return nil
+}
+
+// Installation implements the db.DB interface.
+func (m *DB) Installation(ctx context.Context, installationID int) (*db.Installation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, installation := range m.installations {
+		if installation.ID == installationID {
+			return &installation, nil
+		}
+	}
+	return nil, nil
+}
+
+// InstallationCreate implements the db.DB interface.
+func (m *DB) InstallationCreate(ctx context.Context, installation *db.Installation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.installations {
+		if m.installations[i].ID == installation.ID {
+			m.installations[i].AccountLogin = installation.AccountLogin
+			return nil
+		}
+	}
+
+	i := *installation
+	i.CreatedAt = time.Now()
+	m.installations = append(m.installations, i)
+	return nil
+}
+
+// InstallationDelete implements the db.DB interface.
+func (m *DB) InstallationDelete(ctx context.Context, installationID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	installations := m.installations[:0]
+	for _, installation := range m.installations {
+		if installation.ID != installationID {
+			installations = append(installations, installation)
+		}
+	}
+	m.installations = installations
+
+	repos := m.installationRepos[:0]
+	for _, repo := range m.installationRepos {
+		if repo.InstallationID != installationID {
+			repos = append(repos, repo)
+		}
+	}
+	m.installationRepos = repos
+	return nil
+}
+
+// InstallationRepositoriesCreate implements the db.DB interface.
+func (m *DB) InstallationRepositoriesCreate(ctx context.Context, repos []db.InstallationRepository) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, repo := range repos {
+		var installed bool
+		for _, installation := range m.installations {
+			installed = installed || installation.ID == repo.InstallationID
+		}
+		if !installed {
+			return errors.Errorf("could not insert installation repository %q: installation %d does not exist", repo.FullName, repo.InstallationID)
+		}
+	}
+
+nextRepo:
+	for _, repo := range repos {
+		for i := range m.installationRepos {
+			r := &m.installationRepos[i]
+			if r.InstallationID == repo.InstallationID && r.RepositoryID == repo.RepositoryID {
+				r.FullName = repo.FullName
+				continue nextRepo
+			}
+		}
+
+		now := time.Now()
+		m.installationRepos = append(m.installationRepos, db.InstallationRepository{
+			InstallationID:     repo.InstallationID,
+			RepositoryID:       repo.RepositoryID,
+			FullName:           repo.FullName,
+			EventLastCreatedAt: now,
+			EventNextPoll:      now,
+		})
+	}
+	return nil
+}
+
+// InstallationRepositoriesDelete implements the db.DB interface.
+func (m *DB) InstallationRepositoriesDelete(ctx context.Context, installationID int, repositoryIDs []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := idSet(repositoryIDs)
+	repos := m.installationRepos[:0]
+	for _, repo := range m.installationRepos {
+		if repo.InstallationID != installationID || !ids[repo.RepositoryID] {
+			repos = append(repos, repo)
+		}
+	}
+	m.installationRepos = repos
+	return nil
+}
+
+// InstallationRepositoriesDue implements the db.DB interface.
+func (m *DB) InstallationRepositoriesDue(ctx context.Context) ([]db.InstallationRepository, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var (
+		repos []db.InstallationRepository
+		now   = time.Now()
+	)
+	for _, repo := range m.installationRepos {
+		if !repo.EventNextPoll.After(now) {
+			repos = append(repos, repo)
+		}
+	}
+	return repos, nil
+}
+
+// SetInstallationRepositoryPollResult implements the db.DB interface.
+func (m *DB) SetInstallationRepositoryPollResult(ctx context.Context, installationID, repositoryID int, lastCreatedAt, nextPoll time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.installationRepos {
+		r := &m.installationRepos[i]
+		if r.InstallationID == installationID && r.RepositoryID == repositoryID {
+			r.EventLastCreatedAt, r.EventNextPoll = lastCreatedAt, nextPoll
+		}
+	}
+	return nil
+}
+
+// SetUsersNotificationsSince implements the db.DB interface.
+func (m *DB) SetUsersNotificationsSince(ctx context.Context, userID int, since time.Time) error {
+	m.updateUser(userID, func(u *db.User) {
+		u.NotificationsSince = since
+	})
+	return nil
+}
+
+// SetUsersPollStatus implements the db.DB interface.
+func (m *DB) SetUsersPollStatus(ctx context.Context, userID int, polledAt time.Time, pollError string, tokenValid bool) error {
+	if len(pollError) > 1024 {
+		pollError = pollError[:1024]
+	}
+	m.updateUser(userID, func(u *db.User) {
+		u.PolledAt, u.PollError, u.GitHubTokenValid = &polledAt, pollError, tokenValid
+	})
+	return nil
+}
+
+// UserPollPausedUpdate implements the db.DB interface.
+func (m *DB) UserPollPausedUpdate(ctx context.Context, userID int, paused bool) error {
+	m.updateUser(userID, func(u *db.User) {
+		u.PollPaused = paused
+	})
+	return nil
+}
+
+// UserPollNow implements the db.DB interface.
+func (m *DB) UserPollNow(ctx context.Context, userID int) error {
+	now := time.Now()
+	m.updateUser(userID, func(u *db.User) {
+		u.EventNextPoll = now
+	})
+	return nil
+}
+
+// AdminUsers implements the db.DB interface.
+func (m *DB) AdminUsers(ctx context.Context, failuresSince time.Time) ([]db.AdminUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var users []db.AdminUser
+	for _, stored := range m.users {
+		u, err := user(stored)
+		if err != nil {
+			return nil, err
+		}
+
+		au := db.AdminUser{User: *u}
+		for _, failure := range m.deliveryFailures {
+			if failure.UserID != u.ID || !failure.CreatedAt.After(failuresSince) {
+				continue
+			}
+			au.DeliveryFailures++
+			if au.LastDeliveryFailureAt == nil || !failure.CreatedAt.Before(*au.LastDeliveryFailureAt) {
+				createdAt := failure.CreatedAt
+				au.LastDeliveryFailureAt = &createdAt
+				au.LastDeliveryFailureReason = failure.Error
+			}
+		}
+		users = append(users, au)
+	}
+	return users, nil
+}
+
+// DeliveryFailureCreate implements the db.DB interface.
+func (m *DB) DeliveryFailureCreate(ctx context.Context, failure *db.DeliveryFailure) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.userExists(failure.UserID) {
+		return errors.Errorf("could not insert delivery failure: user %d does not exist", failure.UserID)
+	}
+	if len(failure.Error) > 1024 {
+		failure.Error = failure.Error[:1024]
+	}
+
+	f := *failure
+	f.ID = m.nextID("delivery_failures")
+	f.CreatedAt = time.Now()
+	m.deliveryFailures = append(m.deliveryFailures, f)
+	return nil
+}
+
+// SetUsersPollResult implements the db.DB interface.
+func (m *DB) SetUsersPollResult(ctx context.Context, userID int, lastCreatedAt, nextPoll time.Time) error {
+	m.updateUser(userID, func(u *db.User) {
+		u.EventLastCreatedAt, u.EventNextPoll = lastCreatedAt, nextPoll
+	})
+	return nil
+}
+
+// GitHubLogin implements the db.DB interface.
+func (m *DB) GitHubLogin(ctx context.Context, githubHost, email string, githubID int, githubLogin string, token *oauth2.Token) (int, error) {
+	jsonToken, err := json.Marshal(token)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not marshal oauth2.token")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		u := &m.users[i]
+		if u.GitHubHost == githubHost && u.GitHubID == githubID {
+			u.Email, u.GitHubLogin, u.GitHubTokenRaw = email, githubLogin, jsonToken
+			return u.ID, nil
+		}
+	}
+
+	// Defaults of the users table.
+	now := time.Now()
+	u := db.User{
+		Dates:                db.Dates{CreatedAt: now, UpdatedAt: now},
+		ID:                   m.nextID("users"),
+		Email:                email,
+		GitHubHost:           githubHost,
+		GitHubID:             githubID,
+		GitHubLogin:          githubLogin,
+		GitHubTokenRaw:       jsonToken,
+		GitHubTokenValid:     true,
+		FilterDefaultDiscard: true,
+		Timezone:             "UTC",
+		NotificationsSince:   now,
+		EventLastCreatedAt:   now,
+		EventNextPoll:        now,
+	}
+	m.users = append(m.users, u)
+	return u.ID, nil
+}
+
+// GitHubTokensReencrypt implements the db.DB interface, tokens aren't
+// encrypted so none are re-encrypted.
+func (m *DB) GitHubTokensReencrypt(ctx context.Context) (int, error) {
+	return 0, nil
+}
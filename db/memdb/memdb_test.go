@@ -0,0 +1,13 @@
+package memdb_test
+
+import (
+	"testing"
+
+	"github.com/bradleyfalzon/maintainer.me/db"
+	"github.com/bradleyfalzon/maintainer.me/db/dbtest"
+	"github.com/bradleyfalzon/maintainer.me/db/memdb"
+)
+
+func TestDB(t *testing.T) {
+	dbtest.Run(t, func(*testing.T) db.DB { return memdb.New() })
+}
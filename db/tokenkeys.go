@@ -0,0 +1,159 @@
+package db
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// tokenFormat prefixes encrypted tokens, tokens stored before encryption was
+// added are plain JSON.
+const tokenFormat = "v1"
+
+// TokenKeys are the key encryption keys used to encrypt users' GitHub tokens
+// at rest. Each token is encrypted with its own random data key, which is
+// encrypted with the primary key and stored alongside the token. Older keys
+// are only used to decrypt tokens until they're re-encrypted with the
+// primary key.
+type TokenKeys struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// ParseTokenKeys parses a comma separated list of keys, each an ID and a
+// base64 encoded 32 byte AES key separated by a colon, such as
+// "2:<key>,1:<key>". The first key is the primary key.
+func ParseTokenKeys(s string) (*TokenKeys, error) {
+	tk := &TokenKeys{keys: make(map[string]cipher.AEAD)}
+	for _, field := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.New("token key must be in the form <id>:<base64 key>")
+		}
+		id := parts[0]
+		if _, ok := tk.keys[id]; ok {
+			return nil, errors.Errorf("duplicate token key ID %q", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not decode token key %q", id)
+		}
+		if len(key) != 32 {
+			return nil, errors.Errorf("token key %q must be 32 bytes, not %d", id, len(key))
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid token key %q", id)
+		}
+		tk.keys[id] = aead
+		if tk.primary == "" {
+			tk.primary = id
+		}
+	}
+	return tk, nil
+}
+
+// newAEAD returns AES-GCM using key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with aead and a random nonce, returning the nonce
+// followed by the ciphertext.
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "could not read random nonce")
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// open decrypts the output of seal.
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+}
+
+// Encrypt encrypts plaintext with a new data key, encrypted with the primary
+// key, returning the value to store.
+func (tk *TokenKeys) Encrypt(plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, errors.Wrap(err, "could not read random data key")
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create data key cipher")
+	}
+
+	// The key ID is authenticated so a data key can't be moved to another key.
+	sealedKey, err := seal(tk.keys[tk.primary], dataKey, []byte(tk.primary))
+	if err != nil {
+		return nil, err
+	}
+	sealedText, err := seal(aead, plaintext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := base64.RawStdEncoding
+	return []byte(strings.Join([]string{
+		tokenFormat, tk.primary, enc.EncodeToString(sealedKey), enc.EncodeToString(sealedText),
+	}, ":")), nil
+}
+
+// Decrypt decrypts a value returned by Encrypt, using whichever key encrypted
+// it. Values that were stored before encryption are returned unchanged.
+func (tk *TokenKeys) Decrypt(stored []byte) ([]byte, error) {
+	if !bytes.HasPrefix(stored, []byte(tokenFormat+":")) {
+		return stored, nil
+	}
+
+	parts := strings.Split(string(stored), ":")
+	if len(parts) != 4 {
+		return nil, errors.New("malformed encrypted token")
+	}
+	id := parts[1]
+	keyAEAD, ok := tk.keys[id]
+	if !ok {
+		return nil, errors.Errorf("unknown token key %q", id)
+	}
+
+	enc := base64.RawStdEncoding
+	sealedKey, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode data key")
+	}
+	sealedText, err := enc.DecodeString(parts[3])
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode token")
+	}
+
+	dataKey, err := open(keyAEAD, sealedKey, []byte(id))
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not decrypt data key with token key %q", id)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create data key cipher")
+	}
+	plaintext, err := open(aead, sealedText, nil)
+	return plaintext, errors.Wrap(err, "could not decrypt token")
+}
+
+// Current returns true if a stored value is encrypted with the primary key,
+// and so doesn't need to be re-encrypted.
+func (tk *TokenKeys) Current(stored []byte) bool {
+	return bytes.HasPrefix(stored, []byte(tokenFormat+":"+tk.primary+":"))
+}
@@ -3,7 +3,9 @@ package events
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -14,15 +16,18 @@ import (
 
 type Events []*Event
 
-func ListNewEvents(ctx context.Context, logger *logrus.Entry, client *github.Client, githubUser string, lastCreatedAt time.Time) (events Events, pollInterval time.Duration, err error) {
+// listEventsFunc lists a page of events from the GitHub Events API.
+type listEventsFunc func(ctx context.Context, opt *github.ListOptions) ([]*github.Event, *github.Response, error)
+
+func listNewEvents(ctx context.Context, logger *logrus.Entry, lastCreatedAt time.Time, list listEventsFunc) (events Events, pollInterval time.Duration, err error) {
 	opt := github.ListOptions{Page: 1}
 
 ListEvents:
 	for {
 		start := time.Now()
-		pagedEvents, response, err := client.Activity.ListEventsReceivedByUser(ctx, githubUser, false, &opt)
+		pagedEvents, response, err := list(ctx, &opt)
 		if err != nil {
-			return nil, 0, errors.Wrapf(err, "could not get GitHub events for user %q", githubUser)
+			return nil, 0, err
 		}
 		logger.Debugf("polled events page %v in %v", opt.Page, time.Since(start))
 
@@ -67,10 +72,69 @@ func haveObserved(observed, query time.Time) bool {
 	return !observed.IsZero() && (query.Before(observed) || query.Equal(observed))
 }
 
-func (e Events) Filter(filters []db.Filter, defaultDiscard bool) {
+// Dedup returns the events without those with the same DedupKey as an
+// earlier event, such as an event both received by the user and in a
+// repository they're subscribed to.
+func (e Events) Dedup() Events {
+	var (
+		events Events
+		seen   = make(map[string]bool)
+	)
+	for _, event := range e {
+		if seen[event.DedupKey] {
+			continue
+		}
+		seen[event.DedupKey] = true
+		events = append(events, event)
+	}
+	return events
+}
+
+// copy returns a copy of each event, so the copies may be filtered
+// independently of the originals.
+func (e Events) copy() Events {
+	events := make(Events, 0, len(e))
 	for _, event := range e {
-		event.Filter(filters, defaultDiscard)
+		c := *event
+		events = append(events, &c)
 	}
+	return events
+}
+
+// Filter filters each event, see Event.Filter.
+func (e Events) Filter(mutes []db.Mute, filters, teamFilters []db.Filter, defaultDiscard bool) {
+	now := time.Now()
+	for _, event := range e {
+		event.Filter(now, mutes, filters, teamFilters, defaultDiscard)
+	}
+}
+
+// dbEvents returns the events to be stored for userID.
+func (e Events) dbEvents(userID int) []db.Event {
+	var events []db.Event
+	for _, event := range e {
+		events = append(events, db.Event{
+			UserID:       userID,
+			GitHubID:     event.RawEvent.GetID(),
+			CreatedAt:    event.CreatedAt,
+			Type:         event.Type,
+			Public:       event.Public,
+			Repository:   event.Repository,
+			RepositoryID: event.RepositoryID,
+			Number:       event.Number,
+			Actor:        event.Actor,
+			Action:       event.Action,
+			Subject:      event.Subject,
+			Title:        event.Title,
+			Body:         event.Body,
+			Discarded:    event.Discarded,
+			Muted:        event.Muted,
+			Priority:     event.Priority,
+			Tag:          event.Tag,
+			DedupKey:     event.DedupKey,
+		})
+	}
+	return events
 }
 
 type Event struct {
@@ -79,8 +143,21 @@ type Event struct {
 	Type      string    // Type such as "CommitCommentEvent".
 	Public    bool      // Public is whether GitHub event was public.
 
+	Repository   string // Repository is the full name of the event's repository, such as "golang/go".
+	RepositoryID int    // RepositoryID is the GitHub ID of the event's repository.
+	Number       int    // Number is the issue or pull request number, if any.
+
+	// Muted is true when the event matched one of the user's mutes, muted
+	// events are always discarded.
+	Muted bool
 	// Discarded is true when an event has been filtered and should be ignored.
 	Discarded bool
+	// Urgent, Priority, Tag and Channels are set by the filter that matched
+	// the event.
+	Urgent   bool // Urgent events are notified even during quiet hours.
+	Priority int
+	Tag      string
+	Channels []string // Channels to notify, if empty the DefaultChannel is used.
 
 	Actor   string // Actor is the person who did an action, such as "bradleyfalzon".
 	Action  string // Action is the action performed on a subject, such as "commented".
@@ -88,6 +165,10 @@ type Event struct {
 
 	Title string // Title is a short description of the event, such as "[golang/go] bradleyfalzon commented on abcdef1234"
 	Body  string // Body contains more context and may be blank.
+
+	// DedupKey identifies the activity the event describes, and is the same
+	// whether the event was polled or received by a webhook.
+	DedupKey string
 }
 
 func ParseEvent(ghe *github.Event) (*Event, error) {
@@ -101,6 +182,9 @@ func ParseEvent(ghe *github.Event) (*Event, error) {
 		CreatedAt: ghe.GetCreatedAt(),
 		Type:      ghe.GetType(),
 		Public:    ghe.GetPublic(),
+
+		Repository:   ghe.Repo.GetName(),
+		RepositoryID: ghe.Repo.GetID(),
 	}
 	switch p := payload.(type) {
 	case *github.CommitCommentEvent:
@@ -135,9 +219,27 @@ func ParseEvent(ghe *github.Event) (*Event, error) {
 		//e.Body = p.Issue.GetBody()
 		e.Title = fmt.Sprintf("[%s] %s %s wiki on %s", ghe.Repo.GetName(), e.Actor, e.Action, e.Subject)
 	case *github.InstallationEvent:
-		// TODO
+		e.Actor = p.Sender.GetLogin()
+		e.Action = p.GetAction()
+		e.Subject = p.Installation.Account.GetLogin()
+		e.Title = fmt.Sprintf("[%s] %s %s the GitHub App installation", e.Subject, e.Actor, e.Action)
 	case *github.InstallationRepositoriesEvent:
-		// TODO
+		e.Actor = p.Sender.GetLogin()
+		e.Action = p.GetAction()
+		e.Subject = p.Installation.Account.GetLogin()
+		var (
+			repos       []string
+			preposition = "to"
+		)
+		for _, repo := range p.RepositoriesAdded {
+			repos = append(repos, repo.GetFullName())
+		}
+		for _, repo := range p.RepositoriesRemoved {
+			repos = append(repos, repo.GetFullName())
+			preposition = "from"
+		}
+		e.Body = strings.Join(repos, "\n")
+		e.Title = fmt.Sprintf("[%s] %s %s %d repositories %s the GitHub App installation", e.Subject, e.Actor, e.Action, len(repos), preposition)
 	case *github.IssueCommentEvent:
 		e.Actor = ghe.Actor.GetLogin()
 		e.Action = p.GetAction()
@@ -151,12 +253,14 @@ func ParseEvent(ghe *github.Event) (*Event, error) {
 			verb = "deleted comment in"
 		default:
 		}
+		e.Number = p.Issue.GetNumber()
 		e.Subject = fmt.Sprintf("%s (#%d)", p.Issue.GetTitle(), p.Issue.GetNumber())
 		e.Body = p.Comment.GetBody()
 		e.Title = fmt.Sprintf("[%s] %s %s %s", ghe.Repo.GetName(), e.Actor, verb, e.Subject)
 	case *github.IssuesEvent:
 		e.Actor = ghe.Actor.GetLogin()
 		e.Action = p.GetAction()
+		e.Number = p.Issue.GetNumber()
 		e.Subject = fmt.Sprintf("%s (#%d)", p.Issue.GetTitle(), p.Issue.GetNumber())
 		e.Body = p.Issue.GetBody()
 		e.Title = fmt.Sprintf("[%s] %s %s %s", ghe.Repo.GetName(), e.Actor, e.Action, e.Subject)
@@ -187,13 +291,24 @@ func ParseEvent(ghe *github.Event) (*Event, error) {
 	case *github.PullRequestEvent:
 		e.Actor = ghe.Actor.GetLogin()
 		e.Action = p.GetAction()
+		e.Number = p.PullRequest.GetNumber()
 		e.Subject = fmt.Sprintf("%s (#%d)", p.PullRequest.GetTitle(), p.PullRequest.GetNumber())
 		e.Body = p.PullRequest.GetBody()
 		e.Title = fmt.Sprintf("[%s] %s %s %s", ghe.Repo.GetName(), e.Actor, e.Action, e.Subject)
 	case *github.PullRequestReviewEvent:
-		// TODO
+		e.Actor = ghe.Actor.GetLogin()
+		e.Action = p.GetAction()
+		e.Number = p.PullRequest.GetNumber()
+		e.Subject = fmt.Sprintf("%s (#%d)", p.PullRequest.GetTitle(), p.PullRequest.GetNumber())
+		e.Body = p.Review.GetBody()
+		e.Title = fmt.Sprintf("[%s] %s reviewed (%s) %s", ghe.Repo.GetName(), e.Actor, strings.ToLower(p.Review.GetState()), e.Subject)
 	case *github.PullRequestReviewCommentEvent:
-		// TODO
+		e.Actor = ghe.Actor.GetLogin()
+		e.Action = p.GetAction()
+		e.Number = p.PullRequest.GetNumber()
+		e.Subject = fmt.Sprintf("%s (#%d)", p.PullRequest.GetTitle(), p.PullRequest.GetNumber())
+		e.Body = p.Comment.GetBody()
+		e.Title = fmt.Sprintf("[%s] %s %s review comment on %s", ghe.Repo.GetName(), e.Actor, e.Action, e.Subject)
 	case *github.PushEvent:
 		e.Actor = ghe.Actor.GetLogin()
 		e.Action = "pushed"
@@ -213,19 +328,102 @@ func ParseEvent(ghe *github.Event) (*Event, error) {
 	case *github.WatchEvent:
 		// TODO
 	}
+	e.DedupKey = dedupKey(ghe, payload, e.Action)
 	return e, nil
 }
 
+// dedupKey returns a key identifying the activity of an event with payload,
+// such as "IssueCommentEvent:23096419:created:1234:1498780800". Where
+// possible the key is built from the IDs in the payload, as a polled event's
+// ID is not known to webhooks. Other events use GitHub's event ID.
+func dedupKey(ghe *github.Event, payload interface{}, action string) string {
+	var id string
+	switch p := payload.(type) {
+	case *github.CommitCommentEvent:
+		id = strconv.Itoa(p.Comment.GetID())
+	case *github.CreateEvent:
+		id = p.GetRefType() + ":" + p.GetRef()
+	case *github.ForkEvent:
+		id = strconv.Itoa(p.Forkee.GetID())
+	case *github.IssueCommentEvent:
+		id = fmt.Sprintf("%d:%d", p.Comment.GetID(), p.Comment.GetUpdatedAt().Unix())
+	case *github.IssuesEvent:
+		id = fmt.Sprintf("%d:%d", p.Issue.GetID(), p.Issue.GetUpdatedAt().Unix())
+	case *github.PullRequestEvent:
+		id = fmt.Sprintf("%d:%d", p.PullRequest.GetID(), p.PullRequest.GetUpdatedAt().Unix())
+	case *github.PullRequestReviewEvent:
+		id = strconv.Itoa(p.Review.GetID())
+	case *github.PullRequestReviewCommentEvent:
+		id = fmt.Sprintf("%d:%d", p.Comment.GetID(), p.Comment.GetUpdatedAt().Unix())
+	case *github.PushEvent:
+		// Polled events include the head, webhooks include after.
+		id = p.GetHead()
+		if id == "" {
+			id = p.GetAfter()
+		}
+	}
+	if id == "" {
+		return "id:" + ghe.GetID()
+	}
+	return fmt.Sprintf("%s:%d:%s:%s", ghe.GetType(), ghe.Repo.GetID(), action, id)
+}
+
 func (e *Event) String() string {
 	return e.Title
 }
 
-func (e *Event) Filter(filters []db.Filter, defaultDiscard bool) {
-	for _, filter := range filters {
-		if filter.Matches(e.RawEvent) {
-			e.Discarded = filter.OnMatchDiscard
+// ThreadKey returns the key grouping events about the same issue or pull
+// request, or blank if the event is not about an issue or pull request.
+func (e *Event) ThreadKey() string {
+	return db.ThreadKey(e.Repository, e.Number)
+}
+
+// MutePath returns the console path to mute the event's issue or pull request,
+// or the event's repository if the event does not have a number.
+func (e *Event) MutePath() string {
+	v := url.Values{}
+	v.Set("repositoryID", strconv.Itoa(e.RepositoryID))
+	v.Set("repository", e.Repository)
+	if e.Number != 0 {
+		v.Set("number", strconv.Itoa(e.Number))
+	}
+	return "/console/mutes/new?" + v.Encode()
+}
+
+// Filter checks the event against the user's mutes active at now, and if not
+// muted, applies the first matching filter's actions to the event. The user's
+// own filters are checked before the filters of their teams, teamFilters. If
+// no filters match, the event is discarded according to defaultDiscard.
+func (e *Event) Filter(now time.Time, mutes []db.Mute, filters, teamFilters []db.Filter, defaultDiscard bool) {
+	e.Muted = false
+	for _, mute := range mutes {
+		if mute.Matches(e.RepositoryID, e.Number, now) {
+			e.Muted, e.Discarded = true, true
+			e.Urgent, e.Priority, e.Tag, e.Channels = false, 0, "", nil
 			return
 		}
 	}
+	// The user's own filters override their teams' filters.
+	for _, filters := range [][]db.Filter{filters, teamFilters} {
+		for _, filter := range filters {
+			if filter.Matches(e.RawEvent) {
+				e.Discarded = filter.OnMatchDiscard
+				e.Urgent = filter.Urgent
+				e.Priority = filter.Priority
+				e.Tag = filter.Tag
+				e.Channels = filter.Channels
+				return
+			}
+		}
+	}
 	e.Discarded = defaultDiscard // Event did not match a filter.
+	e.Urgent, e.Priority, e.Tag, e.Channels = false, 0, "", nil
+}
+
+// channels returns the event's Channels, or the DefaultChannel if it has none.
+func (e *Event) channels() []string {
+	if len(e.Channels) == 0 {
+		return []string{DefaultChannel}
+	}
+	return e.Channels
 }
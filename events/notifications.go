@@ -0,0 +1,66 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// NotificationEventType is the Type of events created from the user's GitHub
+// notifications, GitHub's Events API has no such type.
+const NotificationEventType = "NotificationEvent"
+
+// ParseNotification parses a GitHub notification thread as an event of type
+// NotificationEventType, the event's RawEvent ID is the thread's ID and its
+// payload is the notification.
+func ParseNotification(n *github.Notification) (*Event, error) {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not marshal notification")
+	}
+
+	var (
+		eventType = NotificationEventType
+		raw       = json.RawMessage(payload)
+		createdAt = n.GetUpdatedAt()
+		public    = !n.Repository.GetPrivate()
+	)
+	ghe := &github.Event{
+		ID:         n.ID,
+		Type:       &eventType,
+		CreatedAt:  &createdAt,
+		Public:     &public,
+		RawPayload: &raw,
+		Actor:      &github.User{},
+		Repo: &github.Repository{
+			ID:   n.Repository.ID,
+			Name: n.Repository.FullName,
+		},
+	}
+
+	e, err := ParseEvent(ghe)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := strings.Replace(n.GetReason(), "_", " ", -1)
+	e.Action = n.GetReason()
+	e.Subject = n.Subject.GetTitle()
+	switch n.Subject.GetType() {
+	case "Issue", "PullRequest":
+		// Subject URL is the API URL, such as https://api.github.com/repos/golang/go/issues/123
+		if number, err := strconv.Atoi(path.Base(n.Subject.GetURL())); err == nil {
+			e.Number = number
+			e.Subject = fmt.Sprintf("%s (#%d)", n.Subject.GetTitle(), number)
+		}
+	}
+	e.Title = fmt.Sprintf("[%s] %s: %s", e.Repository, reason, e.Subject)
+	// Thread IDs are reused as the thread is updated.
+	e.DedupKey = fmt.Sprintf("%s:%s:%d", NotificationEventType, n.GetID(), n.GetUpdatedAt().Unix())
+	return e, nil
+}
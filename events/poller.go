@@ -2,24 +2,32 @@ package events
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/bradleyfalzon/maintainer.me/db"
+	"github.com/bradleyfalzon/maintainer.me/ghapp"
+	"github.com/bradleyfalzon/maintainer.me/ghhost"
 	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
 )
 
-// githubBaseURL is the baseURL for github.com/google/go-github/github
-// client, variable to easily change in tests.
-var githubBaseURL = "https://api.github.com/"
+// DefaultChannel is the notifier channel used for events that were not
+// routed to any channels by a filter.
+const DefaultChannel = "default"
 
 type Poller struct {
-	logger   *logrus.Entry
-	db       db.DB
-	notifier Notifier
-	rt       http.RoundTripper
+	logger     *logrus.Entry
+	db         db.DB
+	dispatcher Dispatcher
+	hosts      ghhost.Hosts
+	rt         http.RoundTripper
+	app        *ghapp.App
 }
 
 // Notifier sends a notification about a GitHub Event.
@@ -27,12 +35,32 @@ type Notifier interface {
 	Notify(event *Event) error
 }
 
-func NewPoller(logger *logrus.Entry, db db.DB, notifier Notifier, rt http.RoundTripper) *Poller {
+// BatchNotifier is a Notifier that can send a single notification about
+// multiple events, such as those held during a user's quiet hours.
+type BatchNotifier interface {
+	Notifier
+	NotifyBatch(events Events) error
+}
+
+// Dispatcher resolves the Notifier for a user's notification channel.
+type Dispatcher interface {
+	// Notifier returns the Notifier for the user's channel, or nil if the
+	// user does not have a verified channel with that name.
+	Notifier(ctx context.Context, user db.User, channel string) (Notifier, error)
+}
+
+// NewPoller returns a Poller sending notifications to the notifiers resolved
+// by dispatcher. Users are polled using their GitHub host from hosts. If app
+// is not nil, the repositories the GitHub App is installed on are also
+// polled.
+func NewPoller(logger *logrus.Entry, db db.DB, dispatcher Dispatcher, hosts ghhost.Hosts, rt http.RoundTripper, app *ghapp.App) *Poller {
 	return &Poller{
-		logger:   logger,
-		db:       db,
-		notifier: notifier,
-		rt:       rt,
+		logger:     logger,
+		db:         db,
+		dispatcher: dispatcher,
+		hosts:      hosts,
+		rt:         rt,
+		app:        app,
 	}
 }
 
@@ -52,6 +80,15 @@ func (p *Poller) Poll(ctx context.Context, interval time.Duration) error {
 			if err != nil {
 				p.logger.WithError(err).Error("error polling users")
 			}
+			if err := p.PollSubscriptionFeeds(ctx); err != nil {
+				p.logger.WithError(err).Error("error polling subscription feeds")
+			}
+			if p.app != nil {
+				err := p.PollInstallations(ctx)
+				if err != nil {
+					p.logger.WithError(err).Error("error polling installations")
+				}
+			}
 		case <-ctx.Done():
 			p.logger.Error("poller finishing")
 			return ctx.Err()
@@ -69,11 +106,177 @@ func (p *Poller) PollUsers(ctx context.Context) error {
 	var errorCount int
 	for _, user := range users {
 		logger := p.logger.WithField("userID", user.ID)
+		if user.NotificationsPaused {
+			logger.Debug("skipping user with paused notifications")
+			continue
+		}
 		err := p.PollUser(ctx, logger, user)
+		var pollError string
 		if err != nil {
 			errorCount++
+			pollError = err.Error()
 			logger.WithError(err).Errorf("could not poll user")
 		}
+		if err := p.db.SetUsersPollStatus(ctx, user.ID, time.Now(), pollError, !tokenRejected(err)); err != nil {
+			logger.WithError(err).Error("could not set user's poll status")
+		}
+		if errorCount > 5 {
+			return errors.WithMessage(err, "too many errors")
+		}
+	}
+	return nil
+}
+
+// tokenRejected returns true if err was caused by GitHub rejecting the
+// client's token.
+func tokenRejected(err error) bool {
+	if resp, ok := errors.Cause(err).(*github.ErrorResponse); ok {
+		return resp.Response != nil && resp.Response.StatusCode == http.StatusUnauthorized
+	}
+	return false
+}
+
+// PollSubscriptionFeeds checks the events of the repositories and
+// organisations users are subscribed to. Each feed is polled once and its
+// events are sent to every subscriber.
+func (p *Poller) PollSubscriptionFeeds(ctx context.Context) error {
+	feeds, err := p.db.SubscriptionFeedsDue(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errorCount int
+	for _, feed := range feeds {
+		logger := p.logger.WithFields(logrus.Fields{
+			"feedID": feed.ID,
+			"feed":   feed.Kind + ":" + feed.Name,
+		})
+		err := p.PollSubscriptionFeed(ctx, logger, feed)
+		if err != nil {
+			errorCount++
+			logger.WithError(err).Errorf("could not poll subscription feed")
+		}
+		if errorCount > 5 {
+			return errors.WithMessage(err, "too many errors")
+		}
+	}
+	return nil
+}
+
+// PollSubscriptionFeed checks the events of a repository or organisation,
+// sending each subscriber the new events created after they subscribed.
+func (p *Poller) PollSubscriptionFeed(ctx context.Context, logger *logrus.Entry, feed db.SubscriptionFeed) error {
+	logger.Debugf("polling subscription feed")
+
+	subscriptions, err := p.db.SubscriptionFeedsSubscriptions(ctx, feed.ID)
+	if err != nil {
+		return err
+	}
+
+	var (
+		users []db.User
+		subs  []db.Subscription
+	)
+	for _, sub := range subscriptions {
+		user, err := p.db.User(ctx, sub.UserID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			continue
+		}
+		users = append(users, *user)
+		subs = append(subs, sub)
+	}
+	if len(users) == 0 {
+		return nil
+	}
+
+	// Each subscriber could see the feed when they subscribed, so any active
+	// subscriber's valid token can poll it.
+	var token *oauth2.Token
+	for _, user := range users {
+		if !user.PollPaused && !user.NotificationsPaused && user.GitHubTokenValid {
+			token = user.GitHubToken
+			break
+		}
+	}
+	if token == nil {
+		logger.Debugf("no active subscriber with a valid token, skipping subscription feed")
+		return nil
+	}
+
+	host := p.hosts.Get(feed.GitHubHost)
+	if host == nil {
+		return errors.Errorf("unknown GitHub host %q", feed.GitHubHost)
+	}
+	client := host.UserClient(ctx, p.rt, token)
+
+	lastCreatedAt := feed.CreatedAt // only events since the first subscription
+	if feed.EventLastCreatedAt != nil {
+		lastCreatedAt = *feed.EventLastCreatedAt
+	}
+
+	var source EventSource
+	switch feed.Kind {
+	case db.SubscriptionRepository:
+		source = NewRepositoryEvents(client, feed.Name)
+	case db.SubscriptionOrganization:
+		source = OrganizationEvents{Client: client, Org: feed.Name}
+	default:
+		return errors.Errorf("unknown subscription kind %q", feed.Kind)
+	}
+
+	events, pollInterval, err := source.ListNewEvents(ctx, logger, lastCreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if len(events) > 0 {
+		lastCreatedAt = events[0].CreatedAt
+	}
+	err = p.db.SetSubscriptionFeedPollResult(ctx, feed.ID, lastCreatedAt, time.Now().Add(pollInterval))
+	if err != nil {
+		return err
+	}
+
+	for i, user := range users {
+		logger := logger.WithField("userID", user.ID)
+
+		// Each subscriber filters their own copy of the events.
+		var userEvents Events
+		for _, event := range events.copy() {
+			if event.CreatedAt.After(subs[i].CreatedAt) {
+				userEvents = append(userEvents, event)
+			}
+		}
+
+		if err := p.Process(ctx, logger, user, userEvents); err != nil {
+			logger.WithError(err).Error("could not process subscription feed events")
+		}
+	}
+	return nil
+}
+
+// PollInstallations checks the events of the repositories the GitHub App is
+// installed on, sending them to the user who installed the app.
+func (p *Poller) PollInstallations(ctx context.Context) error {
+	repos, err := p.db.InstallationRepositoriesDue(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errorCount int
+	for _, repo := range repos {
+		logger := p.logger.WithFields(logrus.Fields{
+			"installationID": repo.InstallationID,
+			"repository":     repo.FullName,
+		})
+		err := p.PollInstallationRepository(ctx, logger, repo)
+		if err != nil {
+			errorCount++
+			logger.WithError(err).Errorf("could not poll installation repository")
+		}
 		if errorCount > 5 {
 			return errors.WithMessage(err, "too many errors")
 		}
@@ -81,8 +284,56 @@ func (p *Poller) PollUsers(ctx context.Context) error {
 	return nil
 }
 
+// PollInstallationRepository checks the events of a repository the GitHub
+// App is installed on.
+func (p *Poller) PollInstallationRepository(ctx context.Context, logger *logrus.Entry, repo db.InstallationRepository) error {
+	logger.Debugf("polling installation repository")
+
+	installation, err := p.db.Installation(ctx, repo.InstallationID)
+	if err != nil {
+		return err
+	}
+	if installation == nil {
+		return errors.Errorf("could not find installation %d", repo.InstallationID)
+	}
+
+	user, err := p.db.UserByGitHubID(ctx, p.app.Host().Name, installation.SenderGitHubID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		logger.Debugf("no user for installation sender %d", installation.SenderGitHubID)
+		return nil
+	}
+	logger = logger.WithField("userID", user.ID)
+
+	client, err := p.app.InstallationClient(ctx, repo.InstallationID)
+	if err != nil {
+		return errors.Wrap(err, "could not get installation client")
+	}
+
+	return p.PollSources(ctx, logger, *user, SourceCursor{
+		Name:   "installation repository",
+		Source: NewRepositoryEvents(client, repo.FullName),
+		Since:  repo.EventLastCreatedAt,
+		Save: func(ctx context.Context, lastCreatedAt, nextPoll time.Time) error {
+			return p.db.SetInstallationRepositoryPollResult(ctx, repo.InstallationID, repo.RepositoryID, lastCreatedAt, nextPoll)
+		},
+	})
+}
+
 func (p *Poller) PollUser(ctx context.Context, logger *logrus.Entry, user db.User) error {
 	logger.Debugf("polling user")
+
+	now := time.Now()
+	if user.QuietUntil(now).IsZero() {
+		if err := p.releaseHeld(ctx, logger, user, now); err != nil {
+			// New events are still polled, held notifications are
+			// released again by the next poll.
+			logger.WithError(err).Error("could not release held notifications")
+		}
+	}
+
 	if user.EventLastCreatedAt.IsZero() {
 		// This is the first poll, mark all events as read from here
 		// TODO, this isn't my responsibility, on signup this value
@@ -90,60 +341,353 @@ func (p *Poller) PollUser(ctx context.Context, logger *logrus.Entry, user db.Use
 		user.EventLastCreatedAt = time.Date(2017, 06, 30, 0, 0, 0, 0, time.FixedZone("Australia/Adelaide", 34200))
 	}
 
+	host := p.hosts.Get(user.GitHubHost)
+	if host == nil {
+		return errors.Errorf("unknown GitHub host %q", user.GitHubHost)
+	}
+	client := host.UserClient(ctx, p.rt, user.GitHubToken)
+
+	sources := []SourceCursor{{
+		Name:   "received events",
+		Source: ReceivedEvents{Client: client, Login: user.GitHubLogin},
+		Since:  user.EventLastCreatedAt,
+		Save: func(ctx context.Context, lastCreatedAt, nextPoll time.Time) error {
+			return p.db.SetUsersPollResult(ctx, user.ID, lastCreatedAt, nextPoll)
+		},
+	}}
+	if user.NotificationsEnabled {
+		sources = append(sources, SourceCursor{
+			Name:   "notifications",
+			Source: Notifications{Client: client},
+			Since:  user.NotificationsSince,
+			Save: func(ctx context.Context, lastCreatedAt, _ time.Time) error {
+				return p.db.SetUsersNotificationsSince(ctx, user.ID, lastCreatedAt)
+			},
+		})
+	}
+
+	return p.PollSources(ctx, logger, user, sources...)
+}
+
+// SourceCursor is an EventSource and the position in the source up to which
+// events have been seen.
+type SourceCursor struct {
+	Name   string // Name describes the source in logs and errors, such as "notifications".
+	Source EventSource
+	Since  time.Time // Since is the created at time of the latest event seen.
+	// Save, if not nil, stores the created at time of the latest new event,
+	// and the time the source should next be polled. Save is only called
+	// when the source has new events.
+	Save func(ctx context.Context, lastCreatedAt, nextPoll time.Time) error
+}
+
+// PollSources lists the new events of each of a user's sources and processes
+// them together, then saves each source's position. Events listed by more
+// than one source are only processed once. A source that can't be listed
+// doesn't stop the other sources' events being processed, its events are
+// listed again by the next poll.
+func (p *Poller) PollSources(ctx context.Context, logger *logrus.Entry, user db.User, sources ...SourceCursor) error {
+	type pendingSave struct {
+		source                  SourceCursor
+		lastCreatedAt, nextPoll time.Time
+	}
+	var (
+		events  Events
+		saves   []pendingSave
+		listErr error
+	)
+	for _, source := range sources {
+		logger := logger.WithField("source", source.Name)
+
+		sourceEvents, pollInterval, err := source.Source.ListNewEvents(ctx, logger, source.Since)
+		if err != nil {
+			// The first error is returned, log any others.
+			if listErr == nil {
+				listErr = errors.Wrapf(err, "could not list new events from %s", source.Name)
+			} else {
+				logger.WithError(err).Error("could not list new events")
+			}
+			continue
+		}
+
+		if len(sourceEvents) > 0 && source.Save != nil {
+			saves = append(saves, pendingSave{source, sourceEvents[0].CreatedAt, time.Now().Add(pollInterval)})
+		}
+		events = append(events, sourceEvents...)
+	}
+
+	if err := p.Process(ctx, logger, user, events.Dedup()); err != nil {
+		return err
+	}
+
+	// Only mark the events as read once they've been processed.
+	for _, save := range saves {
+		if err := save.source.Save(ctx, save.lastCreatedAt, save.nextPoll); err != nil {
+			return errors.Wrapf(err, "could not save position of %s", save.source.Name)
+		}
+	}
+	return listErr
+}
+
+// Process filters a user's new events, stores them and sends notifications
+// for the accepted events. Events already stored, such as an event received
+// by a webhook and then polled, are ignored. Events are processed the same
+// way regardless of how they were received.
+func (p *Poller) Process(ctx context.Context, logger *logrus.Entry, user db.User, events Events) error {
+	if len(events) == 0 {
+		return nil
+	}
+
 	// Get user's filters.
 	filters, err := p.db.UsersFilters(ctx, user.ID)
 	if err != nil {
 		return err
 	}
 
-	// Get oauth token.
-	// TODO do
+	// Get the filters of the user's teams.
+	teamFilters, err := p.db.UsersTeamFilters(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	// Get user's mutes.
+	mutes, err := p.db.UsersMutes(ctx, user.ID)
+	if err != nil {
+		return err
+	}
 
-	//ts := oauth2.StaticTokenSource(
-	//&oauth2.Token{AccessToken: string(user.GitHubToken)},
-	//)
-	//tc := oauth2.NewClient(ctx, ts)
-	//client := github.NewClient(tc)
+	//events.Filter(db.GHFilters(filters))
+	events.Filter(mutes, filters, teamFilters, user.FilterDefaultDiscard)
+
+	inserted, err := p.db.EventsCreate(ctx, events.dbEvents(user.ID))
+	if err != nil {
+		return errors.Wrap(err, "could not store events")
+	}
 
-	//newClient returns a github.Client using oauthconf and token.
-	//func newClient(ctx context.Context, oauthConf *oauth2.Config, token *oauth2.Token) *github.Client {
-	//oauthClient := oauthConf.Client(ctx, token)
-	//client := github.NewClient(oauthClient)
-	//client.BaseURL, _ = url.Parse(githubBaseURL)
-	//return client
-	//}
+	var created Events
+	for i, event := range events {
+		if !inserted[i] {
+			logger.Debugf("ignoring duplicate event %q", event.DedupKey)
+			continue
+		}
+		created = append(created, event)
+	}
 
-	// TODO add an underlying caching transport
-	httpClient := &http.Client{
-		Transport: p.rt,
+	if user.NotificationsPaused {
+		// Such as webhook or subscription events, which are still added to
+		// the user's inbox.
+		return nil
 	}
-	client := github.NewClient(httpClient)
 
-	events, pollInterval, err := ListNewEvents(ctx, logger, client, user.GitHubLogin, user.EventLastCreatedAt)
+	// Send notifications, most important first, holding non-urgent events
+	// during quiet hours.
+	quietUntil := user.QuietUntil(time.Now())
+	sort.SliceStable(created, func(i, j int) bool {
+		return created[i].Priority > created[j].Priority
+	})
+	for _, event := range created {
+		if event.Discarded {
+			continue
+		}
+		if !event.Urgent && !quietUntil.IsZero() {
+			if err = p.hold(ctx, user, event, quietUntil); err != nil {
+				return err
+			}
+			continue
+		}
+		p.notify(ctx, logger, user, event)
+	}
+
+	return nil
+}
+
+// notify sends an event to each of its channels, or the DefaultChannel if the
+// event has no channels. The event is stored, so it isn't polled again, and a
+// channel that can't be notified doesn't stop the other channels or events
+// being notified, instead the failure is logged and recorded.
+func (p *Poller) notify(ctx context.Context, logger *logrus.Entry, user db.User, event *Event) {
+	for _, channel := range event.channels() {
+		notifier, err := p.dispatcher.Notifier(ctx, user, channel)
+		if err != nil {
+			err = errors.Wrapf(err, "could not get notifier for channel %q", channel)
+			logger.WithError(err).Errorf("could not notify event %q", event)
+			p.deliveryFailed(ctx, logger, user, channel, err)
+			continue
+		}
+		if notifier == nil {
+			logger.Warnf("no notifier for channel %q, skipping event %q", channel, event)
+			continue
+		}
+		if err := notifier.Notify(event); err != nil {
+			logger.WithError(err).Errorf("could not notify channel %q of event %q", channel, event)
+			p.deliveryFailed(ctx, logger, user, channel, err)
+		}
+	}
+}
+
+// deliveryFailed records an error notifying a user's channel.
+func (p *Poller) deliveryFailed(ctx context.Context, logger *logrus.Entry, user db.User, channel string, err error) {
+	err = p.db.DeliveryFailureCreate(ctx, &db.DeliveryFailure{
+		UserID:  user.ID,
+		Channel: channel,
+		Error:   err.Error(),
+	})
 	if err != nil {
-		return errors.Wrap(err, "could not list new events for user")
+		logger.WithError(err).Error("could not record delivery failure")
 	}
+}
 
-	if len(events) > 0 {
-		// Mark all events as read from here.
-		err := p.db.SetUsersPollResult(ctx, user.ID, events[0].CreatedAt, time.Now().Add(pollInterval))
+// hold stores a notification for an event to be sent at deliverAt. The event
+// is stored as rendered, as not all events, such as GitHub notifications, can
+// be parsed again from a github.Event.
+func (p *Poller) hold(ctx context.Context, user db.User, event *Event, deliverAt time.Time) error {
+	rendered, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal event")
+	}
+	return p.db.HeldNotificationCreate(ctx, &db.HeldNotification{
+		UserID:      user.ID,
+		Event:       rendered,
+		Priority:    event.Priority,
+		Tag:         event.Tag,
+		ChannelsRaw: strings.Join(event.Channels, ","),
+		DeliverAt:   deliverAt,
+	})
+}
+
+// releaseHeld sends a user's held notifications that are due at now, as a
+// single batch per channel. Notifications that can't be sent to some of their
+// channels are held again for only those channels, to be retried by the next
+// poll.
+func (p *Poller) releaseHeld(ctx context.Context, logger *logrus.Entry, user db.User, now time.Time) error {
+	held, err := p.db.HeldNotificationsDue(ctx, user.ID, now)
+	if err != nil || len(held) == 0 {
+		return err
+	}
+
+	var (
+		batch      Events
+		heldIDs    []int
+		invalidIDs []int
+	)
+	for _, h := range held {
+		event, err := heldEvent(h)
 		if err != nil {
+			// Sending can't succeed later, so don't fail every poll.
+			logger.WithError(err).Errorf("discarding held notification %d", h.ID)
+			invalidIDs = append(invalidIDs, h.ID)
+			continue
+		}
+		batch = append(batch, event)
+		heldIDs = append(heldIDs, h.ID)
+	}
+
+	if len(invalidIDs) > 0 {
+		if err := p.db.HeldNotificationsDelete(ctx, user.ID, invalidIDs); err != nil {
 			return err
 		}
 	}
+	if len(batch) == 0 {
+		return nil
+	}
 
-	//events.Filter(db.GHFilters(filters))
-	events.Filter(filters, user.FilterDefaultDiscard)
+	logger.Debugf("releasing %d held notifications", len(batch))
 
-	// Send notifications.
-	for _, event := range events {
-		if event.Discarded {
+	failed := p.notifyBatch(ctx, logger, user, batch)
+	for _, event := range batch {
+		if len(failed[event]) == 0 {
 			continue
 		}
-		if err = p.notifier.Notify(event); err != nil {
+		event.Channels = failed[event]
+		if err := p.hold(ctx, user, event, now); err != nil {
 			return err
 		}
 	}
+	return p.db.HeldNotificationsDelete(ctx, user.ID, heldIDs)
+}
 
-	return nil
+// heldEvent returns the event of a held notification. Notifications held
+// before events were stored as rendered contain the github.Event, which is
+// parsed again.
+func heldEvent(h db.HeldNotification) (*Event, error) {
+	var rendered struct {
+		Title *string // Title is nil for a github.Event.
+	}
+	if err := json.Unmarshal(h.Event, &rendered); err != nil {
+		return nil, errors.Wrapf(err, "could not unmarshal held notification %d", h.ID)
+	}
+
+	if rendered.Title != nil {
+		event := &Event{}
+		if err := json.Unmarshal(h.Event, event); err != nil {
+			return nil, errors.Wrapf(err, "could not unmarshal held notification %d", h.ID)
+		}
+		return event, nil
+	}
+
+	var ghe github.Event
+	if err := json.Unmarshal(h.Event, &ghe); err != nil {
+		return nil, errors.Wrapf(err, "could not unmarshal held notification %d", h.ID)
+	}
+	event, err := ParseEvent(&ghe)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse held notification %d", h.ID)
+	}
+	event.Priority, event.Tag = h.Priority, h.Tag
+	if h.ChannelsRaw != "" {
+		event.Channels = strings.Split(h.ChannelsRaw, ",")
+	}
+	return event, nil
+}
+
+// notifyBatch sends events to their channels, using a single notification
+// per channel if the channel's notifier is a BatchNotifier. A channel that
+// can't be notified doesn't stop the other channels being notified, instead
+// the failure is logged and recorded. Returns the channels each event
+// couldn't be sent to.
+func (p *Poller) notifyBatch(ctx context.Context, logger *logrus.Entry, user db.User, events Events) map[*Event][]string {
+	var (
+		channels  []string
+		byChannel = make(map[string]Events)
+	)
+	for _, event := range events {
+		for _, channel := range event.channels() {
+			if _, ok := byChannel[channel]; !ok {
+				channels = append(channels, channel)
+			}
+			byChannel[channel] = append(byChannel[channel], event)
+		}
+	}
+
+	failed := make(map[*Event][]string)
+	fail := func(channel string, events Events, err error) {
+		logger.WithError(err).Errorf("could not notify channel %q of %d events", channel, len(events))
+		p.deliveryFailed(ctx, logger, user, channel, err)
+		for _, event := range events {
+			failed[event] = append(failed[event], channel)
+		}
+	}
+	for _, channel := range channels {
+		notifier, err := p.dispatcher.Notifier(ctx, user, channel)
+		if err != nil {
+			fail(channel, byChannel[channel], errors.Wrapf(err, "could not get notifier for channel %q", channel))
+			continue
+		}
+		if notifier == nil {
+			logger.Warnf("no notifier for channel %q, skipping %d events", channel, len(byChannel[channel]))
+			continue
+		}
+		if batcher, ok := notifier.(BatchNotifier); ok {
+			if err := batcher.NotifyBatch(byChannel[channel]); err != nil {
+				fail(channel, byChannel[channel], err)
+			}
+			continue
+		}
+		for _, event := range byChannel[channel] {
+			if err := notifier.Notify(event); err != nil {
+				fail(channel, Events{event}, err)
+			}
+		}
+	}
+	return failed
 }
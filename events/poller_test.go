@@ -0,0 +1,485 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/bradleyfalzon/maintainer.me/db"
+	"github.com/bradleyfalzon/maintainer.me/db/memdb"
+	"github.com/bradleyfalzon/maintainer.me/ghhost"
+	"golang.org/x/oauth2"
+)
+
+// fakeGitHub is a GitHub API serving the events added to it.
+type fakeGitHub struct {
+	mu             sync.Mutex
+	events         map[string][]json.RawMessage // events by path, such as "/users/alice/received_events"
+	authorizations []string                     // authorizations are the Authorization headers of requests
+}
+
+func (gh *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	gh.authorizations = append(gh.authorizations, r.Header.Get("Authorization"))
+	events, ok := gh.events[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("X-Poll-Interval", "60")
+	json.NewEncoder(w).Encode(events)
+}
+
+// addIssuesEvent adds an IssuesEvent about issue number in repo to the
+// events at path, newest first.
+func (gh *fakeGitHub) addIssuesEvent(path, repo, actor string, number int, createdAt time.Time) {
+	event := fmt.Sprintf(`{
+		"id": "%d", "type": "IssuesEvent", "public": true, "created_at": %q,
+		"actor": {"login": %q}, "repo": {"id": 1, "name": %q},
+		"payload": {"action": "opened", "issue": {"id": %d, "number": %d, "title": "flaky test", "updated_at": %[2]q}}
+	}`, number, createdAt.UTC().Format(time.RFC3339), actor, repo, 1000+number, number)
+
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	gh.events[path] = append([]json.RawMessage{json.RawMessage(event)}, gh.events[path]...)
+}
+
+func (gh *fakeGitHub) requestAuthorizations() []string {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+	return gh.authorizations
+}
+
+// recorder is a Dispatcher whose notifiers record the events sent to each
+// channel.
+type recorder struct {
+	mu      sync.Mutex
+	events  map[string]Events // events by channel
+	failing map[string]bool   // channels whose notifiers return an error
+}
+
+func (rec *recorder) Notifier(ctx context.Context, user db.User, channel string) (Notifier, error) {
+	return recorderNotifier{rec, channel}, nil
+}
+
+func (rec *recorder) channel(channel string) Events {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.events[channel]
+}
+
+type recorderNotifier struct {
+	rec     *recorder
+	channel string
+}
+
+func (n recorderNotifier) Notify(event *Event) error {
+	return n.NotifyBatch(Events{event})
+}
+
+func (n recorderNotifier) NotifyBatch(events Events) error {
+	n.rec.mu.Lock()
+	defer n.rec.mu.Unlock()
+	if n.rec.failing[n.channel] {
+		return errors.New("channel is broken")
+	}
+	n.rec.events[n.channel] = append(n.rec.events[n.channel], events...)
+	return nil
+}
+
+// testPoller is a Poller using an in-memory DB and a fake GitHub host, named
+// "github.example.com".
+type testPoller struct {
+	*Poller
+	db  *memdb.DB
+	gh  *fakeGitHub
+	rec *recorder
+	srv *httptest.Server
+}
+
+func newTestPoller(t *testing.T) *testPoller {
+	gh := &fakeGitHub{events: make(map[string][]json.RawMessage)}
+	srv := httptest.NewServer(http.StripPrefix("/api/v3", gh))
+
+	host, err := ghhost.NewEnterprise(ghhost.EnterpriseConfig{
+		Name:              "github.example.com",
+		URL:               srv.URL,
+		OAuthClientID:     "client-id",
+		OAuthClientSecret: "client-secret",
+	})
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	var (
+		mdb = memdb.New()
+		rec = &recorder{events: make(map[string]Events), failing: make(map[string]bool)}
+	)
+	return &testPoller{
+		Poller: NewPoller(logrus.NewEntry(logger), mdb, rec, ghhost.Hosts{host}, http.DefaultTransport, nil),
+		db:     mdb,
+		gh:     gh,
+		rec:    rec,
+		srv:    srv,
+	}
+}
+
+// newTestUser logs in a user to the poller's host, who accepts events that
+// don't match their filters.
+func newTestUser(t *testing.T, mdb *memdb.DB, githubID int, login string) *db.User {
+	ctx := context.Background()
+	userID, err := mdb.GitHubLogin(ctx, "github.example.com", login+"@example.com", githubID, login, &oauth2.Token{AccessToken: "token-" + login})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := mdb.User(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.FilterDefaultDiscard = false
+	if err := mdb.UserUpdate(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// deliveryFailures returns the number of delivery failures recorded for a
+// user.
+func deliveryFailures(t *testing.T, mdb *memdb.DB, userID int) int {
+	users, err := mdb.AdminUsers(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range users {
+		if user.ID == userID {
+			return user.DeliveryFailures
+		}
+	}
+	t.Fatalf("user %d not found", userID)
+	return 0
+}
+
+func TestPollUser(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		poller = newTestPoller(t)
+		user   = newTestUser(t, poller.db, 1, "alice")
+	)
+	defer poller.srv.Close()
+	// Events before the user logged in are ignored.
+	poller.gh.addIssuesEvent("/users/alice/received_events", "golang/go", "bob", 4, time.Now().Add(-time.Minute))
+	poller.gh.addIssuesEvent("/users/alice/received_events", "golang/go", "bob", 5, time.Now().Add(time.Second))
+
+	if err := poller.PollUser(ctx, poller.logger, *user); err != nil {
+		t.Fatalf("PollUser returned error: %v", err)
+	}
+
+	want := "[golang/go] bob opened flaky test (#5)"
+	if got := poller.rec.channel(DefaultChannel); len(got) != 1 || got[0].Title != want {
+		t.Fatalf("PollUser notified %q, want %q", got, want)
+	}
+	stored, err := poller.db.UsersEvents(ctx, user.ID, db.EventQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].Title != want || stored[0].Number != 5 || stored[0].Discarded {
+		t.Errorf("PollUser stored %+v, want the accepted event %q", stored, want)
+	}
+
+	// The next poll only sees the new events.
+	user, err = poller.db.User(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poller.gh.addIssuesEvent("/users/alice/received_events", "golang/go", "bob", 6, time.Now().Add(2*time.Second))
+	if err := poller.PollUser(ctx, poller.logger, *user); err != nil {
+		t.Fatalf("PollUser returned error: %v", err)
+	}
+	if got := poller.rec.channel(DefaultChannel); len(got) != 2 || got[1].Number != 6 {
+		t.Errorf("second PollUser notified %q, want only the new event", got)
+	}
+}
+
+func TestPollUserFilters(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		poller = newTestPoller(t)
+		user   = newTestUser(t, poller.db, 1, "alice")
+	)
+	defer poller.srv.Close()
+
+	filter := &db.Filter{UserID: user.ID, Urgent: true, Priority: 2, Tag: "ci"}
+	filter.SetChannels([]string{"slack"})
+	filterID, err := poller.db.FilterCreate(ctx, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := poller.db.ConditionCreate(ctx, &db.Condition{FilterID: filterID, Type: "IssuesEvent"}); err != nil {
+		t.Fatal(err)
+	}
+	poller.gh.addIssuesEvent("/users/alice/received_events", "golang/go", "bob", 5, time.Now().Add(time.Second))
+
+	if err := poller.PollUser(ctx, poller.logger, *user); err != nil {
+		t.Fatalf("PollUser returned error: %v", err)
+	}
+
+	if got := poller.rec.channel(DefaultChannel); len(got) != 0 {
+		t.Errorf("PollUser notified the default channel of %q, want the filter's channel", got)
+	}
+	got := poller.rec.channel("slack")
+	if len(got) != 1 || !got[0].Urgent || got[0].Priority != 2 || got[0].Tag != "ci" {
+		t.Errorf("PollUser notified the filter's channel of %+v, want the event with the filter's actions", got)
+	}
+}
+
+func TestHoldRelease(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		poller = newTestPoller(t)
+		user   = newTestUser(t, poller.db, 1, "alice")
+	)
+	defer poller.srv.Close()
+
+	// A GitHub notification, which can't be parsed again from a github.Event.
+	event := &Event{
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+		Type:       "Notification",
+		Repository: "golang/go",
+		Number:     5,
+		Priority:   2,
+		Tag:        "ci",
+		Channels:   []string{"slack"},
+		Action:     "mentioned",
+		Title:      "[golang/go] mentioned in flaky test (#5)",
+		DedupKey:   "notification 1",
+	}
+	if err := poller.hold(ctx, *user, event, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("hold returned error: %v", err)
+	}
+	err := poller.db.HeldNotificationCreate(ctx, &db.HeldNotification{UserID: user.ID, Event: []byte("{"), DeliverAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The invalid notification is discarded, not retried by every poll.
+	for i := 0; i < 2; i++ {
+		if err := poller.releaseHeld(ctx, poller.logger, *user, time.Now()); err != nil {
+			t.Fatalf("releaseHeld returned error: %v", err)
+		}
+	}
+
+	got := poller.rec.channel("slack")
+	if len(got) != 1 || !reflect.DeepEqual(got[0], event) {
+		t.Errorf("releaseHeld notified %+v, want %+v", got, event)
+	}
+	held, err := poller.db.HeldNotificationsDue(ctx, user.ID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(held) != 0 {
+		t.Errorf("releaseHeld left %d held notifications, want 0", len(held))
+	}
+}
+
+func TestHoldReleaseFailingChannel(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		poller = newTestPoller(t)
+		user   = newTestUser(t, poller.db, 1, "alice")
+	)
+	defer poller.srv.Close()
+	poller.rec.failing["broken"] = true
+
+	events := Events{
+		{CreatedAt: time.Now().UTC(), Type: "IssuesEvent", Title: "[golang/go] bob opened flaky test (#5)", Channels: []string{"broken", "slack"}, DedupKey: "event 1"},
+		{CreatedAt: time.Now().UTC(), Type: "IssuesEvent", Title: "[golang/go] bob opened slow test (#6)", Channels: []string{"slack"}, DedupKey: "event 2"},
+	}
+	for _, event := range events {
+		if err := poller.hold(ctx, *user, event, time.Now().Add(-time.Minute)); err != nil {
+			t.Fatalf("hold returned error: %v", err)
+		}
+	}
+
+	if err := poller.releaseHeld(ctx, poller.logger, *user, time.Now()); err != nil {
+		t.Fatalf("releaseHeld returned error: %v", err)
+	}
+	if got := poller.rec.channel("slack"); len(got) != 2 {
+		t.Errorf("releaseHeld notified slack of %d events, want 2", len(got))
+	}
+	if got := deliveryFailures(t, poller.db, user.ID); got != 1 {
+		t.Errorf("releaseHeld recorded %d delivery failures, want 1", got)
+	}
+	held, err := poller.db.HeldNotificationsDue(ctx, user.ID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(held) != 1 || held[0].ChannelsRaw != "broken" {
+		t.Fatalf("releaseHeld left held notifications %+v, want the first event held for the broken channel", held)
+	}
+
+	// Once the channel is fixed, only it is sent the event.
+	poller.rec.failing["broken"] = false
+	if err := poller.releaseHeld(ctx, poller.logger, *user, time.Now()); err != nil {
+		t.Fatalf("releaseHeld returned error: %v", err)
+	}
+	if got := poller.rec.channel("broken"); len(got) != 1 || got[0].Title != events[0].Title {
+		t.Errorf("releaseHeld notified the fixed channel of %v, want the first event", got)
+	}
+	if got := poller.rec.channel("slack"); len(got) != 2 {
+		t.Errorf("releaseHeld notified slack of %d events, want 2", len(got))
+	}
+	held, err = poller.db.HeldNotificationsDue(ctx, user.ID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(held) != 0 {
+		t.Errorf("releaseHeld left %d held notifications, want 0", len(held))
+	}
+}
+
+func TestPollSubscriptionFeedToken(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		poller = newTestPoller(t)
+		alice  = newTestUser(t, poller.db, 1, "alice")
+		bob    = newTestUser(t, poller.db, 2, "bob")
+		carol  = newTestUser(t, poller.db, 3, "carol")
+	)
+	defer poller.srv.Close()
+
+	for _, user := range []*db.User{alice, bob, carol} {
+		sub := &db.Subscription{UserID: user.ID, Kind: db.SubscriptionRepository, Name: "golang/go"}
+		if _, err := poller.db.SubscriptionCreate(ctx, sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+	feeds, err := poller.db.SubscriptionFeedsDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 {
+		t.Fatalf("SubscriptionFeedsDue returned %d feeds, want 1", len(feeds))
+	}
+	poller.gh.addIssuesEvent("/repos/golang/go/events", "golang/go", "dave", 5, time.Now().Add(time.Second))
+
+	// Only carol is active with a valid token.
+	if err := poller.db.SetUsersPollStatus(ctx, alice.ID, time.Now(), "bad credentials", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := poller.db.UserPollPausedUpdate(ctx, bob.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := poller.PollSubscriptionFeed(ctx, poller.logger, feeds[0]); err != nil {
+		t.Fatalf("PollSubscriptionFeed returned error: %v", err)
+	}
+	if got, want := poller.gh.requestAuthorizations(), []string{"Bearer token-carol"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PollSubscriptionFeed requested with authorizations %q, want %q", got, want)
+	}
+
+	// Without an active subscriber with a valid token, the feed is skipped.
+	if err := poller.db.UserNotificationsPausedUpdate(ctx, carol.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := poller.PollSubscriptionFeed(ctx, poller.logger, feeds[0]); err != nil {
+		t.Fatalf("PollSubscriptionFeed returned error: %v", err)
+	}
+	if got := poller.gh.requestAuthorizations(); len(got) != 1 {
+		t.Errorf("PollSubscriptionFeed without an active subscriber made %d requests, want none", len(got)-1)
+	}
+}
+
+// staticSource is an EventSource listing its events, or its error.
+type staticSource struct {
+	events Events
+	err    error
+}
+
+func (s staticSource) ListNewEvents(ctx context.Context, logger *logrus.Entry, since time.Time) (Events, time.Duration, error) {
+	return s.events, time.Minute, s.err
+}
+
+func TestPollSourcesFailingSource(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		poller = newTestPoller(t)
+		user   = newTestUser(t, poller.db, 1, "alice")
+		saved  = make(map[string]time.Time)
+	)
+	defer poller.srv.Close()
+
+	event := &Event{CreatedAt: time.Now().UTC().Truncate(time.Second), Type: "IssuesEvent", Title: "[golang/go] bob opened flaky test (#5)", DedupKey: "event 1"}
+	cursor := func(name string, source EventSource) SourceCursor {
+		return SourceCursor{
+			Name:   name,
+			Source: source,
+			Save: func(ctx context.Context, lastCreatedAt, nextPoll time.Time) error {
+				saved[name] = lastCreatedAt
+				return nil
+			},
+		}
+	}
+
+	err := poller.PollSources(ctx, poller.logger, *user,
+		cursor("received events", staticSource{events: Events{event}}),
+		cursor("notifications", staticSource{err: errors.New("401 Bad credentials")}),
+	)
+	if err == nil {
+		t.Error("PollSources returned no error, want the failing source's error")
+	}
+
+	if got := poller.rec.channel(DefaultChannel); len(got) != 1 || got[0] != event {
+		t.Errorf("PollSources notified %v, want the working source's event", got)
+	}
+	want := map[string]time.Time{"received events": event.CreatedAt}
+	if !reflect.DeepEqual(saved, want) {
+		t.Errorf("PollSources saved %v, want %v", saved, want)
+	}
+}
+
+func TestPollUserFailingChannel(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		poller = newTestPoller(t)
+		user   = newTestUser(t, poller.db, 1, "alice")
+	)
+	defer poller.srv.Close()
+	poller.rec.failing["broken"] = true
+
+	filter := &db.Filter{UserID: user.ID}
+	filter.SetChannels([]string{"broken", "slack"})
+	filterID, err := poller.db.FilterCreate(ctx, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := poller.db.ConditionCreate(ctx, &db.Condition{FilterID: filterID, Type: "IssuesEvent"}); err != nil {
+		t.Fatal(err)
+	}
+
+	poller.gh.addIssuesEvent("/users/alice/received_events", "golang/go", "bob", 5, time.Now().Add(time.Second))
+	poller.gh.addIssuesEvent("/users/alice/received_events", "golang/go", "bob", 6, time.Now().Add(2*time.Second))
+
+	if err := poller.PollUser(ctx, poller.logger, *user); err != nil {
+		t.Fatalf("PollUser returned error: %v", err)
+	}
+
+	if got := poller.rec.channel("slack"); len(got) != 2 {
+		t.Errorf("PollUser notified slack of %d events, want 2", len(got))
+	}
+	if got := deliveryFailures(t, poller.db, user.ID); got != 2 {
+		t.Errorf("PollUser recorded %d delivery failures, want 2", got)
+	}
+}
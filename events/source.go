@@ -0,0 +1,130 @@
+package events
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// EventSource is a source of events, such as a GitHub events feed.
+type EventSource interface {
+	// ListNewEvents lists the events created after since, newest first, and
+	// how long until the source should be polled again, 0 if the source has
+	// no preference.
+	ListNewEvents(ctx context.Context, logger *logrus.Entry, since time.Time) (events Events, pollInterval time.Duration, err error)
+}
+
+// ReceivedEvents is the EventSource of events received by a GitHub user,
+// from the repositories they watch and the users they follow.
+type ReceivedEvents struct {
+	Client *github.Client
+	Login  string // Login is the user's GitHub login, such as "bradleyfalzon".
+}
+
+// ListNewEvents implements the EventSource interface.
+func (s ReceivedEvents) ListNewEvents(ctx context.Context, logger *logrus.Entry, since time.Time) (events Events, pollInterval time.Duration, err error) {
+	events, pollInterval, err = listNewEvents(ctx, logger, since, func(ctx context.Context, opt *github.ListOptions) ([]*github.Event, *github.Response, error) {
+		return s.Client.Activity.ListEventsReceivedByUser(ctx, s.Login, false, opt)
+	})
+	return events, pollInterval, errors.Wrapf(err, "could not get GitHub events for user %q", s.Login)
+}
+
+// RepositoryEvents is the EventSource of events in a GitHub repository.
+type RepositoryEvents struct {
+	Client *github.Client
+	Owner  string
+	Repo   string
+}
+
+// NewRepositoryEvents returns the EventSource of the repository with
+// fullName, such as "golang/go".
+func NewRepositoryEvents(client *github.Client, fullName string) RepositoryEvents {
+	owner, repo := fullName, ""
+	if i := strings.Index(fullName, "/"); i > 0 {
+		owner, repo = fullName[:i], fullName[i+1:]
+	}
+	return RepositoryEvents{Client: client, Owner: owner, Repo: repo}
+}
+
+// ListNewEvents implements the EventSource interface.
+func (s RepositoryEvents) ListNewEvents(ctx context.Context, logger *logrus.Entry, since time.Time) (events Events, pollInterval time.Duration, err error) {
+	events, pollInterval, err = listNewEvents(ctx, logger, since, func(ctx context.Context, opt *github.ListOptions) ([]*github.Event, *github.Response, error) {
+		return s.Client.Activity.ListRepositoryEvents(ctx, s.Owner, s.Repo, opt)
+	})
+	return events, pollInterval, errors.Wrapf(err, "could not get GitHub events for repository %s/%s", s.Owner, s.Repo)
+}
+
+// OrganizationEvents is the EventSource of public events in a GitHub
+// organisation.
+type OrganizationEvents struct {
+	Client *github.Client
+	Org    string
+}
+
+// ListNewEvents implements the EventSource interface.
+func (s OrganizationEvents) ListNewEvents(ctx context.Context, logger *logrus.Entry, since time.Time) (events Events, pollInterval time.Duration, err error) {
+	events, pollInterval, err = listNewEvents(ctx, logger, since, func(ctx context.Context, opt *github.ListOptions) ([]*github.Event, *github.Response, error) {
+		return s.Client.Activity.ListEventsForOrganization(ctx, s.Org, opt)
+	})
+	return events, pollInterval, errors.Wrapf(err, "could not get GitHub events for organization %q", s.Org)
+}
+
+// Notifications is the EventSource of a GitHub user's unread notification
+// threads, see ParseNotification. Requires the client to be authenticated as
+// the user with the notifications scope.
+type Notifications struct {
+	Client *github.Client
+}
+
+// ListNewEvents implements the EventSource interface.
+func (s Notifications) ListNewEvents(ctx context.Context, logger *logrus.Entry, since time.Time) (events Events, pollInterval time.Duration, err error) {
+	opt := &github.NotificationListOptions{
+		Since:       since,
+		ListOptions: github.ListOptions{Page: 1},
+	}
+
+	for {
+		start := time.Now()
+		notifications, response, err := s.Client.Activity.ListNotifications(ctx, opt)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "could not get GitHub notifications")
+		}
+		logger.Debugf("polled notifications page %v in %v", opt.Page, time.Since(start))
+
+		if pollInt, err := strconv.Atoi(response.Header.Get("X-Poll-Interval")); err == nil {
+			pollInterval = time.Duration(pollInt) * time.Second
+		}
+
+		for _, notification := range notifications {
+			event, err := ParseNotification(notification)
+			if err != nil {
+				return nil, 0, err
+			}
+			events = append(events, event)
+		}
+
+		if response.NextPage == 0 {
+			break
+		}
+		opt.Page = response.NextPage
+	}
+	return events, pollInterval, nil
+}
+
+// ListNewEvents implements the EventSource interface, returning the events
+// created after since. Events may be used as a source of events that have
+// already been received, such as by a webhook.
+func (e Events) ListNewEvents(ctx context.Context, logger *logrus.Entry, since time.Time) (Events, time.Duration, error) {
+	var events Events
+	for _, event := range e {
+		if !haveObserved(since, event.CreatedAt) {
+			events = append(events, event)
+		}
+	}
+	return events, 0, nil
+}
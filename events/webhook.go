@@ -0,0 +1,85 @@
+package events
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// webhookPayload contains the fields common to webhook payloads that are
+// part of an event, rather than its payload, when received via the Events
+// API.
+type webhookPayload struct {
+	Repository   *webhookRepository   `json:"repository"`
+	Organization *github.Organization `json:"organization"`
+	Sender       *github.User         `json:"sender"`
+	Installation *github.Installation `json:"installation"` // Installation is set for GitHub App webhooks.
+}
+
+// WebhookInstallationID returns the GitHub App installation ID of a webhook
+// payload, or 0 if the webhook was not sent to a GitHub App.
+func WebhookInstallationID(payload []byte) (int, error) {
+	var wp webhookPayload
+	if err := json.Unmarshal(payload, &wp); err != nil {
+		return 0, errors.Wrap(err, "could not unmarshal webhook payload")
+	}
+	return wp.Installation.GetID(), nil
+}
+
+type webhookRepository struct {
+	ID       *int    `json:"id"`
+	FullName *string `json:"full_name"`
+	Private  *bool   `json:"private"`
+}
+
+// ParseWebhook parses a GitHub webhook's payload as if it was received via
+// the Events API. hookType is the X-GitHub-Event header, such as
+// "issue_comment", and deliveryID is the X-GitHub-Delivery header. The
+// event's CreatedAt is the time the webhook was received.
+func ParseWebhook(hookType, deliveryID string, payload []byte) (*Event, error) {
+	var wp webhookPayload
+	if err := json.Unmarshal(payload, &wp); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal webhook payload")
+	}
+
+	var (
+		eventType = WebhookEventType(hookType)
+		id        = "delivery:" + deliveryID
+		createdAt = time.Now()
+		raw       = json.RawMessage(payload)
+		public    = true
+	)
+	ghe := &github.Event{
+		ID:         &id,
+		Type:       &eventType,
+		CreatedAt:  &createdAt,
+		RawPayload: &raw,
+		Actor:      wp.Sender,
+		Org:        wp.Organization,
+		Repo:       &github.Repository{},
+	}
+	if wp.Repository != nil {
+		ghe.Repo.ID = wp.Repository.ID
+		ghe.Repo.Name = wp.Repository.FullName
+		public = wp.Repository.Private == nil || !*wp.Repository.Private
+	}
+	ghe.Public = &public
+
+	return ParseEvent(ghe)
+}
+
+// WebhookEventType returns the Events API type for a webhook's X-GitHub-Event
+// header, such as "IssueCommentEvent" for "issue_comment".
+func WebhookEventType(hookType string) string {
+	var eventType string
+	for _, word := range strings.Split(hookType, "_") {
+		if word == "" {
+			continue
+		}
+		eventType += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return eventType + "Event"
+}
@@ -0,0 +1,159 @@
+// Package ghapp authenticates as a GitHub App and its installations.
+package ghapp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bradleyfalzon/maintainer.me/ghhost"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// acceptHeader is the media type required to access the GitHub App API
+// during its preview period.
+const acceptHeader = "application/vnd.github.machine-man-preview+json"
+
+// tokenExpiryMargin is how long before an installation token expires that a
+// new token is created.
+const tokenExpiryMargin = 5 * time.Minute
+
+// App is a GitHub App, it creates and caches installation tokens and is safe
+// for concurrent use.
+type App struct {
+	id   int
+	key  *rsa.PrivateKey
+	host *ghhost.Host
+	rt   http.RoundTripper
+
+	mu     sync.Mutex
+	tokens map[int]*oauth2.Token // installation ID to token
+}
+
+// NewApp returns a GitHub App registered on host with the app's ID and PEM
+// encoded private key. Requests to GitHub use rt, if nil
+// http.DefaultTransport is used.
+func NewApp(id int, keyPEM []byte, host *ghhost.Host, rt http.RoundTripper) (*App, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("could not decode PEM private key")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse private key")
+	}
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &App{
+		id:     id,
+		key:    key,
+		host:   host,
+		rt:     rt,
+		tokens: make(map[int]*oauth2.Token),
+	}, nil
+}
+
+// Host returns the host the app is registered on.
+func (a *App) Host() *ghhost.Host {
+	return a.host
+}
+
+// JWT returns a JSON Web Token, signed with RS256, authenticating as the app
+// until shortly after now.
+func (a *App) JWT(now time.Time) (string, error) {
+	header, err := json.Marshal(struct {
+		Alg string `json:"alg"`
+		Typ string `json:"typ"`
+	}{"RS256", "JWT"})
+	if err != nil {
+		return "", errors.Wrap(err, "could not marshal JWT header")
+	}
+
+	claims, err := json.Marshal(struct {
+		IssuedAt  int64 `json:"iat"`
+		ExpiresAt int64 `json:"exp"`
+		Issuer    int   `json:"iss"`
+	}{
+		IssuedAt:  now.Add(-time.Minute).Unix(), // allow for clock drift
+		ExpiresAt: now.Add(9 * time.Minute).Unix(),
+		Issuer:    a.id,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "could not marshal JWT claims")
+	}
+
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", errors.Wrap(err, "could not sign JWT")
+	}
+
+	return signed + "." + enc.EncodeToString(sig), nil
+}
+
+// InstallationToken returns an access token for the installation, reusing
+// a previous token until it's about to expire.
+func (a *App) InstallationToken(ctx context.Context, installationID int) (*oauth2.Token, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if token, ok := a.tokens[installationID]; ok && time.Now().Add(tokenExpiryMargin).Before(token.Expiry) {
+		return token, nil
+	}
+
+	jwt, err := a.JWT(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	client := a.host.Client(&http.Client{Transport: a.rt})
+	req, err := client.NewRequest("POST", fmt.Sprintf("installations/%d/access_tokens", installationID), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create installation token request")
+	}
+	req.Header.Set("Accept", acceptHeader)
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	var resp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if _, err := client.Do(ctx, req, &resp); err != nil {
+		return nil, errors.Wrapf(err, "could not create token for installation %d", installationID)
+	}
+
+	token := &oauth2.Token{AccessToken: resp.Token, TokenType: "token", Expiry: resp.ExpiresAt}
+	a.tokens[installationID] = token
+	return token, nil
+}
+
+// InstallationClient returns a GitHub client authenticated as the
+// installation.
+func (a *App) InstallationClient(ctx context.Context, installationID int) (*github.Client, error) {
+	token, err := a.InstallationToken(ctx, installationID)
+	if err != nil {
+		return nil, err
+	}
+	return a.host.Client(&http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(token),
+			Base:   a.rt,
+		},
+	}), nil
+}
@@ -0,0 +1,220 @@
+// Package ghhost configures the GitHub.com and GitHub Enterprise Server hosts
+// users log in with and whose APIs are polled.
+package ghhost
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	ghoauth "golang.org/x/oauth2/github"
+)
+
+// GitHubCom is the name of the GitHub.com host.
+const GitHubCom = "github.com"
+
+// scopes are the OAuth scopes requested from each host.
+var scopes = []string{"user:email", "notifications"}
+
+// Host is a GitHub.com or GitHub Enterprise Server instance.
+type Host struct {
+	Name      string // Name identifies the host, such as "github.com" or "github.example.com".
+	WebURL    string // WebURL is the URL of the web interface, such as "https://github.com/".
+	APIURL    string // APIURL is the URL of the REST API, such as "https://api.github.com/".
+	UploadURL string // UploadURL is the URL for uploads, such as "https://uploads.github.com/".
+	OAuth     *oauth2.Config
+
+	apiURL    *url.URL
+	uploadURL *url.URL
+}
+
+// NewGitHubCom returns the GitHub.com host, authenticating users with the
+// OAuth application's client ID and secret.
+func NewGitHubCom(clientID, clientSecret string) *Host {
+	h := &Host{
+		Name:      GitHubCom,
+		WebURL:    "https://github.com/",
+		APIURL:    "https://api.github.com/",
+		UploadURL: "https://uploads.github.com/",
+		OAuth: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     ghoauth.Endpoint,
+			Scopes:       scopes,
+		},
+	}
+	h.apiURL, _ = url.Parse(h.APIURL)
+	h.uploadURL, _ = url.Parse(h.UploadURL)
+	return h
+}
+
+// EnterpriseConfig is the configuration of a GitHub Enterprise Server host.
+// Only Name, URL and the OAuth client ID and secret are required, the other
+// endpoints default to those relative to URL.
+type EnterpriseConfig struct {
+	Name              string `json:"name"`
+	URL               string `json:"url"`        // such as "https://github.example.com/"
+	APIURL            string `json:"api_url"`    // defaults to URL + "api/v3/"
+	UploadURL         string `json:"upload_url"` // defaults to URL + "api/uploads/"
+	AuthURL           string `json:"auth_url"`   // defaults to URL + "login/oauth/authorize"
+	TokenURL          string `json:"token_url"`  // defaults to URL + "login/oauth/access_token"
+	OAuthClientID     string `json:"oauth_client_id"`
+	OAuthClientSecret string `json:"oauth_client_secret"`
+}
+
+// NewEnterprise returns a GitHub Enterprise Server host.
+func NewEnterprise(config EnterpriseConfig) (*Host, error) {
+	switch {
+	case config.Name == "":
+		return nil, errors.New("name is required")
+	case config.Name == GitHubCom:
+		return nil, errors.Errorf("name %q is reserved", GitHubCom)
+	case config.URL == "":
+		return nil, errors.Errorf("url is required for host %q", config.Name)
+	case config.OAuthClientID == "" || config.OAuthClientSecret == "":
+		return nil, errors.Errorf("oauth_client_id and oauth_client_secret are required for host %q", config.Name)
+	}
+
+	webURL := strings.TrimRight(config.URL, "/") + "/"
+	orDefault := func(value, path string) string {
+		if value != "" {
+			return value
+		}
+		return webURL + path
+	}
+
+	h := &Host{
+		Name:      config.Name,
+		WebURL:    webURL,
+		APIURL:    orDefault(config.APIURL, "api/v3/"),
+		UploadURL: orDefault(config.UploadURL, "api/uploads/"),
+		OAuth: &oauth2.Config{
+			ClientID:     config.OAuthClientID,
+			ClientSecret: config.OAuthClientSecret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  orDefault(config.AuthURL, "login/oauth/authorize"),
+				TokenURL: orDefault(config.TokenURL, "login/oauth/access_token"),
+			},
+			Scopes: scopes,
+		},
+	}
+
+	var err error
+	if h.apiURL, err = parseBaseURL(h.APIURL); err != nil {
+		return nil, errors.Wrapf(err, "invalid api_url for host %q", h.Name)
+	}
+	if h.uploadURL, err = parseBaseURL(h.UploadURL); err != nil {
+		return nil, errors.Wrapf(err, "invalid upload_url for host %q", h.Name)
+	}
+	return h, nil
+}
+
+// parseBaseURL parses a go-github base URL, which must have a trailing slash.
+func parseBaseURL(rawurl string) (*url.URL, error) {
+	if !strings.HasSuffix(rawurl, "/") {
+		rawurl += "/"
+	}
+	return url.Parse(rawurl)
+}
+
+// Client returns a GitHub API client for the host, using httpClient to make
+// requests.
+func (h *Host) Client(httpClient *http.Client) *github.Client {
+	client := github.NewClient(httpClient)
+	client.BaseURL = h.apiURL
+	client.UploadURL = h.uploadURL
+	return client
+}
+
+// UserClient returns a GitHub API client for the host authenticated as the
+// user with token, using rt as the underlying transport.
+func (h *Host) UserClient(ctx context.Context, rt http.RoundTripper, token *oauth2.Token) *github.Client {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: rt})
+	return h.Client(h.OAuth.Client(ctx, token))
+}
+
+// TokenScopes returns the OAuth scopes granted to a user's token, tokens
+// granted before a scope was requested lack it until the user logs in again.
+func (h *Host) TokenScopes(ctx context.Context, rt http.RoundTripper, token *oauth2.Token) ([]string, error) {
+	_, resp, err := h.UserClient(ctx, rt, token).Users.Get(ctx, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get authenticated user")
+	}
+
+	var granted []string
+	for _, scope := range strings.Split(resp.Header.Get("X-OAuth-Scopes"), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			granted = append(granted, scope)
+		}
+	}
+	return granted, nil
+}
+
+// CanReadNotifications returns true if the granted scopes, such as returned by
+// TokenScopes, allow reading the user's notifications.
+func CanReadNotifications(granted []string) bool {
+	for _, scope := range granted {
+		if scope == "notifications" || scope == "repo" {
+			return true
+		}
+	}
+	return false
+}
+
+// RevokeToken revokes the user's token, removing the OAuth application's
+// access to the user's account. Authenticates as the OAuth application, using
+// rt as the underlying transport.
+func (h *Host) RevokeToken(ctx context.Context, rt http.RoundTripper, token *oauth2.Token) error {
+	tp := &github.BasicAuthTransport{
+		Username:  h.OAuth.ClientID,
+		Password:  h.OAuth.ClientSecret,
+		Transport: rt,
+	}
+	_, err := h.Client(tp.Client()).Authorizations.Revoke(ctx, h.OAuth.ClientID, token.AccessToken)
+	return errors.Wrapf(err, "could not revoke token on host %q", h.Name)
+}
+
+// Hosts are the configured hosts, the first is the default host.
+type Hosts []*Host
+
+// Get returns the host with name, or the default host if name is blank.
+// Returns nil if there is no host with that name.
+func (hs Hosts) Get(name string) *Host {
+	if name == "" && len(hs) > 0 {
+		return hs[0]
+	}
+	for _, h := range hs {
+		if h.Name == name {
+			return h
+		}
+	}
+	return nil
+}
+
+// LoadEnterprise reads a JSON array of EnterpriseConfig from r, and returns
+// their hosts.
+func LoadEnterprise(r io.Reader) (Hosts, error) {
+	var configs []EnterpriseConfig
+	if err := json.NewDecoder(r).Decode(&configs); err != nil {
+		return nil, errors.Wrap(err, "could not decode enterprise hosts")
+	}
+
+	var hosts Hosts
+	for _, config := range configs {
+		host, err := NewEnterprise(config)
+		if err != nil {
+			return nil, err
+		}
+		if hosts.Get(host.Name) != nil {
+			return nil, errors.Errorf("duplicate host %q", host.Name)
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
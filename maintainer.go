@@ -3,29 +3,40 @@ package maintainer
 import (
 	"database/sql"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
-
-	"golang.org/x/oauth2"
-	ghoauth "golang.org/x/oauth2/github"
+	"strconv"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/bradleyfalzon/maintainer.me/db"
+	"github.com/bradleyfalzon/maintainer.me/ghapp"
+	"github.com/bradleyfalzon/maintainer.me/ghhost"
+	"github.com/bradleyfalzon/maintainer.me/notifier"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gregjones/httpcache"
 	"github.com/gregjones/httpcache/diskcache"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
 	migrate "github.com/rubenv/sql-migrate"
 )
 
 // Maintainer is a configuration struct for the maintainer.me application.
 type Maintainer struct {
-	Logger        *logrus.Entry
-	DB            db.DB
-	DBConn        *sql.DB
-	Cache         http.RoundTripper
-	GHOAuthConfig *oauth2.Config
+	Logger  *logrus.Entry
+	DB      db.DB
+	DBConn  *sql.DB
+	Cache   http.RoundTripper
+	Hosts   ghhost.Hosts // Hosts are the GitHub hosts users log in with, the first is GitHub.com.
+	BaseURL string       // BaseURL is the public URL of the web console.
+	SMTP    notifier.SMTPConfig
+
+	// App is the GitHub App, or nil if not running as a GitHub App.
+	App *ghapp.App
+	// AppWebhookSecret is the secret used to sign the GitHub App's webhooks.
+	AppWebhookSecret string
 }
 
 // NewMaintainer initialises the application and returns a configuration or an
@@ -37,23 +48,51 @@ func NewMaintainer() (*Maintainer, error) {
 	logger := log.WithField("cmd", filepath.Base(os.Args[0]))
 
 	// DB
-	dsn := fmt.Sprintf(`%s:%s@tcp(%s:%s)/%s?charset=utf8&collation=utf8_unicode_ci&timeout=6s&time_zone='%%2B00:00'&parseTime=true`,
-		os.Getenv("DB_USERNAME"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_DATABASE"),
-	)
+	var dsn string
+	switch os.Getenv("DB_DRIVER") {
+	case db.DriverMySQL:
+		dsn = fmt.Sprintf(`%s:%s@tcp(%s:%s)/%s?charset=utf8&collation=utf8_unicode_ci&timeout=6s&time_zone='%%2B00:00'&parseTime=true`,
+			os.Getenv("DB_USERNAME"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_DATABASE"),
+		)
+	case db.DriverPostgres:
+		sslMode := os.Getenv("DB_SSLMODE")
+		if sslMode == "" {
+			sslMode = "require"
+		}
+		dsn = fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s connect_timeout=6",
+			os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_DATABASE"), os.Getenv("DB_USERNAME"), os.Getenv("DB_PASSWORD"), sslMode,
+		)
+	case db.DriverSQLite:
+		// DB_DATABASE is the path to the database file.
+		dsn = fmt.Sprintf("file:%s?_foreign_keys=1&_busy_timeout=6000", os.Getenv("DB_DATABASE"))
+	default:
+		return nil, errors.Errorf("unsupported environment DB_DRIVER %q", os.Getenv("DB_DRIVER"))
+	}
 	dbConn, err := sql.Open(os.Getenv("DB_DRIVER"), dsn)
 	if err != nil {
 		return nil, errors.Wrap(err, "error setting up DB")
 	}
+	if os.Getenv("DB_DRIVER") == db.DriverSQLite {
+		// SQLite allows a single writer.
+		dbConn.SetMaxOpenConns(1)
+	}
 	if err := dbConn.Ping(); err != nil {
 		return nil, errors.Wrapf(err, "error pinging %q db name: %q, username: %q, host: %q, port: %q",
 			os.Getenv("DB_DRIVER"), os.Getenv("DB_DATABASE"), os.Getenv("DB_USERNAME"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"),
 		)
 	}
-	db := db.NewSQLDB(os.Getenv("DB_DRIVER"), dbConn)
+	if os.Getenv("GITHUB_TOKEN_KEYS") == "" {
+		return nil, errors.New("environment GITHUB_TOKEN_KEYS not set")
+	}
+	tokenKeys, err := db.ParseTokenKeys(os.Getenv("GITHUB_TOKEN_KEYS"))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse environment GITHUB_TOKEN_KEYS")
+	}
+	db := db.NewSQLDB(os.Getenv("DB_DRIVER"), dbConn, tokenKeys)
 
 	// Migrations
 	// TODO down direction
-	migrations := &migrate.FileMigrationSource{Dir: "migrations"}
+	migrations := &migrate.FileMigrationSource{Dir: filepath.Join("migrations", os.Getenv("DB_DRIVER"))}
 	n, err := migrate.ExecMax(dbConn, os.Getenv("DB_DRIVER"), migrations, migrate.Up, 0)
 	if err != nil {
 		return nil, errors.Wrap(err, "error running SQL migrations")
@@ -71,18 +110,57 @@ func NewMaintainer() (*Maintainer, error) {
 		return nil, errors.New("environment GITHUB_OAUTH_CLIENT_SECRET not set")
 	}
 
-	ghoauthConfig := &oauth2.Config{
-		ClientID:     os.Getenv("GITHUB_OAUTH_CLIENT_ID"),
-		ClientSecret: os.Getenv("GITHUB_OAUTH_CLIENT_SECRET"),
-		Endpoint:     ghoauth.Endpoint,
-		Scopes:       []string{"user:email"},
+	hosts := ghhost.Hosts{ghhost.NewGitHubCom(os.Getenv("GITHUB_OAUTH_CLIENT_ID"), os.Getenv("GITHUB_OAUTH_CLIENT_SECRET"))}
+
+	// GitHub Enterprise Server hosts
+	if filename := os.Getenv("GITHUB_ENTERPRISE_HOSTS_FILE"); filename != "" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not open environment GITHUB_ENTERPRISE_HOSTS_FILE")
+		}
+		enterprise, err := ghhost.LoadEnterprise(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not load %q", filename)
+		}
+		hosts = append(hosts, enterprise...)
+	}
+
+	// Email notifications
+	smtpConfig := notifier.SMTPConfig{
+		Addr:     os.Getenv("SMTP_ADDR"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+
+	// GitHub App
+	var app *ghapp.App
+	if os.Getenv("GITHUB_APP_ID") != "" {
+		appID, err := strconv.Atoi(os.Getenv("GITHUB_APP_ID"))
+		if err != nil {
+			return nil, errors.Wrap(err, "could not parse environment GITHUB_APP_ID")
+		}
+		key, err := ioutil.ReadFile(os.Getenv("GITHUB_APP_PRIVATE_KEY_FILE"))
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read environment GITHUB_APP_PRIVATE_KEY_FILE")
+		}
+		app, err = ghapp.NewApp(appID, key, hosts.Get(ghhost.GitHubCom), cache)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not initialise GitHub App")
+		}
 	}
 
 	return &Maintainer{
-		DB:            db,
-		DBConn:        dbConn,
-		Logger:        logger,
-		Cache:         cache,
-		GHOAuthConfig: ghoauthConfig,
+		DB:      db,
+		DBConn:  dbConn,
+		Logger:  logger,
+		Cache:   cache,
+		Hosts:   hosts,
+		BaseURL: os.Getenv("BASE_URL"),
+		SMTP:    smtpConfig,
+
+		App:              app,
+		AppWebhookSecret: os.Getenv("GITHUB_APP_WEBHOOK_SECRET"),
 	}, nil
 }
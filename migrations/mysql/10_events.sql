@@ -0,0 +1,31 @@
+-- +migrate Up
+CREATE TABLE events (
+	id INT UNSIGNED AUTO_INCREMENT,
+	user_id INT UNSIGNED NOT NULL,
+	github_id VARCHAR(64) NOT NULL DEFAULT '',
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, -- time the event was created on GitHub
+	`type` VARCHAR(64) NOT NULL,
+	public TINYINT NOT NULL DEFAULT 0,
+	repository VARCHAR(255) NOT NULL DEFAULT '',
+	repository_id INT NOT NULL DEFAULT 0,
+	number INT NOT NULL DEFAULT 0,
+	actor VARCHAR(255) NOT NULL DEFAULT '',
+	action VARCHAR(64) NOT NULL DEFAULT '',
+	subject VARCHAR(1024) NOT NULL DEFAULT '',
+	title VARCHAR(1024) NOT NULL DEFAULT '',
+	body MEDIUMTEXT NOT NULL,
+	discarded TINYINT NOT NULL DEFAULT 0,
+	muted TINYINT NOT NULL DEFAULT 0,
+	priority INT NOT NULL DEFAULT 0,
+	tag VARCHAR(64) NOT NULL DEFAULT '',
+	PRIMARY KEY (`id`),
+	KEY `user_id_created_at` (`user_id`, `created_at`),
+	KEY `user_id_repository` (`user_id`, `repository`),
+	KEY `user_id_type` (`user_id`, `type`),
+	KEY `user_id_actor` (`user_id`, `actor`),
+	FULLTEXT KEY `title_body` (`title`, `body`),
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=innodb;
+
+-- +migrate Down
+DROP TABLE events;
@@ -0,0 +1,11 @@
+-- +migrate Up
+ALTER TABLE `events` ADD COLUMN read_at timestamp NULL DEFAULT NULL AFTER tag;
+ALTER TABLE `events` ADD COLUMN archived TINYINT NOT NULL DEFAULT 0 AFTER read_at;
+ALTER TABLE `events` ADD COLUMN starred TINYINT NOT NULL DEFAULT 0 AFTER archived;
+CREATE INDEX events_user_id_unread_idx ON events (user_id, discarded, read_at);
+
+-- +migrate Down
+DROP INDEX events_user_id_unread_idx ON events;
+ALTER TABLE `events` DROP COLUMN starred;
+ALTER TABLE `events` DROP COLUMN archived;
+ALTER TABLE `events` DROP COLUMN read_at;
@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE api_tokens (
+	id INT UNSIGNED AUTO_INCREMENT,
+	user_id INT UNSIGNED NOT NULL,
+	token_hash CHAR(64) NOT NULL, -- hex encoded sha256 of the token
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (`id`),
+	UNIQUE KEY `token_hash` (`token_hash`),
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=innodb;
+
+-- +migrate Down
+DROP TABLE api_tokens;
@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE `api_tokens` ADD COLUMN name VARCHAR(64) NOT NULL DEFAULT '' AFTER user_id;
+ALTER TABLE `api_tokens` ADD COLUMN scope VARCHAR(16) NOT NULL DEFAULT 'read' AFTER name;
+ALTER TABLE `api_tokens` ADD COLUMN last_used_at timestamp NULL DEFAULT NULL AFTER token_hash;
+
+-- +migrate Down
+ALTER TABLE `api_tokens` DROP COLUMN last_used_at;
+ALTER TABLE `api_tokens` DROP COLUMN scope;
+ALTER TABLE `api_tokens` DROP COLUMN name;
@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE users ADD feed_token CHAR(40) NOT NULL DEFAULT '' AFTER quiet_hours_end; -- blank when the user's feed is disabled
+ALTER TABLE users ADD INDEX feed_token (feed_token);
+
+-- +migrate Down
+ALTER TABLE users DROP COLUMN feed_token;
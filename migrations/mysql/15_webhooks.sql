@@ -0,0 +1,10 @@
+-- +migrate Up
+ALTER TABLE users ADD webhook_secret CHAR(40) NOT NULL DEFAULT '' AFTER feed_token; -- blank when the user's webhooks are disabled
+ALTER TABLE events ADD dedup_key VARCHAR(191) NOT NULL DEFAULT '' AFTER github_id;
+UPDATE events SET dedup_key = CONCAT('id:', IF(github_id = '', id, github_id));
+ALTER TABLE events ADD UNIQUE KEY `user_id_dedup_key` (`user_id`, `dedup_key`);
+
+-- +migrate Down
+ALTER TABLE events DROP INDEX `user_id_dedup_key`;
+ALTER TABLE events DROP COLUMN dedup_key;
+ALTER TABLE users DROP COLUMN webhook_secret;
@@ -0,0 +1,25 @@
+-- +migrate Up
+CREATE TABLE installations (
+	id INT UNSIGNED NOT NULL, -- GitHub's installation ID
+	account_id INT UNSIGNED NOT NULL,
+	account_login VARCHAR(255) NOT NULL,
+	sender_github_id INT UNSIGNED NOT NULL, -- GitHub user who installed the app
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (`id`),
+	KEY `sender_github_id` (`sender_github_id`)
+) ENGINE=innodb;
+
+CREATE TABLE installation_repositories (
+	installation_id INT UNSIGNED NOT NULL,
+	repository_id INT UNSIGNED NOT NULL,
+	full_name VARCHAR(255) NOT NULL,
+	event_last_created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	event_next_poll timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (`installation_id`, `repository_id`),
+	KEY `event_next_poll` (`event_next_poll`),
+	FOREIGN KEY (installation_id) REFERENCES installations (id) ON DELETE CASCADE
+) ENGINE=innodb;
+
+-- +migrate Down
+DROP TABLE installation_repositories;
+DROP TABLE installations;
@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE users ADD github_host VARCHAR(255) NOT NULL DEFAULT 'github.com' AFTER email;
+ALTER TABLE users DROP INDEX `github_id`, ADD UNIQUE KEY `github_host_github_id` (`github_host`, `github_id`);
+
+-- +migrate Down
+ALTER TABLE users DROP INDEX `github_host_github_id`, ADD UNIQUE KEY `github_id` (`github_id`);
+ALTER TABLE users DROP COLUMN github_host;
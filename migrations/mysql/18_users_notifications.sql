@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE users ADD notifications_enabled TINYINT NOT NULL DEFAULT 0 AFTER webhook_secret;
+ALTER TABLE users ADD notifications_mark_read TINYINT NOT NULL DEFAULT 0 AFTER notifications_enabled;
+ALTER TABLE users ADD notifications_since timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER notifications_mark_read;
+
+-- +migrate Down
+ALTER TABLE users DROP COLUMN notifications_since;
+ALTER TABLE users DROP COLUMN notifications_mark_read;
+ALTER TABLE users DROP COLUMN notifications_enabled;
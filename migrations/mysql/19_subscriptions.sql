@@ -0,0 +1,16 @@
+-- +migrate Up
+CREATE TABLE subscriptions (
+	id INT UNSIGNED AUTO_INCREMENT,
+	user_id INT UNSIGNED NOT NULL,
+	kind ENUM('repository', 'organization') NOT NULL,
+	name VARCHAR(255) NOT NULL, -- such as golang/go or golang
+	event_last_created_at timestamp NULL DEFAULT NULL,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	PRIMARY KEY (`id`),
+	UNIQUE KEY `user_id_kind_name` (`user_id`, `kind`, `name`),
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=innodb;
+
+-- +migrate Down
+DROP TABLE subscriptions;
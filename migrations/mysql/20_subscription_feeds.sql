@@ -0,0 +1,37 @@
+-- +migrate Up
+CREATE TABLE subscription_feeds (
+	id INT UNSIGNED AUTO_INCREMENT,
+	github_host VARCHAR(255) NOT NULL,
+	kind ENUM('repository', 'organization') NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	event_last_created_at timestamp NULL DEFAULT NULL,
+	event_next_poll timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	PRIMARY KEY (`id`),
+	UNIQUE KEY `github_host_kind_name` (`github_host`, `kind`, `name`),
+	KEY `event_next_poll` (`event_next_poll`)
+) ENGINE=innodb;
+
+INSERT INTO subscription_feeds (github_host, kind, name, event_last_created_at)
+SELECT u.github_host, s.kind, s.name, MAX(s.event_last_created_at)
+  FROM subscriptions s
+  JOIN users u ON u.id = s.user_id
+ GROUP BY u.github_host, s.kind, s.name;
+
+ALTER TABLE subscriptions ADD feed_id INT UNSIGNED NOT NULL AFTER user_id;
+UPDATE subscriptions s
+  JOIN users u ON u.id = s.user_id
+  JOIN subscription_feeds f ON f.github_host = u.github_host AND f.kind = s.kind AND f.name = s.name
+   SET s.feed_id = f.id;
+ALTER TABLE subscriptions ADD FOREIGN KEY (feed_id) REFERENCES subscription_feeds (id);
+ALTER TABLE subscriptions DROP COLUMN event_last_created_at;
+
+-- +migrate Down
+ALTER TABLE subscriptions ADD event_last_created_at timestamp NULL DEFAULT NULL AFTER name;
+UPDATE subscriptions s
+  JOIN subscription_feeds f ON f.id = s.feed_id
+   SET s.event_last_created_at = f.event_last_created_at;
+ALTER TABLE subscriptions DROP FOREIGN KEY subscriptions_ibfk_2;
+ALTER TABLE subscriptions DROP COLUMN feed_id;
+DROP TABLE subscription_feeds;
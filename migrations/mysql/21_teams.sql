@@ -0,0 +1,31 @@
+-- +migrate Up
+CREATE TABLE teams (
+	id INT UNSIGNED AUTO_INCREMENT,
+	name VARCHAR(255) NOT NULL,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	PRIMARY KEY (`id`)
+) ENGINE=innodb;
+
+CREATE TABLE team_memberships (
+	team_id INT UNSIGNED NOT NULL,
+	user_id INT UNSIGNED NOT NULL,
+	role ENUM('owner', 'member') NOT NULL DEFAULT 'member',
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	PRIMARY KEY (`team_id`, `user_id`),
+	KEY `user_id` (`user_id`),
+	FOREIGN KEY (team_id) REFERENCES teams (id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=innodb;
+
+-- A filter belongs to either a user or a team.
+ALTER TABLE filters MODIFY user_id INT UNSIGNED NULL;
+ALTER TABLE filters ADD team_id INT UNSIGNED NULL AFTER user_id, ADD FOREIGN KEY (team_id) REFERENCES teams (id) ON DELETE CASCADE;
+
+-- +migrate Down
+DELETE FROM filters WHERE team_id IS NOT NULL;
+ALTER TABLE filters DROP FOREIGN KEY filters_ibfk_2, DROP COLUMN team_id;
+ALTER TABLE filters MODIFY user_id INT UNSIGNED NOT NULL;
+DROP TABLE team_memberships;
+DROP TABLE teams;
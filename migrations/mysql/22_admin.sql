@@ -0,0 +1,25 @@
+-- +migrate Up
+ALTER TABLE users ADD admin TINYINT NOT NULL DEFAULT 0 AFTER github_token;
+ALTER TABLE users ADD github_token_valid TINYINT NOT NULL DEFAULT 1 AFTER admin;
+ALTER TABLE users ADD poll_paused TINYINT NOT NULL DEFAULT 0 AFTER event_next_poll;
+ALTER TABLE users ADD polled_at timestamp NULL DEFAULT NULL AFTER poll_paused;
+ALTER TABLE users ADD poll_error VARCHAR(1024) NOT NULL DEFAULT '' AFTER polled_at;
+
+CREATE TABLE delivery_failures (
+	id INT UNSIGNED AUTO_INCREMENT,
+	user_id INT UNSIGNED NOT NULL,
+	channel VARCHAR(64) NOT NULL,
+	error VARCHAR(1024) NOT NULL,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (`id`),
+	KEY `user_id_created_at` (`user_id`, `created_at`),
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=innodb;
+
+-- +migrate Down
+DROP TABLE delivery_failures;
+ALTER TABLE users DROP COLUMN poll_error;
+ALTER TABLE users DROP COLUMN polled_at;
+ALTER TABLE users DROP COLUMN poll_paused;
+ALTER TABLE users DROP COLUMN github_token_valid;
+ALTER TABLE users DROP COLUMN admin;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE users ADD notifications_paused TINYINT NOT NULL DEFAULT 0 AFTER notifications_since;
+
+-- +migrate Down
+ALTER TABLE users DROP COLUMN notifications_paused;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE users MODIFY github_token TEXT NOT NULL;
+
+-- +migrate Down
+ALTER TABLE users MODIFY github_token VARCHAR(128) NOT NULL;
@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE `filters` ADD COLUMN priority INT NOT NULL DEFAULT 0 AFTER on_match_discard;
+ALTER TABLE `filters` ADD COLUMN tag VARCHAR(64) NOT NULL DEFAULT '' AFTER priority;
+ALTER TABLE `filters` ADD COLUMN channels VARCHAR(255) NOT NULL DEFAULT '' AFTER tag;
+
+-- +migrate Down
+ALTER TABLE `filters` DROP COLUMN channels;
+ALTER TABLE `filters` DROP COLUMN tag;
+ALTER TABLE `filters` DROP COLUMN priority;
@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE TABLE mutes (
+	id INT UNSIGNED AUTO_INCREMENT,
+	user_id INT UNSIGNED NOT NULL,
+	repository_id INT NOT NULL,
+	repository VARCHAR(255) NOT NULL DEFAULT '',
+	number INT NOT NULL DEFAULT 0, -- 0 = entire repository
+	expires_at timestamp NULL DEFAULT NULL, -- NULL = never expires
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	PRIMARY KEY (`id`),
+	KEY `user_id_expires_at` (`user_id`, `expires_at`),
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=innodb;
+
+-- +migrate Down
+DROP TABLE mutes;
@@ -0,0 +1,30 @@
+-- +migrate Up
+ALTER TABLE `users` ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC' AFTER filter_default_discard;
+ALTER TABLE `users` ADD COLUMN quiet_hours_start TINYINT UNSIGNED NOT NULL DEFAULT 0 AFTER timezone;
+ALTER TABLE `users` ADD COLUMN quiet_hours_end TINYINT UNSIGNED NOT NULL DEFAULT 0 AFTER quiet_hours_start;
+ALTER TABLE `users` ADD COLUMN event_last_created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER quiet_hours_end;
+ALTER TABLE `users` ADD COLUMN event_next_poll timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER event_last_created_at;
+ALTER TABLE `filters` ADD COLUMN urgent TINYINT NOT NULL DEFAULT 0 AFTER on_match_discard;
+
+CREATE TABLE held_notifications (
+	id INT UNSIGNED AUTO_INCREMENT,
+	user_id INT UNSIGNED NOT NULL,
+	event MEDIUMBLOB NOT NULL,
+	priority INT NOT NULL DEFAULT 0,
+	tag VARCHAR(64) NOT NULL DEFAULT '',
+	channels VARCHAR(255) NOT NULL DEFAULT '',
+	deliver_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (`id`),
+	KEY `user_id_deliver_at` (`user_id`, `deliver_at`),
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=innodb;
+
+-- +migrate Down
+DROP TABLE held_notifications;
+ALTER TABLE `filters` DROP COLUMN urgent;
+ALTER TABLE `users` DROP COLUMN event_next_poll;
+ALTER TABLE `users` DROP COLUMN event_last_created_at;
+ALTER TABLE `users` DROP COLUMN quiet_hours_end;
+ALTER TABLE `users` DROP COLUMN quiet_hours_start;
+ALTER TABLE `users` DROP COLUMN timezone;
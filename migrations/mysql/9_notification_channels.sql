@@ -0,0 +1,19 @@
+-- +migrate Up
+CREATE TABLE notification_channels (
+	id INT UNSIGNED AUTO_INCREMENT,
+	user_id INT UNSIGNED NOT NULL,
+	name VARCHAR(64) NOT NULL,
+	`type` VARCHAR(16) NOT NULL, -- email, webhook or slack
+	target VARCHAR(1024) NOT NULL,
+	verify_token CHAR(36) NOT NULL,
+	verified_at timestamp NULL DEFAULT NULL,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	PRIMARY KEY (`id`),
+	UNIQUE KEY `user_id_name` (`user_id`, `name`),
+	UNIQUE KEY `verify_token` (`verify_token`),
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=innodb;
+
+-- +migrate Down
+DROP TABLE notification_channels;
@@ -0,0 +1,242 @@
+-- +migrate Up
+-- The schema of migrations/mysql up to 24_users_github_token_encrypted.
+
+-- Sessions, as required by github.com/alexedwards/scs/engine/pgstore.
+CREATE TABLE sessions (
+	token TEXT PRIMARY KEY,
+	data BYTEA NOT NULL,
+	expiry TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX sessions_expiry_idx ON sessions (expiry);
+
+CREATE TABLE users (
+	id SERIAL PRIMARY KEY,
+	email VARCHAR(255) NOT NULL,
+	github_host VARCHAR(255) NOT NULL DEFAULT 'github.com',
+	github_id BIGINT NOT NULL,
+	github_login VARCHAR(255) NOT NULL,
+	github_token TEXT NOT NULL,
+	admin BOOLEAN NOT NULL DEFAULT FALSE,
+	github_token_valid BOOLEAN NOT NULL DEFAULT TRUE,
+	filter_default_discard BOOLEAN NOT NULL DEFAULT TRUE,
+	timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+	quiet_hours_start SMALLINT NOT NULL DEFAULT 0,
+	quiet_hours_end SMALLINT NOT NULL DEFAULT 0,
+	feed_token CHAR(40) NOT NULL DEFAULT '', -- blank when the user's feed is disabled
+	webhook_secret CHAR(40) NOT NULL DEFAULT '', -- blank when the user's webhooks are disabled
+	notifications_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	notifications_mark_read BOOLEAN NOT NULL DEFAULT FALSE,
+	notifications_since TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	notifications_paused BOOLEAN NOT NULL DEFAULT FALSE,
+	event_last_created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	event_next_poll TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	poll_paused BOOLEAN NOT NULL DEFAULT FALSE,
+	polled_at TIMESTAMPTZ NULL DEFAULT NULL,
+	poll_error VARCHAR(1024) NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (github_host, github_id)
+);
+CREATE INDEX users_feed_token_idx ON users (feed_token);
+
+CREATE TABLE teams (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE team_memberships (
+	team_id INTEGER NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	role VARCHAR(16) NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'member')),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (team_id, user_id)
+);
+CREATE INDEX team_memberships_user_id_idx ON team_memberships (user_id);
+
+-- A filter belongs to either a user or a team.
+CREATE TABLE filters (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NULL REFERENCES users (id) ON DELETE CASCADE,
+	team_id INTEGER NULL REFERENCES teams (id) ON DELETE CASCADE,
+	on_match_discard BOOLEAN NOT NULL DEFAULT FALSE,
+	urgent BOOLEAN NOT NULL DEFAULT FALSE,
+	priority INTEGER NOT NULL DEFAULT 0,
+	tag VARCHAR(64) NOT NULL DEFAULT '',
+	channels VARCHAR(255) NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX filters_user_id_idx ON filters (user_id);
+CREATE INDEX filters_team_id_idx ON filters (team_id);
+
+CREATE TABLE conditions (
+	id SERIAL PRIMARY KEY,
+	filter_id INTEGER NOT NULL REFERENCES filters (id) ON DELETE CASCADE,
+	negate BOOLEAN NOT NULL DEFAULT FALSE,
+	type VARCHAR(64) NOT NULL DEFAULT '',
+	payload_action VARCHAR(64) NOT NULL DEFAULT '',
+	payload_issue_label VARCHAR(64) NOT NULL DEFAULT '',
+	payload_issue_milestone_title VARCHAR(64) NOT NULL DEFAULT '',
+	payload_issue_title_regexp VARCHAR(64) NOT NULL DEFAULT '',
+	payload_issue_body_regexp VARCHAR(64) NOT NULL DEFAULT '',
+	public SMALLINT NOT NULL DEFAULT 0, -- 0 = any, 1 = public, 2 = private
+	organization_id BIGINT NOT NULL DEFAULT 0,
+	repository_id BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX conditions_filter_id_idx ON conditions (filter_id);
+
+CREATE TABLE mutes (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	repository_id BIGINT NOT NULL,
+	repository VARCHAR(255) NOT NULL DEFAULT '',
+	number INTEGER NOT NULL DEFAULT 0, -- 0 = entire repository
+	expires_at TIMESTAMPTZ NULL DEFAULT NULL, -- NULL = never expires
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX mutes_user_id_expires_at_idx ON mutes (user_id, expires_at);
+
+CREATE TABLE held_notifications (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	event BYTEA NOT NULL,
+	priority INTEGER NOT NULL DEFAULT 0,
+	tag VARCHAR(64) NOT NULL DEFAULT '',
+	channels VARCHAR(255) NOT NULL DEFAULT '',
+	deliver_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX held_notifications_user_id_deliver_at_idx ON held_notifications (user_id, deliver_at);
+
+CREATE TABLE notification_channels (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	name VARCHAR(64) NOT NULL,
+	type VARCHAR(16) NOT NULL, -- email, webhook or slack
+	target VARCHAR(1024) NOT NULL,
+	verify_token CHAR(36) NOT NULL UNIQUE,
+	verified_at TIMESTAMPTZ NULL DEFAULT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, name)
+);
+
+CREATE TABLE events (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	github_id VARCHAR(64) NOT NULL DEFAULT '',
+	dedup_key VARCHAR(191) NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP, -- time the event was created on GitHub
+	type VARCHAR(64) NOT NULL,
+	public BOOLEAN NOT NULL DEFAULT FALSE,
+	repository VARCHAR(255) NOT NULL DEFAULT '',
+	repository_id BIGINT NOT NULL DEFAULT 0,
+	number INTEGER NOT NULL DEFAULT 0,
+	actor VARCHAR(255) NOT NULL DEFAULT '',
+	action VARCHAR(64) NOT NULL DEFAULT '',
+	subject VARCHAR(1024) NOT NULL DEFAULT '',
+	title VARCHAR(1024) NOT NULL DEFAULT '',
+	body TEXT NOT NULL,
+	discarded BOOLEAN NOT NULL DEFAULT FALSE,
+	muted BOOLEAN NOT NULL DEFAULT FALSE,
+	priority INTEGER NOT NULL DEFAULT 0,
+	tag VARCHAR(64) NOT NULL DEFAULT '',
+	read_at TIMESTAMPTZ NULL DEFAULT NULL,
+	archived BOOLEAN NOT NULL DEFAULT FALSE,
+	starred BOOLEAN NOT NULL DEFAULT FALSE,
+	UNIQUE (user_id, dedup_key)
+);
+CREATE INDEX events_user_id_created_at_idx ON events (user_id, created_at);
+CREATE INDEX events_user_id_repository_idx ON events (user_id, repository);
+CREATE INDEX events_user_id_type_idx ON events (user_id, type);
+CREATE INDEX events_user_id_actor_idx ON events (user_id, actor);
+CREATE INDEX events_user_id_unread_idx ON events (user_id, discarded, read_at);
+-- Must match the expression searched by SQLDB.eventsSearch.
+CREATE INDEX events_title_body_idx ON events USING GIN (to_tsvector('simple', title || ' ' || body));
+
+CREATE TABLE api_tokens (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	name VARCHAR(64) NOT NULL DEFAULT '',
+	scope VARCHAR(16) NOT NULL DEFAULT 'read',
+	token_hash CHAR(64) NOT NULL UNIQUE, -- hex encoded sha256 of the token
+	last_used_at TIMESTAMPTZ NULL DEFAULT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE installations (
+	id BIGINT PRIMARY KEY, -- GitHub's installation ID
+	account_id BIGINT NOT NULL,
+	account_login VARCHAR(255) NOT NULL,
+	sender_github_id BIGINT NOT NULL, -- GitHub user who installed the app
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX installations_sender_github_id_idx ON installations (sender_github_id);
+
+CREATE TABLE installation_repositories (
+	installation_id BIGINT NOT NULL REFERENCES installations (id) ON DELETE CASCADE,
+	repository_id BIGINT NOT NULL,
+	full_name VARCHAR(255) NOT NULL,
+	event_last_created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	event_next_poll TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (installation_id, repository_id)
+);
+CREATE INDEX installation_repositories_event_next_poll_idx ON installation_repositories (event_next_poll);
+
+CREATE TABLE subscription_feeds (
+	id SERIAL PRIMARY KEY,
+	github_host VARCHAR(255) NOT NULL,
+	kind VARCHAR(16) NOT NULL CHECK (kind IN ('repository', 'organization')),
+	name VARCHAR(255) NOT NULL,
+	event_last_created_at TIMESTAMPTZ NULL DEFAULT NULL,
+	event_next_poll TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (github_host, kind, name)
+);
+CREATE INDEX subscription_feeds_event_next_poll_idx ON subscription_feeds (event_next_poll);
+
+CREATE TABLE subscriptions (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	feed_id INTEGER NOT NULL REFERENCES subscription_feeds (id),
+	kind VARCHAR(16) NOT NULL CHECK (kind IN ('repository', 'organization')),
+	name VARCHAR(255) NOT NULL, -- such as golang/go or golang
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, kind, name)
+);
+CREATE INDEX subscriptions_feed_id_idx ON subscriptions (feed_id);
+
+CREATE TABLE delivery_failures (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	channel VARCHAR(64) NOT NULL,
+	error VARCHAR(1024) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX delivery_failures_user_id_created_at_idx ON delivery_failures (user_id, created_at);
+
+-- +migrate Down
+DROP TABLE delivery_failures;
+DROP TABLE subscriptions;
+DROP TABLE subscription_feeds;
+DROP TABLE installation_repositories;
+DROP TABLE installations;
+DROP TABLE api_tokens;
+DROP TABLE events;
+DROP TABLE notification_channels;
+DROP TABLE held_notifications;
+DROP TABLE mutes;
+DROP TABLE conditions;
+DROP TABLE filters;
+DROP TABLE team_memberships;
+DROP TABLE teams;
+DROP TABLE users;
+DROP TABLE sessions;
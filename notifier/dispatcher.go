@@ -0,0 +1,164 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/bradleyfalzon/maintainer.me/db"
+	"github.com/bradleyfalzon/maintainer.me/events"
+	"github.com/pkg/errors"
+)
+
+// sender sends a plain text message to a notification channel, used for
+// messages that aren't about events, such as verification.
+type sender interface {
+	events.Notifier
+	send(subject, text string) error
+}
+
+// Dispatcher is an events.Dispatcher resolving notifiers from a user's
+// verified notification channels.
+type Dispatcher struct {
+	DB      db.DB
+	SMTP    SMTPConfig
+	Client  *http.Client // Client is used for webhooks, if nil a client with a 10 second timeout is used.
+	BaseURL string       // BaseURL is the console's URL, such as "https://maintainer.me".
+
+	// Default is the notifier for events.DefaultChannel when a user does not
+	// have a channel with that name, may be nil.
+	Default events.Notifier
+}
+
+var _ events.Dispatcher = &Dispatcher{}
+
+// defaultClient is used for webhooks when the Dispatcher's Client is nil, the
+// timeout prevents an unresponsive webhook from stalling the poller. Webhook
+// URLs are set by users, so the client only connects to public addresses,
+// checked when dialing as the URL's host may resolve differently to when the
+// channel was added, and doesn't follow redirects. It doesn't use a proxy, as
+// the proxy's address would be checked instead of the webhook's.
+var defaultClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   dialPublic,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// dialPublic is a net.Dialer Control function refusing to connect to
+// addresses that aren't public.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !PublicIP(ip) {
+		return errors.Errorf("refusing to connect to non-public address %q", host)
+	}
+	return nil
+}
+
+// nonPublicNets are the private and shared address ranges not covered by the
+// net.IP methods used by PublicIP.
+var nonPublicNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"} {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets
+}()
+
+// PublicIP returns true if ip is not a loopback, private, link-local or
+// unspecified address.
+func PublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, ipnet := range nonPublicNets {
+		if ipnet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Notifier implements the events.Dispatcher interface.
+func (d *Dispatcher) Notifier(ctx context.Context, user db.User, channel string) (events.Notifier, error) {
+	channels, err := d.DB.UsersNotificationChannels(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range channels {
+		if c.Name != channel || !c.Verified() {
+			continue
+		}
+		return d.sender(ctx, c)
+	}
+
+	if channel == events.DefaultChannel && d.Default != nil {
+		return d.Default, nil
+	}
+	return nil, nil
+}
+
+// SendVerification sends a message to an unverified channel, containing the
+// link the user must visit to verify it.
+func (d *Dispatcher) SendVerification(ctx context.Context, channel db.NotificationChannel) error {
+	s, err := d.sender(ctx, channel)
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("To receive Maintainer.Me notifications on your %q channel, visit: %s/console/channels/verify?token=%s",
+		channel.Name, d.BaseURL, channel.VerifyToken,
+	)
+	return errors.Wrapf(s.send("Verify your Maintainer.Me notification channel", text), "could not send verification to channel %d", channel.ID)
+}
+
+// sender returns the sender for a channel's type, webhook requests are made
+// with ctx.
+func (d *Dispatcher) sender(ctx context.Context, channel db.NotificationChannel) (sender, error) {
+	client := d.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	switch channel.Type {
+	case db.ChannelTypeEmail:
+		return &Email{SMTP: d.SMTP, To: channel.Target, BaseURL: d.BaseURL}, nil
+	case db.ChannelTypeWebhook:
+		return &Webhook{Context: ctx, Client: client, URL: channel.Target, BaseURL: d.BaseURL}, nil
+	case db.ChannelTypeSlack:
+		return &Slack{Context: ctx, Client: client, URL: channel.Target, BaseURL: d.BaseURL}, nil
+	}
+	return nil, fmt.Errorf("unknown notification channel type %q", channel.Type)
+}
+
+// eventText returns the plain text description of an event, including links
+// to the console if baseURL is set.
+func eventText(baseURL string, event *events.Event) string {
+	text := event.Body
+	if baseURL != "" {
+		text += fmt.Sprintf("\n\nMute: %s%s", baseURL, event.MutePath())
+	}
+	return text
+}
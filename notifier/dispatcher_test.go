@@ -0,0 +1,72 @@
+package notifier
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDefaultClientNonPublicAddress(t *testing.T) {
+	var requested bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer srv.Close()
+
+	wh := &Webhook{Client: defaultClient, URL: srv.URL}
+	if err := wh.send("subject", "text"); err == nil {
+		t.Error("send to a loopback address returned no error")
+	}
+	if requested {
+		t.Error("send to a loopback address made a request")
+	}
+}
+
+func TestDefaultClientRedirect(t *testing.T) {
+	var redirected bool
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer internal.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL, http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	// The test servers aren't public, so only the redirect policy is used.
+	client := &http.Client{CheckRedirect: defaultClient.CheckRedirect}
+
+	wh := &Webhook{Client: client, URL: srv.URL}
+	if err := wh.send("subject", "text"); err == nil {
+		t.Error("send to a redirecting webhook returned no error")
+	}
+	if redirected {
+		t.Error("send followed a redirect")
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+	}
+	for _, test := range tests {
+		if got := PublicIP(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("PublicIP(%q) = %v, want %v", test.ip, got, test.want)
+		}
+	}
+}
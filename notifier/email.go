@@ -0,0 +1,137 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/bradleyfalzon/maintainer.me/events"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// SMTPConfig is the configuration used to send emails.
+type SMTPConfig struct {
+	Addr     string // Addr is the host and port of the SMTP server, such as "localhost:25".
+	Username string // Username for PLAIN authentication, if blank no authentication is used.
+	Password string
+	From     string // From is the sender's address.
+}
+
+// Email is a Notifier that sends events to an email address.
+type Email struct {
+	SMTP    SMTPConfig
+	To      string
+	BaseURL string
+}
+
+var _ events.BatchNotifier = &Email{}
+
+// Notify implements the Notifier interface.
+func (e *Email) Notify(event *events.Event) error {
+	subject := event.Title
+	if event.ThreadKey() != "" {
+		// Use the same subject for all events in a thread, as some clients
+		// only group messages by subject.
+		subject = fmt.Sprintf("[%s] %s", event.Repository, event.Subject)
+	}
+	return e.sendThread(subject, fmt.Sprintf("%s\n\n%s", event.Title, eventText(e.BaseURL, event)), event.ThreadKey())
+}
+
+// NotifyBatch implements the BatchNotifier interface, events are grouped by
+// thread.
+func (e *Email) NotifyBatch(batch events.Events) error {
+	var (
+		keys     []string
+		byThread = make(map[string]events.Events)
+	)
+	for i, event := range batch {
+		key := event.ThreadKey()
+		if key == "" {
+			key = fmt.Sprintf("event %d", i) // not part of a thread
+		}
+		if _, ok := byThread[key]; !ok {
+			keys = append(keys, key)
+		}
+		byThread[key] = append(byThread[key], event)
+	}
+
+	text := &bytes.Buffer{}
+	for _, key := range keys {
+		thread := byThread[key]
+		if len(thread) > 1 {
+			fmt.Fprintf(text, "[%s] %s (%d events)\n\n", thread[0].Repository, thread[0].Subject, len(thread))
+		}
+		for _, event := range thread {
+			fmt.Fprintf(text, "%s\n\n%s\n\n", event.Title, eventText(e.BaseURL, event))
+		}
+		text.WriteString("---\n\n")
+	}
+	return e.send(fmt.Sprintf("%d events while you were away", len(batch)), text.String())
+}
+
+// send implements the sender interface.
+func (e *Email) send(subject, text string) error {
+	return e.sendThread(subject, text, "")
+}
+
+// sendThread sends an email, if threadKey is not blank, the email references
+// the thread so clients group emails in the same thread.
+func (e *Email) sendThread(subject, text, threadKey string) error {
+	var auth smtp.Auth
+	if e.SMTP.Username != "" {
+		host, _, err := net.SplitHostPort(e.SMTP.Addr)
+		if err != nil {
+			return errors.Wrapf(err, "could not parse SMTP address %q", e.SMTP.Addr)
+		}
+		auth = smtp.PlainAuth("", e.SMTP.Username, e.SMTP.Password, host)
+	}
+
+	msg := e.message(subject, text, threadKey)
+	err := smtp.SendMail(e.SMTP.Addr, auth, e.SMTP.From, []string{e.To}, msg)
+	return errors.Wrapf(err, "could not send email to %q", e.To)
+}
+
+// message returns an email with its headers, if threadKey is not blank, the
+// email references the thread's message ID.
+func (e *Email) message(subject, text, threadKey string) []byte {
+	domain := "maintainer.me"
+	if i := strings.LastIndex(e.SMTP.From, "@"); i >= 0 {
+		domain = strings.TrimRight(e.SMTP.From[i+1:], ">")
+	}
+
+	msg := &bytes.Buffer{}
+	fmt.Fprintf(msg, "From: %s\r\n", e.SMTP.From)
+	fmt.Fprintf(msg, "To: %s\r\n", e.To)
+	fmt.Fprintf(msg, "Subject: %s\r\n", encodeSubject(subject))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "Message-ID: <%s@%s>\r\n", uuid.New(), domain)
+	if threadKey != "" {
+		threadID := threadMessageID(threadKey, domain)
+		fmt.Fprintf(msg, "In-Reply-To: %s\r\n", threadID)
+		fmt.Fprintf(msg, "References: %s\r\n", threadID)
+	}
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(text)
+	return msg.Bytes()
+}
+
+// threadMessageID returns the message ID referenced by all emails in the
+// thread with threadKey, such as "golang/go#5". The key is hashed, as not all
+// repository names are valid in a message ID, such as names containing "..".
+func threadMessageID(threadKey, domain string) string {
+	return fmt.Sprintf("<thread.%x@%s>", sha256.Sum256([]byte(threadKey)), domain)
+}
+
+// encodeSubject returns subject as a header value, as it contains titles from
+// GitHub. Line breaks, which could add headers, are replaced with spaces, and
+// non ASCII characters are encoded.
+func encodeSubject(subject string) string {
+	subject = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(subject)
+	return mime.QEncoding.Encode("utf-8", subject)
+}
@@ -0,0 +1,45 @@
+package notifier
+
+import (
+	"bytes"
+	"net/mail"
+	"testing"
+)
+
+func TestEmailMessageThread(t *testing.T) {
+	e := &Email{SMTP: SMTPConfig{From: "Maintainer.Me <notify@example.com>"}, To: "alice@example.com"}
+
+	message := func(subject, threadKey string) *mail.Message {
+		msg, err := mail.ReadMessage(bytes.NewReader(e.message(subject, "text", threadKey)))
+		if err != nil {
+			t.Fatalf("could not read message: %v", err)
+		}
+		return msg
+	}
+	first := message("[golang/go] flaky test", "golang/go#5")
+	second := message("[golang/go] flaky test", "golang/go#5")
+
+	threadID := first.Header.Get("References")
+	if _, err := mail.ParseAddress(threadID); err != nil {
+		t.Errorf("References %q is not a valid message ID: %v", threadID, err)
+	}
+	for _, msg := range []*mail.Message{first, second} {
+		if got := msg.Header.Get("In-Reply-To"); got != threadID {
+			t.Errorf("In-Reply-To is %q, want %q", got, threadID)
+		}
+		if got := msg.Header.Get("References"); got != threadID {
+			t.Errorf("References is %q, want %q", got, threadID)
+		}
+		if msg.Header.Get("Message-ID") == "" {
+			t.Error("message has no Message-ID")
+		}
+	}
+	if first.Header.Get("Message-ID") == second.Header.Get("Message-ID") {
+		t.Errorf("messages have the same Message-ID %q", first.Header.Get("Message-ID"))
+	}
+
+	other := message("[golang/go] slow test", "golang/go#6")
+	if other.Header.Get("References") == threadID {
+		t.Errorf("messages in different threads reference the same message ID %q", threadID)
+	}
+}
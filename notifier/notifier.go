@@ -10,12 +10,32 @@ import (
 // Writer is a Notifier that writes the event to the supplied writer.
 type Writer struct {
 	Writer io.Writer
+	// BaseURL is the console's URL, such as "https://maintainer.me", used
+	// to include links in notifications. If blank, no links are included.
+	BaseURL string
 }
 
-var _ events.Notifier = &Writer{}
+var _ events.BatchNotifier = &Writer{}
 
 // Notify implements the Notifier interface.
 func (w *Writer) Notify(event *events.Event) error {
 	_, err := fmt.Fprintf(w.Writer, "NOTIFY: %q\n", event.String())
+	if err != nil || w.BaseURL == "" {
+		return err
+	}
+	_, err = fmt.Fprintf(w.Writer, "  Mute: %s%s\n", w.BaseURL, event.MutePath())
 	return err
 }
+
+// NotifyBatch implements the BatchNotifier interface.
+func (w *Writer) NotifyBatch(batch events.Events) error {
+	if _, err := fmt.Fprintf(w.Writer, "NOTIFY BATCH: %d events\n", len(batch)); err != nil {
+		return err
+	}
+	for _, event := range batch {
+		if err := w.Notify(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
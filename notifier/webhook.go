@@ -0,0 +1,118 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bradleyfalzon/maintainer.me/events"
+	"github.com/pkg/errors"
+)
+
+// Webhook is a Notifier that POSTs events as JSON to a URL.
+type Webhook struct {
+	Context context.Context // Context of requests, if nil context.Background() is used.
+	Client  *http.Client
+	URL     string
+	BaseURL string
+}
+
+var _ events.Notifier = &Webhook{}
+
+// webhookPayload is the JSON body sent by Webhook.
+type webhookPayload struct {
+	Subject string        `json:"subject"`
+	Text    string        `json:"text"`
+	Event   *webhookEvent `json:"event,omitempty"`
+}
+
+type webhookEvent struct {
+	Type       string    `json:"type"`
+	CreatedAt  time.Time `json:"created_at"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	Repository string    `json:"repository"`
+	Number     int       `json:"number,omitempty"`
+	Thread     string    `json:"thread,omitempty"`
+	Priority   int       `json:"priority"`
+	Tag        string    `json:"tag,omitempty"`
+}
+
+// Notify implements the Notifier interface.
+func (wh *Webhook) Notify(event *events.Event) error {
+	return post(wh.Context, wh.Client, wh.URL, webhookPayload{
+		Subject: event.Title,
+		Text:    eventText(wh.BaseURL, event),
+		Event: &webhookEvent{
+			Type:       event.Type,
+			CreatedAt:  event.CreatedAt,
+			Actor:      event.Actor,
+			Action:     event.Action,
+			Repository: event.Repository,
+			Number:     event.Number,
+			Thread:     event.ThreadKey(),
+			Priority:   event.Priority,
+			Tag:        event.Tag,
+		},
+	})
+}
+
+// send implements the sender interface.
+func (wh *Webhook) send(subject, text string) error {
+	return post(wh.Context, wh.Client, wh.URL, webhookPayload{Subject: subject, Text: text})
+}
+
+// Slack is a Notifier that sends events to a Slack compatible incoming
+// webhook.
+type Slack struct {
+	Context context.Context // Context of requests, if nil context.Background() is used.
+	Client  *http.Client
+	URL     string
+	BaseURL string
+}
+
+var _ events.Notifier = &Slack{}
+
+// Notify implements the Notifier interface.
+func (s *Slack) Notify(event *events.Event) error {
+	return s.send(event.Title, eventText(s.BaseURL, event))
+}
+
+// send implements the sender interface.
+func (s *Slack) send(subject, text string) error {
+	return post(s.Context, s.Client, s.URL, struct {
+		Text string `json:"text"`
+	}{fmt.Sprintf("*%s*\n%s", subject, text)})
+}
+
+// post sends payload as JSON to url, returning an error if the response is
+// not successful.
+func post(ctx context.Context, client *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal webhook payload")
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "could not create webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ctx != nil {
+		req = req.WithContext(ctx)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "could not post webhook")
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %q", resp.Status)
+	}
+	return nil
+}
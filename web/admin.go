@@ -0,0 +1,188 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexedwards/scs/session"
+	"github.com/bradleyfalzon/maintainer.me/db"
+	"github.com/go-chi/chi"
+)
+
+// impersonateKey is the session key of the userID an admin is impersonating.
+const impersonateKey = "impersonateUserID"
+
+// deliveryFailureWindow is how far back notification delivery failures are
+// shown in the admin console.
+const deliveryFailureWindow = 7 * 24 * time.Hour
+
+// RequireAdmin is middleware that requires the logged in user to be an admin,
+// regardless of whether they are impersonating another user. If not logged in
+// the user is redirected to /login, if not an admin a HTTP Not Found error is
+// displayed.
+//
+// Also adds the admin's db.User type to context.
+func (c *Console) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := session.GetInt(r, "userID")
+		if err != nil {
+			c.logger.WithError(err).Error("RequireAdmin could not get userID from session")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if userID == 0 {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		user, err := c.db.User(r.Context(), userID)
+		if err != nil {
+			c.logger.WithError(err).Errorf("RequireAdmin could not get userID %v", userID)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		if !user.Admin {
+			http.NotFound(w, r)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), userCtxKey{}, user))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// impersonatedUser returns the user an admin is impersonating, or nil if the
+// admin is not impersonating a user.
+func (c *Console) impersonatedUser(r *http.Request) (*db.User, error) {
+	userID, err := session.GetInt(r, impersonateKey)
+	if err != nil || userID == 0 {
+		return nil, err
+	}
+	return c.db.User(r.Context(), userID)
+}
+
+// Admin is the handler to view all users and the status of their polling
+// and notifications.
+func (c *Console) Admin(w http.ResponseWriter, r *http.Request) {
+	logger := c.loggerFromRequest(r)
+
+	users, err := c.db.AdminUsers(r.Context(), time.Now().Add(-deliveryFailureWindow))
+	if err != nil {
+		logger.WithError(err).Error("could not get users")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	page := struct {
+		header
+		Users []db.AdminUser
+	}{c.header(r, "Admin - Maintainer.Me"), users}
+
+	c.render(w, logger, "console-admin.tmpl", page)
+}
+
+// adminTarget returns the user identified by the userID URL parameter. If an
+// error occurs or the user does not exist, an error is written to w and nil
+// is returned.
+func (c *Console) adminTarget(w http.ResponseWriter, r *http.Request) *db.User {
+	logger := c.loggerFromRequest(r)
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 32)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return nil
+	}
+
+	target, err := c.db.User(r.Context(), int(userID))
+	if err != nil {
+		logger.WithError(err).Errorf("could not get userID %v", userID)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil
+	}
+	if target == nil {
+		http.NotFound(w, r)
+		return nil
+	}
+	return target
+}
+
+// AdminUserPause pauses or resumes polling a user, based on the paused form
+// value.
+func (c *Console) AdminUserPause(w http.ResponseWriter, r *http.Request) {
+	logger := c.loggerFromRequest(r)
+
+	target := c.adminTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	paused := r.FormValue("paused") == "true"
+	if err := c.db.UserPollPausedUpdate(r.Context(), target.ID, paused); err != nil {
+		logger.WithError(err).Error("could not update user's poll paused")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.WithField("targetUserID", target.ID).Infof("successfully set user's poll paused to %v", paused)
+	http.Redirect(w, r, "/admin", http.StatusFound)
+}
+
+// AdminUserPoll schedules a user to be polled in the next poll.
+func (c *Console) AdminUserPoll(w http.ResponseWriter, r *http.Request) {
+	logger := c.loggerFromRequest(r)
+
+	target := c.adminTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	if err := c.db.UserPollNow(r.Context(), target.ID); err != nil {
+		logger.WithError(err).Error("could not schedule user's poll")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.WithField("targetUserID", target.ID).Info("successfully scheduled user's poll")
+	http.Redirect(w, r, "/admin", http.StatusFound)
+}
+
+// AdminUserImpersonate starts impersonating a user, the admin views the
+// console as the user but cannot make changes.
+func (c *Console) AdminUserImpersonate(w http.ResponseWriter, r *http.Request) {
+	logger := c.loggerFromRequest(r)
+
+	target := c.adminTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	if err := session.PutInt(r, impersonateKey, target.ID); err != nil {
+		logger.WithError(err).Error("could not start impersonating user")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.WithField("targetUserID", target.ID).Info("successfully started impersonating user")
+	http.Redirect(w, r, "/console", http.StatusFound)
+}
+
+// AdminImpersonateStop stops impersonating a user.
+func (c *Console) AdminImpersonateStop(w http.ResponseWriter, r *http.Request) {
+	logger := c.loggerFromRequest(r)
+
+	if err := session.PutInt(r, impersonateKey, 0); err != nil {
+		logger.WithError(err).Error("could not stop impersonating user")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("successfully stopped impersonating user")
+	http.Redirect(w, r, "/admin", http.StatusFound)
+}
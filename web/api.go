@@ -0,0 +1,714 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/bradleyfalzon/maintainer.me/db"
+	"github.com/bradleyfalzon/maintainer.me/ghhost"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// API is a JSON API providing access to a user's settings, filters, events
+// and notification channels. Requests are authenticated by a session or
+// personal API token, see Console.RequireLoginOrToken.
+type API struct {
+	logger   *logrus.Entry
+	db       db.DB
+	threads  notificationThreads
+	verifier ChannelVerifier
+}
+
+// NewAPI returns a new API instance. Requests to GitHub's API use cache as
+// the transport.
+func NewAPI(logger *logrus.Entry, db db.DB, cache http.RoundTripper, hosts ghhost.Hosts, verifier ChannelVerifier) *API {
+	return &API{
+		logger:   logger,
+		db:       db,
+		threads:  notificationThreads{hosts: hosts, rt: cache},
+		verifier: verifier,
+	}
+}
+
+// newAPIToken returns a new random API token and its hash.
+func newAPIToken() (token, hash string, err error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", errors.Wrap(err, "could not read random bytes")
+	}
+	token = hex.EncodeToString(b)
+	return token, hashAPIToken(token), nil
+}
+
+// hashAPIToken returns the hash of an API token as stored in the DB.
+func hashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func (a *API) loggerFromRequest(r *http.Request) *logrus.Entry {
+	user := userFromContext(r.Context())
+	return a.logger.WithFields(logrus.Fields{
+		"requestURI":    r.RequestURI,
+		"requestMethod": r.Method,
+		"userID":        user.ID,
+	})
+}
+
+// respond writes v as JSON with the HTTP status code.
+func (a *API) respond(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if v == nil {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.logger.WithError(err).Error("could not encode JSON response")
+	}
+}
+
+// error writes an error message as JSON, if message is blank the status
+// text is used.
+func (a *API) error(w http.ResponseWriter, status int, message string) {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	a.respond(w, status, struct {
+		Error string `json:"error"`
+	}{message})
+}
+
+// decode decodes the request's JSON body into v, writing an error and
+// returning false if the body is invalid.
+func (a *API) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		a.error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// urlParamID parses the URL parameter key as an ID, writing an error and
+// returning false if it's invalid.
+func (a *API) urlParamID(w http.ResponseWriter, r *http.Request, key string) (int, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, key), 10, 32)
+	if err != nil {
+		a.error(w, http.StatusBadRequest, "invalid "+key)
+		return 0, false
+	}
+	return int(id), true
+}
+
+type apiSettings struct {
+	Email                string `json:"email"`
+	GitHubLogin          string `json:"github_login"`
+	FilterDefaultDiscard bool   `json:"filter_default_discard"`
+	Timezone             string `json:"timezone"`
+	QuietHoursStart      int    `json:"quiet_hours_start"`
+	QuietHoursEnd        int    `json:"quiet_hours_end"`
+
+	NotificationsEnabled  bool `json:"notifications_enabled"`
+	NotificationsMarkRead bool `json:"notifications_mark_read"`
+}
+
+func newAPISettings(user *db.User) apiSettings {
+	return apiSettings{
+		Email:                user.Email,
+		GitHubLogin:          user.GitHubLogin,
+		FilterDefaultDiscard: user.FilterDefaultDiscard,
+		Timezone:             user.Timezone,
+		QuietHoursStart:      user.QuietHoursStart,
+		QuietHoursEnd:        user.QuietHoursEnd,
+
+		NotificationsEnabled:  user.NotificationsEnabled,
+		NotificationsMarkRead: user.NotificationsMarkRead,
+	}
+}
+
+// Settings returns the user's settings.
+func (a *API) Settings(w http.ResponseWriter, r *http.Request) {
+	a.respond(w, http.StatusOK, newAPISettings(userFromContext(r.Context())))
+}
+
+// SettingsUpdate updates the user's settings, email and github_login are
+// read only.
+func (a *API) SettingsUpdate(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = a.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	settings := newAPISettings(user)
+	if !a.decode(w, r, &settings) {
+		return
+	}
+
+	if _, err := time.LoadLocation(settings.Timezone); err != nil {
+		a.error(w, http.StatusBadRequest, "unknown timezone "+strconv.Quote(settings.Timezone))
+		return
+	}
+	if settings.QuietHoursStart < 0 || settings.QuietHoursStart > 23 || settings.QuietHoursEnd < 0 || settings.QuietHoursEnd > 23 {
+		a.error(w, http.StatusBadRequest, "quiet hours must be between 0 and 23")
+		return
+	}
+
+	enableNotifications := !user.NotificationsEnabled && settings.NotificationsEnabled
+	if enableNotifications {
+		granted, err := a.threads.granted(r.Context(), user)
+		if err != nil {
+			logger.WithError(err).Error("could not get user's token scopes")
+			a.error(w, http.StatusInternalServerError, "")
+			return
+		}
+		if !granted {
+			a.error(w, http.StatusForbidden, "log in again to grant access to your GitHub notifications")
+			return
+		}
+	}
+
+	user.FilterDefaultDiscard = settings.FilterDefaultDiscard
+	user.Timezone = settings.Timezone
+	user.QuietHoursStart = settings.QuietHoursStart
+	user.QuietHoursEnd = settings.QuietHoursEnd
+	user.NotificationsEnabled = settings.NotificationsEnabled
+	user.NotificationsMarkRead = settings.NotificationsMarkRead
+
+	if err := a.db.UserUpdate(r.Context(), user); err != nil {
+		logger.WithError(err).Error("could not update user")
+		a.error(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if enableNotifications {
+		if err := a.db.SetUsersNotificationsSince(r.Context(), user.ID, time.Now()); err != nil {
+			logger.WithError(err).Error("could not set user's notifications since")
+			a.error(w, http.StatusInternalServerError, "")
+			return
+		}
+	}
+
+	a.respond(w, http.StatusOK, newAPISettings(user))
+}
+
+type apiCondition struct {
+	ID                         int    `json:"id"`
+	FilterID                   int    `json:"filter_id"`
+	Description                string `json:"description"`
+	Negate                     bool   `json:"negate"`
+	Type                       string `json:"type"`
+	PayloadAction              string `json:"payload_action"`
+	PayloadIssueLabel          string `json:"payload_issue_label"`
+	PayloadIssueMilestoneTitle string `json:"payload_issue_milestone_title"`
+	PayloadIssueTitleRegexp    string `json:"payload_issue_title_regexp"`
+	PayloadIssueBodyRegexp     string `json:"payload_issue_body_regexp"`
+	Public                     bool   `json:"public"`
+	OrganizationID             int    `json:"organization_id"`
+	RepositoryID               int    `json:"repository_id"`
+}
+
+func newAPICondition(c db.Condition) apiCondition {
+	return apiCondition{
+		ID:                         c.ID,
+		FilterID:                   c.FilterID,
+		Description:                c.String(),
+		Negate:                     c.Negate,
+		Type:                       c.Type,
+		PayloadAction:              c.PayloadAction,
+		PayloadIssueLabel:          c.PayloadIssueLabel,
+		PayloadIssueMilestoneTitle: c.PayloadIssueMilestoneTitle,
+		PayloadIssueTitleRegexp:    c.PayloadIssueTitleRegexp,
+		PayloadIssueBodyRegexp:     c.PayloadIssueBodyRegexp,
+		Public:                     c.Public,
+		OrganizationID:             c.OrganizationID,
+		RepositoryID:               c.RepositoryID,
+	}
+}
+
+// condition returns the db.Condition for filterID.
+func (c apiCondition) condition(filterID int) *db.Condition {
+	return &db.Condition{
+		FilterID:                   filterID,
+		Negate:                     c.Negate,
+		Type:                       c.Type,
+		PayloadAction:              c.PayloadAction,
+		PayloadIssueLabel:          c.PayloadIssueLabel,
+		PayloadIssueMilestoneTitle: c.PayloadIssueMilestoneTitle,
+		PayloadIssueTitleRegexp:    c.PayloadIssueTitleRegexp,
+		PayloadIssueBodyRegexp:     c.PayloadIssueBodyRegexp,
+		Public:                     c.Public,
+		OrganizationID:             c.OrganizationID,
+		RepositoryID:               c.RepositoryID,
+	}
+}
+
+type apiFilter struct {
+	ID             int            `json:"id"`
+	OnMatchDiscard bool           `json:"on_match_discard"`
+	Urgent         bool           `json:"urgent"`
+	Priority       int            `json:"priority"`
+	Tag            string         `json:"tag"`
+	Channels       []string       `json:"channels"`
+	Conditions     []apiCondition `json:"conditions"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+func newAPIFilter(f db.Filter) apiFilter {
+	filter := apiFilter{
+		ID:             f.ID,
+		OnMatchDiscard: f.OnMatchDiscard,
+		Urgent:         f.Urgent,
+		Priority:       f.Priority,
+		Tag:            f.Tag,
+		Channels:       f.Channels,
+		Conditions:     []apiCondition{},
+		CreatedAt:      f.CreatedAt,
+		UpdatedAt:      f.UpdatedAt,
+	}
+	if filter.Channels == nil {
+		filter.Channels = []string{}
+	}
+	for _, c := range f.Conditions {
+		filter.Conditions = append(filter.Conditions, newAPICondition(c))
+	}
+	return filter
+}
+
+// update sets the filter's actions from the apiFilter.
+func (f apiFilter) update(filter *db.Filter) {
+	filter.OnMatchDiscard = f.OnMatchDiscard
+	filter.Urgent = f.Urgent
+	filter.Priority = f.Priority
+	filter.Tag = strings.TrimSpace(f.Tag)
+	filter.SetChannels(f.Channels)
+}
+
+// usersFilter returns the user's filter from the filterID URL parameter,
+// writing an error and returning nil if the filter was not found.
+func (a *API) usersFilter(w http.ResponseWriter, r *http.Request, logger *logrus.Entry) *db.Filter {
+	filterID, ok := a.urlParamID(w, r, "filterID")
+	if !ok {
+		return nil
+	}
+
+	filter, err := a.db.Filter(r.Context(), filterID)
+	if err != nil {
+		logger.WithError(err).Errorf("could not get filter %v", filterID)
+		a.error(w, http.StatusInternalServerError, "")
+		return nil
+	}
+
+	if filter == nil || filter.UserID != userFromContext(r.Context()).ID {
+		a.error(w, http.StatusNotFound, "filter not found")
+		return nil
+	}
+	return filter
+}
+
+// Filters returns the user's filters.
+func (a *API) Filters(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = a.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	filters, err := a.db.UsersFilters(r.Context(), user.ID)
+	if err != nil {
+		logger.WithError(err).Error("could not get user's filters")
+		a.error(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	resp := []apiFilter{}
+	for _, filter := range filters {
+		resp = append(resp, newAPIFilter(filter))
+	}
+	a.respond(w, http.StatusOK, resp)
+}
+
+// Filter returns a single filter.
+func (a *API) Filter(w http.ResponseWriter, r *http.Request) {
+	logger := a.loggerFromRequest(r)
+	if filter := a.usersFilter(w, r, logger); filter != nil {
+		a.respond(w, http.StatusOK, newAPIFilter(*filter))
+	}
+}
+
+// FilterCreate creates a filter and its conditions.
+func (a *API) FilterCreate(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = a.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	var req apiFilter
+	if !a.decode(w, r, &req) {
+		return
+	}
+
+	filter := &db.Filter{UserID: user.ID}
+	req.update(filter)
+	if !validFilterActions(filter) {
+		a.error(w, http.StatusBadRequest, "tag must be at most 64 characters and channels at most 255")
+		return
+	}
+
+	filterID, err := a.db.FilterCreate(r.Context(), filter)
+	if err != nil {
+		logger.WithError(err).Error("could not create filter")
+		a.error(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	for _, c := range req.Conditions {
+		if _, err := a.db.ConditionCreate(r.Context(), c.condition(filterID)); err != nil {
+			logger.WithError(err).Error("could not create condition")
+			// Without all its conditions the filter could match more events
+			// than requested, so don't leave it half created.
+			if err := a.db.FilterDelete(r.Context(), user.ID, filterID); err != nil {
+				logger.WithError(err).WithField("filterID", filterID).Error("could not delete filter with missing conditions")
+			}
+			a.error(w, http.StatusInternalServerError, "")
+			return
+		}
+	}
+
+	logger.WithField("filterID", filterID).Info("successfully added filter")
+
+	filter, err = a.db.Filter(r.Context(), filterID)
+	if err != nil || filter == nil {
+		logger.WithError(err).Error("could not get created filter")
+		a.error(w, http.StatusInternalServerError, "")
+		return
+	}
+	a.respond(w, http.StatusCreated, newAPIFilter(*filter))
+}
+
+// FilterUpdate updates a filter's actions, conditions are not modified.
+func (a *API) FilterUpdate(w http.ResponseWriter, r *http.Request) {
+	logger := a.loggerFromRequest(r)
+
+	filter := a.usersFilter(w, r, logger)
+	if filter == nil {
+		return
+	}
+
+	req := newAPIFilter(*filter)
+	if !a.decode(w, r, &req) {
+		return
+	}
+	req.update(filter)
+	if !validFilterActions(filter) {
+		a.error(w, http.StatusBadRequest, "tag must be at most 64 characters and channels at most 255")
+		return
+	}
+
+	if err := a.db.FilterUpdate(r.Context(), filter); err != nil {
+		logger.WithError(err).Error("could not update filter")
+		a.error(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	a.respond(w, http.StatusOK, newAPIFilter(*filter))
+}
+
+// FilterDelete deletes a filter and its conditions.
+func (a *API) FilterDelete(w http.ResponseWriter, r *http.Request) {
+	logger := a.loggerFromRequest(r)
+
+	filter := a.usersFilter(w, r, logger)
+	if filter == nil {
+		return
+	}
+
+	if err := a.db.FilterDelete(r.Context(), filter.UserID, filter.ID); err != nil {
+		logger.WithError(err).Error("could not delete filter")
+		a.error(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	a.respond(w, http.StatusNoContent, nil)
+}
+
+// ConditionCreate adds a condition to a filter.
+func (a *API) ConditionCreate(w http.ResponseWriter, r *http.Request) {
+	logger := a.loggerFromRequest(r)
+
+	filter := a.usersFilter(w, r, logger)
+	if filter == nil {
+		return
+	}
+
+	var req apiCondition
+	if !a.decode(w, r, &req) {
+		return
+	}
+
+	condition := req.condition(filter.ID)
+	conditionID, err := a.db.ConditionCreate(r.Context(), condition)
+	if err != nil {
+		logger.WithError(err).Error("could not create condition")
+		a.error(w, http.StatusInternalServerError, "")
+		return
+	}
+	condition.ID = conditionID
+
+	a.respond(w, http.StatusCreated, newAPICondition(*condition))
+}
+
+// ConditionDelete deletes a condition.
+func (a *API) ConditionDelete(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = a.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	conditionID, ok := a.urlParamID(w, r, "conditionID")
+	if !ok {
+		return
+	}
+
+	if err := a.db.ConditionDelete(r.Context(), user.ID, conditionID); err != nil {
+		logger.WithError(err).Error("could not delete condition")
+		a.error(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	a.respond(w, http.StatusNoContent, nil)
+}
+
+type apiEvent struct {
+	ID         int        `json:"id"`
+	GitHubID   string     `json:"github_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Type       string     `json:"type"`
+	Public     bool       `json:"public"`
+	Repository string     `json:"repository"`
+	Number     int        `json:"number,omitempty"`
+	Thread     string     `json:"thread,omitempty"`
+	Actor      string     `json:"actor"`
+	Action     string     `json:"action"`
+	Subject    string     `json:"subject"`
+	Title      string     `json:"title"`
+	Body       string     `json:"body"`
+	Discarded  bool       `json:"discarded"`
+	Muted      bool       `json:"muted"`
+	Priority   int        `json:"priority"`
+	Tag        string     `json:"tag"`
+	ReadAt     *time.Time `json:"read_at"`
+	Archived   bool       `json:"archived"`
+	Starred    bool       `json:"starred"`
+}
+
+func newAPIEvent(e db.Event) apiEvent {
+	return apiEvent{
+		ID:         e.ID,
+		GitHubID:   e.GitHubID,
+		CreatedAt:  e.CreatedAt,
+		Type:       e.Type,
+		Public:     e.Public,
+		Repository: e.Repository,
+		Number:     e.Number,
+		Thread:     db.ThreadKey(e.Repository, e.Number),
+		Actor:      e.Actor,
+		Action:     e.Action,
+		Subject:    e.Subject,
+		Title:      e.Title,
+		Body:       e.Body,
+		Discarded:  e.Discarded,
+		Muted:      e.Muted,
+		Priority:   e.Priority,
+		Tag:        e.Tag,
+		ReadAt:     e.ReadAt,
+		Archived:   e.Archived,
+		Starred:    e.Starred,
+	}
+}
+
+// Events returns a page of the user's stored events, accepting the same
+// query parameters as the console's events page.
+func (a *API) Events(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = a.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	query := db.EventQuery{
+		Search:     r.FormValue("q"),
+		Repository: r.FormValue("repository"),
+		Type:       r.FormValue("type"),
+		Actor:      r.FormValue("actor"),
+		Status:     r.FormValue("status"),
+		Folder:     r.FormValue("folder"),
+		PerPage:    100,
+	}
+	query.Page, _ = strconv.Atoi(r.FormValue("page"))
+	if query.Page < 1 {
+		query.Page = 1
+	}
+
+	storedEvents, err := a.db.UsersEvents(r.Context(), user.ID, query)
+	if err != nil {
+		logger.WithError(err).Error("could not get user's events")
+		a.error(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	resp := struct {
+		Events   []apiEvent `json:"events"`
+		NextPage int        `json:"next_page,omitempty"`
+	}{Events: []apiEvent{}}
+	for _, event := range storedEvents {
+		resp.Events = append(resp.Events, newAPIEvent(event))
+	}
+	if len(storedEvents) == query.PerPage {
+		resp.NextPage = query.Page + 1
+	}
+	a.respond(w, http.StatusOK, resp)
+}
+
+// EventUpdate performs a triage action on an event, such as read or star.
+func (a *API) EventUpdate(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = a.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	eventID, ok := a.urlParamID(w, r, "eventID")
+	if !ok {
+		return
+	}
+
+	action := chi.URLParam(r, "action")
+	if !eventActions[action] {
+		a.error(w, http.StatusBadRequest, "unknown action "+strconv.Quote(action))
+		return
+	}
+
+	events, err := a.db.UsersEventsByID(r.Context(), user.ID, []int{eventID})
+	if err != nil {
+		logger.WithError(err).Error("could not get event")
+		a.error(w, http.StatusInternalServerError, "")
+		return
+	}
+	if len(events) == 0 {
+		a.error(w, http.StatusNotFound, "event not found")
+		return
+	}
+
+	if _, err := updateEvent(r.Context(), a.db, a.threads, user, eventID, action); err != nil {
+		logger.WithError(err).Error("could not update event")
+		a.error(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	a.respond(w, http.StatusNoContent, nil)
+}
+
+type apiChannel struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	Target     string     `json:"target"`
+	VerifiedAt *time.Time `json:"verified_at"`
+}
+
+func newAPIChannel(c db.NotificationChannel) apiChannel {
+	return apiChannel{
+		ID:         c.ID,
+		Name:       c.Name,
+		Type:       c.Type,
+		Target:     c.Target,
+		VerifiedAt: c.VerifiedAt,
+	}
+}
+
+// Channels returns the user's notification channels.
+func (a *API) Channels(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = a.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	channels, err := a.db.UsersNotificationChannels(r.Context(), user.ID)
+	if err != nil {
+		logger.WithError(err).Error("could not get user's notification channels")
+		a.error(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	resp := []apiChannel{}
+	for _, channel := range channels {
+		resp = append(resp, newAPIChannel(channel))
+	}
+	a.respond(w, http.StatusOK, resp)
+}
+
+// ChannelCreate creates a notification channel and sends its verification.
+func (a *API) ChannelCreate(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = a.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	var req apiChannel
+	if !a.decode(w, r, &req) {
+		return
+	}
+
+	channel := &db.NotificationChannel{
+		UserID:      user.ID,
+		Name:        strings.TrimSpace(req.Name),
+		Type:        req.Type,
+		Target:      strings.TrimSpace(req.Target),
+		VerifyToken: uuid.New().String(),
+	}
+	if !validChannel(channel) {
+		a.error(w, http.StatusBadRequest, "invalid name, type or target")
+		return
+	}
+
+	channelID, err := a.db.NotificationChannelCreate(r.Context(), channel)
+	if err != nil {
+		logger.WithError(err).Error("could not create notification channel")
+		a.error(w, http.StatusInternalServerError, "")
+		return
+	}
+	channel.ID = channelID
+
+	if err := a.verifier.SendVerification(r.Context(), *channel); err != nil {
+		logger.WithError(err).Error("could not send notification channel verification")
+	}
+
+	a.respond(w, http.StatusCreated, newAPIChannel(*channel))
+}
+
+// ChannelDelete deletes a notification channel.
+func (a *API) ChannelDelete(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = a.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	channelID, ok := a.urlParamID(w, r, "channelID")
+	if !ok {
+		return
+	}
+
+	if err := a.db.NotificationChannelDelete(r.Context(), user.ID, channelID); err != nil {
+		logger.WithError(err).Error("could not delete notification channel")
+		a.error(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	a.respond(w, http.StatusNoContent, nil)
+}
@@ -3,10 +3,16 @@ package web
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"html/template"
 	"io"
+	"net"
 	"net/http"
+	"net/mail"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -14,34 +20,46 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/alexedwards/scs/session"
 	"github.com/bradleyfalzon/maintainer.me/db"
-	"github.com/bradleyfalzon/maintainer.me/events"
+	"github.com/bradleyfalzon/maintainer.me/ghhost"
+	"github.com/bradleyfalzon/maintainer.me/notifier"
 	"github.com/go-chi/chi"
 	"github.com/google/go-github/github"
 	"github.com/google/uuid"
 	schema "github.com/gorilla/Schema"
+	"github.com/pkg/errors"
 )
 
 type Console struct {
-	logger      *logrus.Entry
-	db          db.DB
-	cache       http.RoundTripper
-	templates   *template.Template
-	ghoauthConf *oauth2.Config
+	logger    *logrus.Entry
+	db        db.DB
+	cache     http.RoundTripper
+	templates *template.Template
+	hosts     ghhost.Hosts
+	threads   notificationThreads
+	verifier  ChannelVerifier
+}
+
+// ChannelVerifier sends the verification message to a new notification
+// channel.
+type ChannelVerifier interface {
+	SendVerification(ctx context.Context, channel db.NotificationChannel) error
 }
 
 // NewConsole returns a new console instance.
-func NewConsole(logger *logrus.Entry, db db.DB, cache http.RoundTripper, ghoauthConf *oauth2.Config) (*Console, error) {
+func NewConsole(logger *logrus.Entry, db db.DB, cache http.RoundTripper, hosts ghhost.Hosts, verifier ChannelVerifier) (*Console, error) {
 	templates, err := template.ParseGlob("web/templates/console-*.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	return &Console{
-		logger:      logger,
-		db:          db,
-		cache:       cache,
-		templates:   templates,
-		ghoauthConf: ghoauthConf,
+		logger:    logger,
+		db:        db,
+		cache:     cache,
+		templates: templates,
+		hosts:     hosts,
+		threads:   notificationThreads{hosts: hosts, rt: cache},
+		verifier:  verifier,
 	}, nil
 }
 
@@ -55,14 +73,25 @@ func (c *Console) render(w http.ResponseWriter, logger *logrus.Entry, template s
 	io.Copy(w, buf)
 }
 
-const ghOAuthStateKey = "ghOAuthState"
+const (
+	ghOAuthStateKey = "ghOAuthState"
+	ghHostKey       = "ghHost"
+)
 
-// Login is the handler to view the console page.
+// Login is the handler to view the console page. The user logs in with the
+// GitHub host named by the host query parameter, or GitHub.com if not set.
 func (c *Console) Login(w http.ResponseWriter, r *http.Request) {
+	host := c.hosts.Get(r.FormValue("host"))
+	if host == nil {
+		http.Error(w, "Unknown GitHub host", http.StatusBadRequest)
+		return
+	}
+
 	uuid := uuid.New()
 	session.PutString(r, ghOAuthStateKey, uuid.String())
+	session.PutString(r, ghHostKey, host.Name)
 
-	url := c.ghoauthConf.AuthCodeURL(uuid.String(), oauth2.AccessTypeOnline)
+	url := host.OAuth.AuthCodeURL(uuid.String(), oauth2.AccessTypeOnline)
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
@@ -84,7 +113,20 @@ func (c *Console) LoginCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := c.ghoauthConf.Exchange(r.Context(), r.FormValue("code"))
+	hostName, err := session.PopString(r, ghHostKey)
+	if err != nil {
+		logger.WithError(err).Errorf("could not get session's %v", ghHostKey)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	host := c.hosts.Get(hostName)
+	if host == nil {
+		logger.Errorf("unknown GitHub host %q", hostName)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	token, err := host.OAuth.Exchange(r.Context(), r.FormValue("code"))
 	if err != nil {
 		logger.WithError(err).Errorf("could not exchange oauth code %q for token", r.FormValue("code"))
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -92,7 +134,7 @@ func (c *Console) LoginCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create oauth client
-	client := c.githubClient(r.Context(), token)
+	client := host.UserClient(r.Context(), c.cache, token)
 
 	// Get GitHub ID
 	ghUser, _, err := client.Users.Get(r.Context(), "")
@@ -109,7 +151,7 @@ func (c *Console) LoginCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create or Update user's account with GitHub ID
-	userID, err := c.db.GitHubLogin(r.Context(), ghUser.GetEmail(), ghUser.GetID(), ghUser.GetLogin(), token)
+	userID, err := c.db.GitHubLogin(r.Context(), host.Name, ghUser.GetEmail(), ghUser.GetID(), ghUser.GetLogin(), token)
 	if err != nil {
 		logger.WithError(err).Error("could not user's ID")
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -118,6 +160,7 @@ func (c *Console) LoginCallback(w http.ResponseWriter, r *http.Request) {
 
 	logger.WithFields(logrus.Fields{
 		"userID":      userID,
+		"githubHost":  host.Name,
 		"githubID":    ghUser.GetID(),
 		"githubLogin": ghUser.GetLogin(),
 	}).Info("User logged in")
@@ -128,14 +171,27 @@ func (c *Console) LoginCallback(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/console", http.StatusSeeOther)
 }
 
-func (c *Console) githubClient(ctx context.Context, token *oauth2.Token) *github.Client {
-	hClient := http.DefaultClient
-	hClient.Transport = c.cache
+// Logout is the handler to log the user out, destroying their session.
+func (c *Console) Logout(w http.ResponseWriter, r *http.Request) {
+	logger := c.logger.WithField("requestURI", r.RequestURI)
+
+	if err := session.Destroy(w, r); err != nil {
+		logger.WithError(err).Error("could not destroy session")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
 
-	ctx = context.WithValue(ctx, oauth2.HTTPClient, hClient)
-	oauthClient := c.ghoauthConf.Client(ctx, token)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
 
-	return github.NewClient(oauthClient)
+// githubClient returns a GitHub client for the user's host, authenticated as
+// the user.
+func (c *Console) githubClient(ctx context.Context, user *db.User) (*github.Client, error) {
+	host := c.hosts.Get(user.GitHubHost)
+	if host == nil {
+		return nil, errors.Errorf("unknown GitHub host %q", user.GitHubHost)
+	}
+	return host.UserClient(ctx, c.cache, user.GitHubToken), nil
 }
 
 type userCtxKey struct{}
@@ -146,6 +202,15 @@ func userFromContext(ctx context.Context) *db.User {
 	return ctx.Value(userCtxKey{}).(*db.User)
 }
 
+type impersonatorCtxKey struct{}
+
+// impersonatorFromContext returns the admin impersonating the context's user,
+// or nil if the user is not being impersonated.
+func impersonatorFromContext(ctx context.Context) *db.User {
+	impersonator, _ := ctx.Value(impersonatorCtxKey{}).(*db.User)
+	return impersonator
+}
+
 // RequireLogin is middleware that loads a user's session and they
 // are logged in, and with a valid account. If not, the user is redirected
 // to /login. If an error occurs, a HTTP Internal Server Error is displayed.
@@ -176,6 +241,24 @@ func (c *Console) RequireLogin(next http.Handler) http.Handler {
 			return
 		}
 
+		if user.Admin {
+			impersonated, err := c.impersonatedUser(r)
+			if err != nil {
+				c.logger.WithError(err).Error("RequireLogin could not get impersonated user")
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if impersonated != nil {
+				// Admins impersonate users read only, for support.
+				if r.Method != http.MethodGet && r.Method != http.MethodHead {
+					http.Error(w, "Read only while impersonating a user", http.StatusForbidden)
+					return
+				}
+				r = r.WithContext(context.WithValue(r.Context(), impersonatorCtxKey{}, user))
+				user = impersonated
+			}
+		}
+
 		r = r.WithContext(context.WithValue(r.Context(), userCtxKey{}, user))
 
 		// TODO check if oauth credential is still valid?
@@ -188,13 +271,115 @@ func (c *Console) RequireLogin(next http.Handler) http.Handler {
 	})
 }
 
+// RequireLoginOrToken is middleware that authenticates a request using
+// either the API token in the Authorization header, such as
+// "Authorization: Bearer <token>", or the user's session. Read only tokens
+// may only be used for GET and HEAD requests. If the request is not
+// authenticated, a HTTP Unauthorized error is displayed.
+//
+// Also adds db.User type to context.
+func (c *Console) RequireLoginOrToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			userID int
+			err    error
+		)
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			if !strings.HasPrefix(auth, "Bearer ") {
+				http.Error(w, "Authorization header must be a bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			token, err := c.db.APITokenByHash(r.Context(), hashAPIToken(strings.TrimPrefix(auth, "Bearer ")))
+			if err != nil {
+				c.logger.WithError(err).Error("RequireLoginOrToken could not get api token")
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if token == nil {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			if token.Scope != db.APITokenScopeWrite && r.Method != http.MethodGet && r.Method != http.MethodHead {
+				http.Error(w, "API token is read only", http.StatusForbidden)
+				return
+			}
+			if err := c.db.APITokenUsed(r.Context(), token.ID, time.Now()); err != nil {
+				c.logger.WithError(err).Error("RequireLoginOrToken could not update api token's last used time")
+			}
+			userID = token.UserID
+		} else {
+			userID, err = session.GetInt(r, "userID")
+			if err != nil {
+				c.logger.WithError(err).Error("RequireLoginOrToken could not get userID from session")
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+		}
+		if userID == 0 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		user, err := c.db.User(r.Context(), userID)
+		if err != nil {
+			c.logger.WithError(err).Errorf("RequireLoginOrToken could not get userID %v", userID)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), userCtxKey{}, user))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// header is embedded in each console page and contains the data used by
+// the console-header template.
+type header struct {
+	Title         string
+	CSRFToken     string // CSRFToken must be sent with forms and requests that change state.
+	UnreadCount   int    // UnreadCount is the number of unread events in the user's inbox.
+	Admin         bool   // Admin is true if the logged in user is an admin.
+	Impersonating string // Impersonating is the login of the user an admin is impersonating, if any.
+}
+
+// header returns the header for a console page with title.
+func (c *Console) header(r *http.Request, title string) header {
+	user := userFromContext(r.Context())
+	unread, err := c.db.UsersUnreadCount(r.Context(), user.ID)
+	if err != nil {
+		// Not worth failing the page for.
+		c.loggerFromRequest(r).WithError(err).Error("could not get user's unread count")
+	}
+	h := header{
+		Title:       title,
+		CSRFToken:   csrfTokenFromContext(r.Context()),
+		UnreadCount: unread,
+		Admin:       user.Admin,
+	}
+	if impersonator := impersonatorFromContext(r.Context()); impersonator != nil {
+		h.Admin = true
+		h.Impersonating = user.GitHubLogin
+	}
+	return h
+}
+
 func (c *Console) loggerFromRequest(r *http.Request) *logrus.Entry {
 	user := userFromContext(r.Context())
-	return c.logger.WithFields(logrus.Fields{
+	fields := logrus.Fields{
 		"requestURI":    r.RequestURI,
 		"requestMethod": r.Method,
 		"userID":        user.ID,
-	})
+	}
+	if impersonator := impersonatorFromContext(r.Context()); impersonator != nil {
+		fields["impersonatorID"] = impersonator.ID
+	}
+	return c.logger.WithFields(fields)
 }
 
 // ConsoleHome is the handler to view the console page.
@@ -206,7 +391,7 @@ func (c *Console) Home(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	c.render(w, logger, "console-home.tmpl", nil)
+	c.render(w, logger, "console-home.tmpl", struct{ header }{c.header(r, "Maintainer.Me")})
 }
 
 // ConsoleEvents is a handler to view events that have been filtered.
@@ -216,265 +401,1594 @@ func (c *Console) Events(w http.ResponseWriter, r *http.Request) {
 		user   = userFromContext(r.Context())
 	)
 
-	filters, err := c.db.UsersFilters(r.Context(), user.ID)
+	query := db.EventQuery{
+		Search:     r.FormValue("q"),
+		Repository: r.FormValue("repository"),
+		Type:       r.FormValue("type"),
+		Actor:      r.FormValue("actor"),
+		Status:     r.FormValue("status"),
+		Folder:     r.FormValue("folder"),
+		PerPage:    50,
+	}
+	switch query.Folder {
+	case "":
+		query.Folder = db.EventFolderInbox
+	case "all":
+		query.Folder = ""
+	}
+	query.Page, _ = strconv.Atoi(r.FormValue("page"))
+	if query.Page < 1 {
+		query.Page = 1
+	}
+
+	storedEvents, err := c.db.UsersEvents(r.Context(), user.ID, query)
 	if err != nil {
-		logger.WithError(err).Error("could not get user's filters")
+		logger.WithError(err).Error("could not get user's events")
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	client := c.githubClient(r.Context(), user.GitHubToken)
-
-	since := -1 * 24 * time.Hour
-
-	allEvents, _, err := events.ListNewEvents(r.Context(), logger, client, user.GitHubLogin, time.Now().Add(since))
+	facets, err := c.db.UsersEventFacets(r.Context(), user.ID, query)
 	if err != nil {
-		logger.WithError(err).Error("could not list new events")
+		logger.WithError(err).Error("could not get user's event facets")
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	allEvents.Filter(filters, user.FilterDefaultDiscard)
+
+	type Facet struct {
+		db.EventFacet
+		URL    string
+		Active bool
+	}
+
+	// facetLinks returns links to toggle each facet's value for the field.
+	facetLinks := func(field string, facets []db.EventFacet) []Facet {
+		var links []Facet
+		for _, facet := range facets {
+			v := eventsValues(query)
+			v.Del("page")
+			active := v.Get(field) == facet.Value
+			if active {
+				v.Del(field)
+			} else {
+				v.Set(field, facet.Value)
+			}
+			links = append(links, Facet{facet, "/console/events?" + v.Encode(), active})
+		}
+		return links
+	}
+
+	pageURL := func(page int) string {
+		v := eventsValues(query)
+		v.Set("page", strconv.Itoa(page))
+		return "/console/events?" + v.Encode()
+	}
 
 	page := struct {
-		Title  string
-		Events events.Events
-		Since  time.Duration
-	}{"Events - Maintainer.Me", allEvents, since}
+		header
+		Query   db.EventQuery
+		Threads []*db.Thread
+		Facets  map[string][]Facet
+		PrevURL string
+		NextURL string
+	}{
+		header:  c.header(r, "Events - Maintainer.Me"),
+		Query:   query,
+		Threads: db.GroupThreads(storedEvents),
+		Facets: map[string][]Facet{
+			"Repository": facetLinks("repository", facets.Repositories),
+			"Type":       facetLinks("type", facets.Types),
+			"Actor":      facetLinks("actor", facets.Actors),
+			"Status":     facetLinks("status", facets.Statuses),
+		},
+	}
+	if query.Page > 1 {
+		page.PrevURL = pageURL(query.Page - 1)
+	}
+	if len(storedEvents) == query.PerPage {
+		page.NextURL = pageURL(query.Page + 1)
+	}
 
 	c.render(w, logger, "console-events.tmpl", page)
 }
 
-// ConsoleFilters is a handler to view user's filters.
-func (c *Console) Filters(w http.ResponseWriter, r *http.Request) {
+// EventUpdate performs a triage action on a single event.
+func (c *Console) EventUpdate(w http.ResponseWriter, r *http.Request) {
 	var (
 		logger = c.loggerFromRequest(r)
 		user   = userFromContext(r.Context())
 	)
 
-	filters, err := c.db.UsersFilters(r.Context(), user.ID)
+	logger = logger.WithFields(logrus.Fields{
+		"eventID": chi.URLParam(r, "eventID"),
+		"action":  chi.URLParam(r, "action"),
+	})
+
+	eventID, err := strconv.ParseInt(chi.URLParam(r, "eventID"), 10, 32)
 	if err != nil {
-		logger.WithError(err).Error("could not get user's filters")
+		logger.WithError(err).Error("could not parse eventID from URL")
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	page := struct {
-		Title                string
-		FilterDefaultDiscard bool
-		Filters              []db.Filter
-	}{"Filters - Maintainer.Me", user.FilterDefaultDiscard, filters}
+	found, err := updateEvent(r.Context(), c.db, c.threads, user, int(eventID), chi.URLParam(r, "action"))
+	if err != nil {
+		logger.WithError(err).Error("could not update event")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
 
-	c.render(w, logger, "console-filters.tmpl", page)
+	logger.Info("successfully updated event")
 }
 
-// ConsoleFiltersUpdate updates filter list.
-func (c *Console) FiltersUpdate(w http.ResponseWriter, r *http.Request) {
+// eventActions are the triage actions performed by updateEvent.
+var eventActions = map[string]bool{
+	"read": true, "unread": true,
+	"archive": true, "unarchive": true,
+	"star": true, "unstar": true,
+}
+
+// updateEvent performs a triage action on a user's event, returns false if
+// the action is unknown. Reading or archiving an event created from a GitHub
+// notification also marks the notification thread as read.
+func updateEvent(ctx context.Context, db db.DB, threads notificationThreads, user *db.User, eventID int, action string) (bool, error) {
+	var (
+		err    error
+		userID = user.ID
+	)
+	switch action {
+	case "read":
+		err = db.EventsMarkRead(ctx, userID, []int{eventID}, true)
+		if err == nil {
+			err = threads.markRead(ctx, db, user, []int{eventID})
+		}
+	case "unread":
+		err = db.EventsMarkRead(ctx, userID, []int{eventID}, false)
+	case "archive":
+		err = db.EventArchive(ctx, userID, eventID, true)
+		if err == nil {
+			err = threads.markRead(ctx, db, user, []int{eventID})
+		}
+	case "unarchive":
+		err = db.EventArchive(ctx, userID, eventID, false)
+	case "star":
+		err = db.EventStar(ctx, userID, eventID, true)
+	case "unstar":
+		err = db.EventStar(ctx, userID, eventID, false)
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+// Event stream intervals, see EventStream.
+const (
+	eventStreamPoll      = 2 * time.Second  // how often the DB is checked for new events
+	eventStreamHeartbeat = 30 * time.Second // how often a comment is sent to keep the connection open
+)
+
+// EventStream is a handler that streams a user's newly accepted events as
+// Server-Sent Events. The poller stores events in the DB, which is checked
+// for new events so the poller and web server may run as separate
+// processes. Each message's ID is the event's ID, so a reconnecting client
+// receives the events it missed via the Last-Event-ID header.
+func (c *Console) EventStream(w http.ResponseWriter, r *http.Request) {
 	var (
 		logger = c.loggerFromRequest(r)
 		user   = userFromContext(r.Context())
 	)
 
-	user.FilterDefaultDiscard = r.FormValue("filterdefaultdiscard") == "true"
-
-	err := c.db.UserUpdate(r.Context(), user)
-	if err != nil {
-		logger.WithError(err).Error("could not update user")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		logger.Error("response writer does not support flushing")
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	logger.Info("successfully updated filters")
+	lastID, err := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		lastID, err = c.db.UsersLatestEventID(r.Context(), user.ID)
+		if err != nil {
+			logger.WithError(err).Error("could not get latest event id")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var (
+		poll      = time.NewTicker(eventStreamPoll)
+		heartbeat = time.NewTicker(eventStreamHeartbeat)
+	)
+	defer poll.Stop()
+	defer heartbeat.Stop()
 
-	http.Redirect(w, r, r.Header.Get("referer"), http.StatusFound)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			io.WriteString(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case <-poll.C:
+			events, err := c.db.UsersEventsAfter(r.Context(), user.ID, lastID)
+			if err != nil {
+				logger.WithError(err).Error("could not get new events")
+				return
+			}
+			for _, event := range events {
+				data, err := json.Marshal(newAPIEvent(event))
+				if err != nil {
+					logger.WithError(err).Error("could not marshal event")
+					return
+				}
+				fmt.Fprintf(w, "id: %d\nevent: event\ndata: %s\n\n", event.ID, data)
+				lastID = event.ID
+			}
+			if len(events) > 0 {
+				flusher.Flush()
+			}
+		}
+	}
 }
 
-// ConsoleFilter is a handler to view a single user's filter.
-func (c *Console) Filter(w http.ResponseWriter, r *http.Request) {
+// EventsMarkRead marks all events in a repository as read.
+func (c *Console) EventsMarkRead(w http.ResponseWriter, r *http.Request) {
 	var (
 		logger = c.loggerFromRequest(r)
 		user   = userFromContext(r.Context())
 	)
 
-	logger = logger.WithField("filterID", chi.URLParam(r, "filterID"))
-
-	filterID, err := strconv.ParseInt(chi.URLParam(r, "filterID"), 10, 32)
-	if err != nil {
-		logger.WithError(err).Error("could not parse filterID from URL")
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	repository := r.FormValue("repository")
+	if repository == "" {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	filter, err := c.db.Filter(r.Context(), int(filterID))
+	err := c.db.EventsMarkRepositoryRead(r.Context(), user.ID, repository)
 	if err != nil {
-		logger.WithError(err).Errorf("could not get filter %v", filterID)
+		logger.WithError(err).Error("could not mark repository's events read")
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	if filter == nil {
-		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-		return
-	}
-
-	if filter.UserID != user.ID {
-		logger.Infof("filter user ID %d does not match session user ID %d", filter.UserID, user.ID)
-		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	if err := c.threads.markRepositoryRead(r.Context(), user, repository); err != nil {
+		logger.WithError(err).Error("could not mark repository's notifications read")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	page := struct {
-		Title  string
-		Filter *db.Filter
-	}{"Filter - Maintainer.Me", filter}
+	logger.WithField("repository", repository).Info("successfully marked repository's events read")
+}
 
-	c.render(w, logger, "console-filter.tmpl", page)
+// eventsValues returns the URL query parameters for an events query.
+func eventsValues(query db.EventQuery) url.Values {
+	v := url.Values{"folder": []string{"all"}}
+	for key, value := range map[string]string{
+		"folder":     query.Folder,
+		"q":          query.Search,
+		"repository": query.Repository,
+		"type":       query.Type,
+		"actor":      query.Actor,
+		"status":     query.Status,
+	} {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	if query.Page > 1 {
+		v.Set("page", strconv.Itoa(query.Page))
+	}
+	return v
 }
 
-// ConsoleConditionDelete deletes a condition.
-func (c *Console) ConditionDelete(w http.ResponseWriter, r *http.Request) {
+// ConsoleFilters is a handler to view user's filters.
+func (c *Console) Filters(w http.ResponseWriter, r *http.Request) {
 	var (
 		logger = c.loggerFromRequest(r)
 		user   = userFromContext(r.Context())
 	)
 
-	logger = logger.WithField("conditionID", chi.URLParam(r, "conditionID"))
-
-	conditionID, err := strconv.ParseInt(chi.URLParam(r, "conditionID"), 10, 32)
+	filters, err := c.db.UsersFilters(r.Context(), user.ID)
 	if err != nil {
-		logger.WithError(err).Error("could not parse conditionID from URL")
+		logger.WithError(err).Error("could not get user's filters")
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	err = c.db.ConditionDelete(r.Context(), user.ID, int(conditionID))
+	teamFilters, err := c.db.UsersTeamFilters(r.Context(), user.ID)
 	if err != nil {
-		logger.WithError(err).Error("could not delete condition")
+		logger.WithError(err).Error("could not get user's team filters")
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	logger.Info("successfully deleted condition")
+	page := struct {
+		header
+		FilterDefaultDiscard bool
+		Filters              []db.Filter
+		TeamFilters          []db.Filter
+	}{c.header(r, "Filters - Maintainer.Me"), user.FilterDefaultDiscard, filters, teamFilters}
+
+	c.render(w, logger, "console-filters.tmpl", page)
 }
 
-// ConsoleConditionCreate deletes a condition.
-func (c *Console) ConditionCreate(w http.ResponseWriter, r *http.Request) {
+// ConsoleFiltersUpdate updates filter list.
+func (c *Console) FiltersUpdate(w http.ResponseWriter, r *http.Request) {
 	var (
 		logger = c.loggerFromRequest(r)
 		user   = userFromContext(r.Context())
 	)
 
-	r.ParseForm()
-	logger = logger.WithField("filterID", r.FormValue("filterID"))
+	user.FilterDefaultDiscard = r.FormValue("filterdefaultdiscard") == "true"
 
-	filterID, err := strconv.ParseInt(r.FormValue("filterID"), 10, 32)
+	err := c.db.UserUpdate(r.Context(), user)
 	if err != nil {
-		logger.WithError(err).Error("could not parse filterID from URL")
+		logger.WithError(err).Error("could not update user")
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	// Check permissions
+	logger.Info("successfully updated filters")
 
-	filter, err := c.db.Filter(r.Context(), int(filterID))
-	if err != nil {
-		logger.WithError(err).Error("could not get filter")
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
-	}
+	localRedirect(w, r, "/console/filters")
+}
 
-	if filter == nil {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
+// Settings is a handler to view a user's settings.
+func (c *Console) Settings(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	page := struct {
+		header
+		User        *db.User
+		FeedAtom    string
+		FeedJSON    string
+		WebhookPath string
+	}{c.header(r, "Settings - Maintainer.Me"), user, FeedPath(user.FeedToken, "atom"), FeedPath(user.FeedToken, "json"), WebhookPath(user.ID)}
+
+	c.render(w, logger, "console-settings.tmpl", page)
+}
+
+// FeedTokenUpdate enables the user's feeds with a new secret URL, replacing
+// any existing URL, or disables the feeds if the disable form value is set.
+func (c *Console) FeedTokenUpdate(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	var feedToken string
+	if r.FormValue("disable") == "" {
+		var err error
+		feedToken, _, err = newAPIToken()
+		if err != nil {
+			logger.WithError(err).Error("could not generate feed token")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
 	}
 
-	if filter.UserID != user.ID {
-		logger.Infof("filter user ID %d does not match session user ID %d", filter.UserID, user.ID)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	if err := c.db.UserFeedTokenUpdate(r.Context(), user.ID, feedToken); err != nil {
+		logger.WithError(err).Error("could not update feed token")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	// Scan user data into struct
+	http.Redirect(w, r, "/console/settings", http.StatusFound)
+}
 
+// WebhookSecretUpdate enables the user's webhooks with a new secret,
+// replacing any existing secret, or disables the webhooks if the disable form
+// value is set.
+func (c *Console) WebhookSecretUpdate(w http.ResponseWriter, r *http.Request) {
 	var (
-		condition = &db.Condition{}
-		postForm  = map[string][]string{
-			"Negate":             []string{r.FormValue("negate")},
-			r.FormValue("field"): []string{r.FormValue("value")},
-		}
-		decoder = schema.NewDecoder()
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
 	)
 
-	err = decoder.Decode(condition, postForm)
-	if err != nil {
-		logger.WithError(err).Error("could not decode form")
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+	var secret string
+	if r.FormValue("disable") == "" {
+		var err error
+		secret, _, err = newAPIToken()
+		if err != nil {
+			logger.WithError(err).Error("could not generate webhook secret")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
 	}
 
-	// Overwrite the condition struct with the filterID we know belongs
-	// to the user, else they might have tried to overwrite it.
-	condition.FilterID = int(filterID)
-
-	conditionID, err := c.db.ConditionCreate(r.Context(), condition)
-	if err != nil {
-		logger.WithError(err).Error("could not delete condition")
+	if err := c.db.UserWebhookSecretUpdate(r.Context(), user.ID, secret); err != nil {
+		logger.WithError(err).Error("could not update webhook secret")
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	logger.WithField("condition", conditionID).Info("successfully added condition")
-
-	http.Redirect(w, r, r.Header.Get("referer"), http.StatusFound)
+	http.Redirect(w, r, "/console/settings", http.StatusFound)
 }
 
-// ConsoleFilterUpdate updates a filter.
-func (c *Console) FilterUpdate(w http.ResponseWriter, r *http.Request) {
+// SettingsUpdate updates a user's settings.
+func (c *Console) SettingsUpdate(w http.ResponseWriter, r *http.Request) {
 	var (
 		logger = c.loggerFromRequest(r)
 		user   = userFromContext(r.Context())
 	)
 
-	logger = logger.WithField("filterID", chi.URLParam(r, "filterID"))
-
-	filterID, err := strconv.ParseInt(chi.URLParam(r, "filterID"), 10, 32)
-	if err != nil {
-		logger.WithError(err).Error("could not parse filterID from URL")
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	timezone := strings.TrimSpace(r.FormValue("timezone"))
+	if _, err := time.LoadLocation(timezone); err != nil {
+		logger.WithError(err).Infof("invalid timezone %q", timezone)
+		http.Error(w, "Unknown timezone "+strconv.Quote(timezone), http.StatusBadRequest)
 		return
 	}
 
-	filter, err := c.db.Filter(r.Context(), int(filterID))
-	if err != nil {
-		logger.WithError(err).Errorf("could not get filter %v", filterID)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	quietStart, err := strconv.Atoi(r.FormValue("quiethoursstart"))
+	if err != nil || quietStart < 0 || quietStart > 23 {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	quietEnd, err := strconv.Atoi(r.FormValue("quiethoursend"))
+	if err != nil || quietEnd < 0 || quietEnd > 23 {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	enableNotifications := !user.NotificationsEnabled && r.FormValue("notifications") != ""
+
+	var relogin bool // the user must log in again to grant access to notifications
+	if enableNotifications {
+		granted, err := c.threads.granted(r.Context(), user)
+		if err != nil {
+			logger.WithError(err).Error("could not get user's token scopes")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		relogin = !granted
+		enableNotifications = granted
+	}
+
+	user.Timezone = timezone
+	user.QuietHoursStart = quietStart
+	user.QuietHoursEnd = quietEnd
+	user.NotificationsEnabled = r.FormValue("notifications") != "" && !relogin
+	user.NotificationsMarkRead = r.FormValue("notificationsmarkread") != ""
+
+	err = c.db.UserUpdate(r.Context(), user)
+	if err != nil {
+		logger.WithError(err).Error("could not update user")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if enableNotifications {
+		// Only notifications from now on, not the user's entire backlog.
+		if err := c.db.SetUsersNotificationsSince(r.Context(), user.ID, time.Now()); err != nil {
+			logger.WithError(err).Error("could not set user's notifications since")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	logger.Info("successfully updated settings")
+
+	if relogin {
+		logger.Info("user's token lacks the notifications scope, logging in again")
+		http.Redirect(w, r, "/login?host="+url.QueryEscape(user.GitHubHost), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/console/settings", http.StatusFound)
+}
+
+// NotificationsPausedUpdate pauses the user's notifications, or resumes them
+// if the resume form value is set. Events while paused are not notified.
+func (c *Console) NotificationsPausedUpdate(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	paused := r.FormValue("resume") == ""
+	if err := c.db.UserNotificationsPausedUpdate(r.Context(), user.ID, paused); err != nil {
+		logger.WithError(err).Error("could not update notifications paused")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Infof("successfully set notifications paused to %v", paused)
+
+	http.Redirect(w, r, "/console/settings", http.StatusFound)
+}
+
+// AccountDelete revokes the user's GitHub OAuth token and deletes the user
+// and all their data, the login form value must match the user's GitHub login
+// to confirm.
+func (c *Console) AccountDelete(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	if !strings.EqualFold(strings.TrimSpace(r.FormValue("login")), user.GitHubLogin) {
+		http.Error(w, "Enter your GitHub login to confirm deleting your account", http.StatusBadRequest)
+		return
+	}
+
+	host := c.hosts.Get(user.GitHubHost)
+	if host == nil {
+		logger.Errorf("unknown GitHub host %q", user.GitHubHost)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if err := host.RevokeToken(r.Context(), c.cache, user.GitHubToken); err != nil {
+		resp, ok := errors.Cause(err).(*github.ErrorResponse)
+		if !ok || resp.Response == nil || resp.Response.StatusCode != http.StatusNotFound {
+			logger.WithError(err).Error("could not revoke github oauth token")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		// The user already revoked the token.
+		logger.WithError(err).Info("github oauth token already revoked")
+	}
+
+	if err := c.db.UserDelete(r.Context(), user.ID); err != nil {
+		logger.WithError(err).Error("could not delete user")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if err := session.Destroy(w, r); err != nil {
+		logger.WithError(err).Error("could not destroy session")
+	}
+
+	logger.Info("successfully deleted user")
+
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// APITokens is a handler to view a user's API tokens.
+func (c *Console) APITokens(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	tokens, err := c.db.UsersAPITokens(r.Context(), user.ID)
+	if err != nil {
+		logger.WithError(err).Error("could not get user's api tokens")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	page := struct {
+		header
+		Tokens []db.APIToken
+	}{c.header(r, "API Tokens - Maintainer.Me"), tokens}
+
+	c.render(w, logger, "console-tokens.tmpl", page)
+}
+
+// APITokenCreate creates a personal API token, displaying it once.
+func (c *Console) APITokenCreate(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	apiToken := &db.APIToken{
+		UserID: user.ID,
+		Name:   strings.TrimSpace(r.FormValue("name")),
+		Scope:  r.FormValue("scope"),
+	}
+	if apiToken.Scope != db.APITokenScopeRead && apiToken.Scope != db.APITokenScopeWrite {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	token, hash, err := newAPIToken()
+	if err != nil {
+		logger.WithError(err).Error("could not generate api token")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	apiToken.TokenHash = hash
+
+	tokenID, err := c.db.APITokenCreate(r.Context(), apiToken)
+	if err != nil {
+		logger.WithError(err).Error("could not create api token")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.WithField("tokenID", tokenID).Info("successfully created api token")
+
+	page := struct {
+		header
+		Token string
+	}{c.header(r, "API Token - Maintainer.Me"), token}
+
+	c.render(w, logger, "console-token.tmpl", page)
+}
+
+// APITokenDelete revokes an API token.
+func (c *Console) APITokenDelete(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	logger = logger.WithField("tokenID", chi.URLParam(r, "tokenID"))
+
+	tokenID, err := strconv.ParseInt(chi.URLParam(r, "tokenID"), 10, 32)
+	if err != nil {
+		logger.WithError(err).Error("could not parse tokenID from URL")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	err = c.db.APITokenDelete(r.Context(), user.ID, int(tokenID))
+	if err != nil {
+		logger.WithError(err).Error("could not delete api token")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("successfully revoked api token")
+}
+
+// ConsoleFilter is a handler to view a single user's filter.
+func (c *Console) Filter(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	logger = logger.WithField("filterID", chi.URLParam(r, "filterID"))
+
+	filterID, err := strconv.ParseInt(chi.URLParam(r, "filterID"), 10, 32)
+	if err != nil {
+		logger.WithError(err).Error("could not parse filterID from URL")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	filter, err := c.db.Filter(r.Context(), int(filterID))
+	if err != nil {
+		logger.WithError(err).Errorf("could not get filter %v", filterID)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if filter == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	editable, err := c.filterEditable(r.Context(), user, filter)
+	if err != nil {
+		logger.WithError(err).Error("could not check filter permissions")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !editable {
+		logger.Infof("filter %d is not editable by session user ID %d", filter.ID, user.ID)
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	page := struct {
+		header
+		Filter *db.Filter
+	}{c.header(r, "Filter - Maintainer.Me"), filter}
+
+	c.render(w, logger, "console-filter.tmpl", page)
+}
+
+// filterEditable returns true if the user can edit the filter, either their
+// own filter or a filter of a team they own.
+func (c *Console) filterEditable(ctx context.Context, user *db.User, filter *db.Filter) (bool, error) {
+	if filter.TeamID == 0 {
+		return filter.UserID == user.ID, nil
+	}
+	membership, err := c.db.TeamMembership(ctx, filter.TeamID, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return membership != nil && membership.Owner(), nil
+}
+
+// validFilterActions returns true if a filter's tag and channels fit their
+// columns.
+func validFilterActions(filter *db.Filter) bool {
+	return len(filter.Tag) <= 64 && len(filter.ChannelsRaw) <= 255
+}
+
+// ConsoleConditionDelete deletes a condition.
+func (c *Console) ConditionDelete(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	logger = logger.WithField("conditionID", chi.URLParam(r, "conditionID"))
+
+	conditionID, err := strconv.ParseInt(chi.URLParam(r, "conditionID"), 10, 32)
+	if err != nil {
+		logger.WithError(err).Error("could not parse conditionID from URL")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	err = c.db.ConditionDelete(r.Context(), user.ID, int(conditionID))
+	if err != nil {
+		logger.WithError(err).Error("could not delete condition")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("successfully deleted condition")
+}
+
+// ConsoleConditionCreate deletes a condition.
+func (c *Console) ConditionCreate(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	r.ParseForm()
+	logger = logger.WithField("filterID", r.FormValue("filterID"))
+
+	filterID, err := strconv.ParseInt(r.FormValue("filterID"), 10, 32)
+	if err != nil {
+		logger.WithError(err).Error("could not parse filterID from URL")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Check permissions
+
+	filter, err := c.db.Filter(r.Context(), int(filterID))
+	if err != nil {
+		logger.WithError(err).Error("could not get filter")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
 	if filter == nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	editable, err := c.filterEditable(r.Context(), user, filter)
+	if err != nil {
+		logger.WithError(err).Error("could not check filter permissions")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !editable {
+		logger.Infof("filter %d is not editable by session user ID %d", filter.ID, user.ID)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Scan user data into struct
+
+	var (
+		condition = &db.Condition{}
+		postForm  = map[string][]string{
+			"Negate":             []string{r.FormValue("negate")},
+			r.FormValue("field"): []string{r.FormValue("value")},
+		}
+		decoder = schema.NewDecoder()
+	)
+
+	err = decoder.Decode(condition, postForm)
+	if err != nil {
+		logger.WithError(err).Error("could not decode form")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Overwrite the condition struct with the filterID we know belongs
+	// to the user, else they might have tried to overwrite it.
+	condition.FilterID = int(filterID)
+
+	conditionID, err := c.db.ConditionCreate(r.Context(), condition)
+	if err != nil {
+		logger.WithError(err).Error("could not delete condition")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.WithField("condition", conditionID).Info("successfully added condition")
+
+	localRedirect(w, r, fmt.Sprintf("/console/filters/%d", filterID))
+}
+
+// ConsoleFilterUpdate updates a filter.
+func (c *Console) FilterUpdate(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	logger = logger.WithField("filterID", chi.URLParam(r, "filterID"))
+
+	filterID, err := strconv.ParseInt(chi.URLParam(r, "filterID"), 10, 32)
+	if err != nil {
+		logger.WithError(err).Error("could not parse filterID from URL")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	filter, err := c.db.Filter(r.Context(), int(filterID))
+	if err != nil {
+		logger.WithError(err).Errorf("could not get filter %v", filterID)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if filter == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	editable, err := c.filterEditable(r.Context(), user, filter)
+	if err != nil {
+		logger.WithError(err).Error("could not check filter permissions")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !editable {
+		logger.Infof("filter %d is not editable by session user ID %d", filter.ID, user.ID)
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	// Update filter
+
+	var priority int // blank is the default priority
+	if value := strings.TrimSpace(r.FormValue("priority")); value != "" {
+		priority, err = strconv.Atoi(value)
+		if err != nil {
+			logger.WithError(err).Info("could not parse priority")
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+	}
+
+	filter.OnMatchDiscard = r.FormValue("onmatchdiscard") == "true"
+	filter.Urgent = r.FormValue("urgent") == "true"
+	filter.Priority = priority
+	filter.Tag = strings.TrimSpace(r.FormValue("tag"))
+	filter.SetChannels(strings.Split(r.FormValue("channels"), ","))
+
+	if !validFilterActions(filter) {
+		http.Error(w, "Tag must be at most 64 characters and channels at most 255", http.StatusBadRequest)
+		return
+	}
+
+	err = c.db.FilterUpdate(r.Context(), filter)
+	if err != nil {
+		logger.WithError(err).Error("could not update filter")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("successfully updated filter")
+
+	localRedirect(w, r, fmt.Sprintf("/console/filters/%d", filter.ID))
+}
+
+// Channels is a handler to view a user's notification channels.
+func (c *Console) Channels(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	channels, err := c.db.UsersNotificationChannels(r.Context(), user.ID)
+	if err != nil {
+		logger.WithError(err).Error("could not get user's notification channels")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	page := struct {
+		header
+		Channels []db.NotificationChannel
+	}{c.header(r, "Notification Channels - Maintainer.Me"), channels}
+
+	c.render(w, logger, "console-channels.tmpl", page)
+}
+
+// ChannelCreate creates a notification channel and sends its verification.
+func (c *Console) ChannelCreate(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	channel := &db.NotificationChannel{
+		UserID:      user.ID,
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Type:        r.FormValue("type"),
+		Target:      strings.TrimSpace(r.FormValue("target")),
+		VerifyToken: uuid.New().String(),
+	}
+
+	if !validChannel(channel) {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	channelID, err := c.db.NotificationChannelCreate(r.Context(), channel)
+	if err != nil {
+		logger.WithError(err).Error("could not create notification channel")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	channel.ID = channelID
+
+	logger = logger.WithField("channelID", channelID)
+	logger.Info("successfully added notification channel")
+
+	if err := c.verifier.SendVerification(r.Context(), *channel); err != nil {
+		// The channel can be removed and added again, so don't fail.
+		logger.WithError(err).Error("could not send notification channel verification")
+	}
+
+	http.Redirect(w, r, "/console/channels", http.StatusFound)
+}
+
+// validChannel returns true if a new notification channel is valid. As the
+// server sends requests to webhook and Slack targets, their targets must be
+// https URLs of public hosts.
+func validChannel(channel *db.NotificationChannel) bool {
+	if channel.Name == "" || strings.Contains(channel.Name, ",") || channel.Target == "" {
+		return false
+	}
+	switch channel.Type {
+	case db.ChannelTypeEmail:
+		// Only a bare address, as the target is used in the email's headers.
+		addr, err := mail.ParseAddress(channel.Target)
+		return err == nil && addr.Address == channel.Target
+	case db.ChannelTypeWebhook, db.ChannelTypeSlack:
+		return publicURL(channel.Target)
+	}
+	return false
+}
+
+// lookupIP resolves a host's addresses, replaced by tests.
+var lookupIP = net.LookupIP
+
+// publicURL returns true if rawurl is an absolute https URL and its host does
+// not resolve to a loopback, private or link-local address. The notifier
+// checks the address again when connecting, this check rejects the channel
+// up front.
+func publicURL(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return false
+	}
+	ips, err := lookupIP(u.Hostname())
+	if err != nil || len(ips) == 0 {
+		return false
+	}
+	for _, ip := range ips {
+		if !notifier.PublicIP(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// ChannelVerifyConfirm is a handler to confirm verifying a notification
+// channel, used by the link in the verification sent to the channel.
+func (c *Console) ChannelVerifyConfirm(w http.ResponseWriter, r *http.Request) {
+	logger := c.loggerFromRequest(r)
+
+	page := struct {
+		header
+		Token string
+	}{c.header(r, "Verify Notification Channel - Maintainer.Me"), r.FormValue("token")}
+
+	c.render(w, logger, "console-channel-verify.tmpl", page)
+}
+
+// ChannelVerify verifies a notification channel using the token sent to it.
+func (c *Console) ChannelVerify(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	verified, err := c.db.NotificationChannelVerify(r.Context(), user.ID, r.FormValue("token"))
+	if err != nil {
+		logger.WithError(err).Error("could not verify notification channel")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if !verified {
+		http.Error(w, "Unknown or already verified token", http.StatusNotFound)
+		return
+	}
+
+	logger.Info("successfully verified notification channel")
+
+	http.Redirect(w, r, "/console/channels", http.StatusFound)
+}
+
+// ChannelDelete deletes a notification channel.
+func (c *Console) ChannelDelete(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	logger = logger.WithField("channelID", chi.URLParam(r, "channelID"))
+
+	channelID, err := strconv.ParseInt(chi.URLParam(r, "channelID"), 10, 32)
+	if err != nil {
+		logger.WithError(err).Error("could not parse channelID from URL")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	err = c.db.NotificationChannelDelete(r.Context(), user.ID, int(channelID))
+	if err != nil {
+		logger.WithError(err).Error("could not delete notification channel")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("successfully deleted notification channel")
+}
+
+// Mutes is a handler to view a user's active mutes.
+func (c *Console) Mutes(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	mutes, err := c.db.UsersMutes(r.Context(), user.ID)
+	if err != nil {
+		logger.WithError(err).Error("could not get user's mutes")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	page := struct {
+		header
+		Mutes []db.Mute
+	}{c.header(r, "Mutes - Maintainer.Me"), mutes}
+
+	c.render(w, logger, "console-mutes.tmpl", page)
+}
+
+// MuteNew is a handler to confirm muting a thread or repository, used by
+// links in notifications.
+func (c *Console) MuteNew(w http.ResponseWriter, r *http.Request) {
+	logger := c.loggerFromRequest(r)
+
+	repositoryID, err := strconv.Atoi(r.FormValue("repositoryID"))
+	if err != nil {
+		logger.WithError(err).Info("could not parse repositoryID")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	number, _ := strconv.Atoi(r.FormValue("number")) // optional
+
+	page := struct {
+		header
+		Mute db.Mute
+	}{c.header(r, "Mute - Maintainer.Me"), db.Mute{
+		RepositoryID: repositoryID,
+		Repository:   r.FormValue("repository"),
+		Number:       number,
+	}}
+
+	c.render(w, logger, "console-mute.tmpl", page)
+}
+
+// MuteCreate creates a mute for a thread or repository.
+func (c *Console) MuteCreate(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	repositoryID, err := strconv.Atoi(r.FormValue("repositoryID"))
+	if err != nil {
+		logger.WithError(err).Info("could not parse repositoryID")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	mute := &db.Mute{
+		UserID:       user.ID,
+		RepositoryID: repositoryID,
+		Repository:   r.FormValue("repository"),
+	}
+
+	if r.FormValue("number") != "" {
+		mute.Number, err = strconv.Atoi(r.FormValue("number"))
+		if err != nil {
+			logger.WithError(err).Info("could not parse number")
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if r.FormValue("until") != "" {
+		until, err := time.ParseInLocation("2006-01-02", r.FormValue("until"), user.Location())
+		if err != nil {
+			logger.WithError(err).Info("could not parse until")
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		mute.ExpiresAt = &until
+	}
+
+	muteID, err := c.db.MuteCreate(r.Context(), mute)
+	if err != nil {
+		logger.WithError(err).Error("could not create mute")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.WithField("muteID", muteID).Info("successfully added mute")
+
+	http.Redirect(w, r, "/console/mutes", http.StatusFound)
+}
+
+// MuteDelete deletes a mute.
+func (c *Console) MuteDelete(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	logger = logger.WithField("muteID", chi.URLParam(r, "muteID"))
+
+	muteID, err := strconv.ParseInt(chi.URLParam(r, "muteID"), 10, 32)
+	if err != nil {
+		logger.WithError(err).Error("could not parse muteID from URL")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	err = c.db.MuteDelete(r.Context(), user.ID, int(muteID))
+	if err != nil {
+		logger.WithError(err).Error("could not delete mute")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("successfully deleted mute")
+}
+
+// Teams is a handler to view the teams a user is a member of.
+func (c *Console) Teams(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	memberships, err := c.db.UsersTeams(r.Context(), user.ID)
+	if err != nil {
+		logger.WithError(err).Error("could not get user's teams")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	page := struct {
+		header
+		Memberships []db.TeamMembership
+	}{c.header(r, "Teams - Maintainer.Me"), memberships}
+
+	c.render(w, logger, "console-teams.tmpl", page)
+}
+
+// TeamCreate creates a team, owned by the user.
+func (c *Console) TeamCreate(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	team := &db.Team{Name: strings.TrimSpace(r.FormValue("name"))}
+	if team.Name == "" {
+		http.Error(w, "Team name is required", http.StatusBadRequest)
+		return
+	}
+
+	teamID, err := c.db.TeamCreate(r.Context(), team, user.ID)
+	if err != nil {
+		logger.WithError(err).Error("could not create team")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.WithField("teamID", teamID).Info("successfully created team")
+
+	http.Redirect(w, r, "/console/teams/"+strconv.Itoa(teamID), http.StatusFound)
+}
+
+// teamMembership returns the user's membership of the team in the URL. If
+// the team does not exist, the user is not a member, or the user is not an
+// owner and owner is true, an error response is written and nil is returned.
+func (c *Console) teamMembership(w http.ResponseWriter, r *http.Request, logger *logrus.Entry, owner bool) *db.TeamMembership {
+	user := userFromContext(r.Context())
+
+	teamID, err := strconv.ParseInt(chi.URLParam(r, "teamID"), 10, 32)
+	if err != nil {
+		logger.WithError(err).Error("could not parse teamID from URL")
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return nil
+	}
+
+	membership, err := c.db.TeamMembership(r.Context(), int(teamID), user.ID)
+	if err != nil {
+		logger.WithError(err).Error("could not get team membership")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil
+	}
+	if membership == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return nil
+	}
+	if owner && !membership.Owner() {
+		logger.Infof("user ID %d is not an owner of team %d", user.ID, membership.TeamID)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return nil
+	}
+	return membership
+}
+
+// Team is a handler to view a team's members and filters.
+func (c *Console) Team(w http.ResponseWriter, r *http.Request) {
+	logger := c.loggerFromRequest(r).WithField("teamID", chi.URLParam(r, "teamID"))
+
+	membership := c.teamMembership(w, r, logger, false)
+	if membership == nil {
+		return
+	}
+
+	members, err := c.db.TeamsMemberships(r.Context(), membership.TeamID)
+	if err != nil {
+		logger.WithError(err).Error("could not get team's members")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	filters, err := c.db.TeamsFilters(r.Context(), membership.TeamID)
+	if err != nil {
+		logger.WithError(err).Error("could not get team's filters")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	page := struct {
+		header
+		Membership *db.TeamMembership
+		Members    []db.TeamMembership
+		Filters    []db.Filter
+	}{c.header(r, membership.TeamName+" - Teams - Maintainer.Me"), membership, members, filters}
+
+	c.render(w, logger, "console-team.tmpl", page)
+}
+
+// TeamDelete deletes a team, its memberships and filters.
+func (c *Console) TeamDelete(w http.ResponseWriter, r *http.Request) {
+	logger := c.loggerFromRequest(r).WithField("teamID", chi.URLParam(r, "teamID"))
+
+	membership := c.teamMembership(w, r, logger, true)
+	if membership == nil {
+		return
+	}
+
+	if err := c.db.TeamDelete(r.Context(), membership.TeamID); err != nil {
+		logger.WithError(err).Error("could not delete team")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("successfully deleted team")
+}
+
+// TeamMemberCreate adds a user, by their GitHub login, to a team or changes
+// their role. The user must have logged in to Maintainer.Me via the same
+// GitHub host.
+func (c *Console) TeamMemberCreate(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r).WithField("teamID", chi.URLParam(r, "teamID"))
+		user   = userFromContext(r.Context())
+	)
+
+	membership := c.teamMembership(w, r, logger, true)
+	if membership == nil {
+		return
+	}
+
+	role := r.FormValue("role")
+	if role != db.TeamRoleOwner && role != db.TeamRoleMember {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	login := strings.TrimSpace(r.FormValue("login"))
+	member, err := c.db.UserByGitHubLogin(r.Context(), user.GitHubHost, login)
+	if err != nil {
+		logger.WithError(err).Error("could not get user by login")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if member == nil {
+		http.Error(w, "No Maintainer.Me user with GitHub login "+strconv.Quote(login), http.StatusBadRequest)
+		return
+	}
+
+	err = c.db.TeamMembershipCreate(r.Context(), &db.TeamMembership{
+		TeamID: membership.TeamID,
+		UserID: member.ID,
+		Role:   role,
+	})
+	if err != nil {
+		logger.WithError(err).Error("could not create team membership")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.WithField("memberUserID", member.ID).Info("successfully added team member")
+
+	http.Redirect(w, r, "/console/teams/"+strconv.Itoa(membership.TeamID), http.StatusFound)
+}
+
+// TeamMemberDelete removes a member from a team, owners can remove any
+// member and members can remove themselves. A team's last owner cannot be
+// removed.
+func (c *Console) TeamMemberDelete(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r).WithFields(logrus.Fields{
+			"teamID":       chi.URLParam(r, "teamID"),
+			"memberUserID": chi.URLParam(r, "userID"),
+		})
+		user = userFromContext(r.Context())
+	)
+
+	memberUserID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		logger.WithError(err).Error("could not parse userID from URL")
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	}
 
-	if filter.UserID != user.ID {
-		logger.Infof("filter user ID %d does not match session user ID %d", filter.UserID, user.ID)
+	membership := c.teamMembership(w, r, logger, memberUserID != user.ID)
+	if membership == nil {
+		return
+	}
+
+	members, err := c.db.TeamsMemberships(r.Context(), membership.TeamID)
+	if err != nil {
+		logger.WithError(err).Error("could not get team's members")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	var owners, removedOwners int
+	for _, m := range members {
+		if m.Owner() {
+			owners++
+			if m.UserID == memberUserID {
+				removedOwners++
+			}
+		}
+	}
+	if owners == removedOwners {
+		http.Error(w, "A team must have an owner, delete the team instead", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.db.TeamMembershipDelete(r.Context(), membership.TeamID, memberUserID); err != nil {
+		logger.WithError(err).Error("could not delete team membership")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("successfully removed team member")
+}
+
+// TeamFilterCreate creates an empty filter for a team, and redirects to the
+// filter to add its conditions.
+func (c *Console) TeamFilterCreate(w http.ResponseWriter, r *http.Request) {
+	logger := c.loggerFromRequest(r).WithField("teamID", chi.URLParam(r, "teamID"))
+
+	membership := c.teamMembership(w, r, logger, true)
+	if membership == nil {
+		return
+	}
+
+	filterID, err := c.db.FilterCreate(r.Context(), &db.Filter{TeamID: membership.TeamID})
+	if err != nil {
+		logger.WithError(err).Error("could not create team filter")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.WithField("filterID", filterID).Info("successfully created team filter")
+
+	http.Redirect(w, r, "/console/filters/"+strconv.Itoa(filterID), http.StatusFound)
+}
+
+// TeamFilterDelete deletes a team's filter.
+func (c *Console) TeamFilterDelete(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r).WithFields(logrus.Fields{
+			"teamID":   chi.URLParam(r, "teamID"),
+			"filterID": chi.URLParam(r, "filterID"),
+		})
+		user = userFromContext(r.Context())
+	)
+
+	membership := c.teamMembership(w, r, logger, true)
+	if membership == nil {
+		return
+	}
+
+	filterID, err := strconv.Atoi(chi.URLParam(r, "filterID"))
+	if err != nil {
+		logger.WithError(err).Error("could not parse filterID from URL")
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	}
 
-	// Update filter
+	// FilterDelete would also delete the user's own filters, and the filters
+	// of their other teams.
+	filter, err := c.db.Filter(r.Context(), filterID)
+	if err != nil {
+		logger.WithError(err).Error("could not get filter")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if filter == nil || filter.TeamID != membership.TeamID {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
 
-	filter.OnMatchDiscard = r.FormValue("onmatchdiscard") == "true"
+	if err := c.db.FilterDelete(r.Context(), user.ID, filter.ID); err != nil {
+		logger.WithError(err).Error("could not delete team filter")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
 
-	err = c.db.FilterUpdate(r.Context(), filter)
+	logger.Info("successfully deleted team filter")
+}
+
+// Subscriptions is a handler to view a user's repository and organisation
+// subscriptions.
+func (c *Console) Subscriptions(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	subscriptions, err := c.db.UsersSubscriptions(r.Context(), user.ID)
 	if err != nil {
-		logger.WithError(err).Error("could not update filter")
+		logger.WithError(err).Error("could not get user's subscriptions")
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	logger.Info("successfully updated filter")
+	page := struct {
+		header
+		Subscriptions []db.Subscription
+	}{c.header(r, "Subscriptions - Maintainer.Me"), subscriptions}
+
+	c.render(w, logger, "console-subscriptions.tmpl", page)
+}
+
+// SubscriptionCreate subscribes a user to a repository or organisation, which
+// must be visible to the user on GitHub.
+func (c *Console) SubscriptionCreate(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	subscription := &db.Subscription{
+		UserID: user.ID,
+		Kind:   r.FormValue("kind"),
+		Name:   strings.TrimSpace(r.FormValue("name")),
+	}
+
+	client, err := c.githubClient(r.Context(), user)
+	if err != nil {
+		logger.WithError(err).Error("could not get github client")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Use GitHub's canonical name, so the subscription matches the name of
+	// the events' repository.
+	switch subscription.Kind {
+	case db.SubscriptionRepository:
+		parts := strings.Split(subscription.Name, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			http.Error(w, "Repository must be in the form owner/repo", http.StatusBadRequest)
+			return
+		}
+		repo, _, err := client.Repositories.Get(r.Context(), parts[0], parts[1])
+		if err != nil {
+			logger.WithError(err).Infof("could not get repository %q", subscription.Name)
+			http.Error(w, "Unknown repository "+strconv.Quote(subscription.Name), http.StatusBadRequest)
+			return
+		}
+		subscription.Name = repo.GetFullName()
+	case db.SubscriptionOrganization:
+		org, _, err := client.Organizations.Get(r.Context(), subscription.Name)
+		if err != nil {
+			logger.WithError(err).Infof("could not get organization %q", subscription.Name)
+			http.Error(w, "Unknown organization "+strconv.Quote(subscription.Name), http.StatusBadRequest)
+			return
+		}
+		subscription.Name = org.GetLogin()
+	default:
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	subscriptionID, err := c.db.SubscriptionCreate(r.Context(), subscription)
+	if err != nil {
+		logger.WithError(err).Error("could not create subscription")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.WithField("subscriptionID", subscriptionID).Info("successfully added subscription")
+
+	http.Redirect(w, r, "/console/subscriptions", http.StatusFound)
+}
+
+// SubscriptionDelete deletes a subscription.
+func (c *Console) SubscriptionDelete(w http.ResponseWriter, r *http.Request) {
+	var (
+		logger = c.loggerFromRequest(r)
+		user   = userFromContext(r.Context())
+	)
+
+	logger = logger.WithField("subscriptionID", chi.URLParam(r, "subscriptionID"))
+
+	subscriptionID, err := strconv.ParseInt(chi.URLParam(r, "subscriptionID"), 10, 32)
+	if err != nil {
+		logger.WithError(err).Error("could not parse subscriptionID from URL")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	err = c.db.SubscriptionDelete(r.Context(), user.ID, int(subscriptionID))
+	if err != nil {
+		logger.WithError(err).Error("could not delete subscription")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
 
-	http.Redirect(w, r, r.Header.Get("referer"), http.StatusFound)
+	logger.Info("successfully deleted subscription")
 }
 
 // Repos is a handler to view all user's repos
@@ -484,7 +1998,12 @@ func (c *Console) Repos(w http.ResponseWriter, r *http.Request) {
 		user   = userFromContext(r.Context())
 	)
 
-	client := c.githubClient(r.Context(), user.GitHubToken)
+	client, err := c.githubClient(r.Context(), user)
+	if err != nil {
+		logger.WithError(err).Error("could not get github client")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
 
 	opt := &github.RepositoryListOptions{
 		ListOptions: github.ListOptions{
@@ -568,9 +2087,9 @@ func (c *Console) Repos(w http.ResponseWriter, r *http.Request) {
 	}
 
 	page := struct {
-		Title string
+		header
 		Repos []Repo
-	}{"Repositories - Maintainer.Me", repos}
+	}{c.header(r, "Repositories - Maintainer.Me"), repos}
 
 	c.render(w, logger, "console-repos.tmpl", page)
 }
@@ -0,0 +1,140 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alexedwards/scs/session"
+)
+
+const (
+	// csrfTokenKey is the session key of the user's CSRF token.
+	csrfTokenKey = "csrfToken"
+	// csrfFormField is the form field containing the CSRF token.
+	csrfFormField = "csrf_token"
+	// csrfHeader is the request header containing the CSRF token, used by
+	// the console's axios requests.
+	csrfHeader = "X-CSRF-Token"
+)
+
+type csrfTokenCtxKey struct{}
+
+// csrfTokenFromContext returns the session's CSRF token, or a blank string if
+// the request did not pass through the CSRF middleware.
+func csrfTokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(csrfTokenCtxKey{}).(string)
+	return token
+}
+
+// safeMethod returns true if the HTTP method does not change state.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// CSRF is middleware that protects state changing requests from cross-site
+// request forgery. Each session has a random token, which must be sent as the
+// csrf_token form value or the X-CSRF-Token header for requests other than
+// GET, HEAD and OPTIONS, else a HTTP Forbidden error is displayed.
+//
+// Also adds the token to the context, to be included in forms.
+func (c *Console) CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := session.GetString(r, csrfTokenKey)
+		if err != nil {
+			c.logger.WithError(err).Error("CSRF could not get token from session")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if token == "" {
+			b := make([]byte, 32)
+			if _, err := rand.Read(b); err != nil {
+				c.logger.WithError(err).Error("CSRF could not read random bytes")
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			token = hex.EncodeToString(b)
+			if err := session.PutString(r, csrfTokenKey, token); err != nil {
+				c.logger.WithError(err).Error("CSRF could not put token in session")
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if !safeMethod(r.Method) {
+			sent := r.Header.Get(csrfHeader)
+			if sent == "" {
+				sent = r.PostFormValue(csrfFormField)
+			}
+			if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				c.logger.WithField("requestURI", r.RequestURI).Info("CSRF token missing or invalid")
+				http.Error(w, "Invalid CSRF token, reload the page and try again", http.StatusForbidden)
+				return
+			}
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), csrfTokenCtxKey{}, token))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SameOrigin is middleware that rejects state changing API requests
+// authenticated by the session cookie, unless the Origin header, or Referer
+// header if Origin is not set, is this site. Requests authenticated with an
+// Authorization header are not sent automatically by browsers, so are
+// allowed.
+func SameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if safeMethod(r.Method) || r.Header.Get("Authorization") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			origin = r.Header.Get("Referer")
+		}
+		u, err := url.Parse(origin)
+		if origin == "" || err != nil || u.Host != r.Host {
+			http.Error(w, "Cross-origin request denied", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// localRedirect redirects to the same-site path in the Referer header, such as
+// the page containing the submitted form, or fallback if the Referer is not a
+// path on this site.
+func localRedirect(w http.ResponseWriter, r *http.Request, fallback string) {
+	http.Redirect(w, r, localPath(r, r.Header.Get("Referer"), fallback), http.StatusFound)
+}
+
+// localPath returns the path and query of rawurl if it is on the same site as
+// r, otherwise fallback.
+func localPath(r *http.Request, rawurl, fallback string) string {
+	u, err := url.Parse(rawurl)
+	switch {
+	case err != nil || rawurl == "":
+		return fallback
+	case u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https":
+		return fallback
+	case u.Host != "" && u.Host != r.Host:
+		return fallback
+	case u.Opaque != "" || u.User != nil:
+		return fallback
+	case !strings.HasPrefix(u.Path, "/") || strings.HasPrefix(u.Path, "//") || strings.Contains(u.Path, `\`):
+		return fallback
+	}
+	return u.RequestURI()
+}
@@ -0,0 +1,261 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/bradleyfalzon/maintainer.me/db"
+	"github.com/bradleyfalzon/maintainer.me/ghhost"
+	"github.com/go-chi/chi"
+)
+
+// feedLength is the maximum number of events in a feed.
+const feedLength = 50
+
+// Feeds provides Atom and JSON Feed formatted feeds of a user's accepted
+// events, accessed by a secret URL containing the user's feed token.
+type Feeds struct {
+	logger  *logrus.Entry
+	db      db.DB
+	hosts   ghhost.Hosts
+	baseURL string
+}
+
+// NewFeeds returns a new Feeds instance, baseURL is the absolute URL of the
+// web server and is used to identify the feeds. Events link to the user's
+// GitHub host from hosts.
+func NewFeeds(logger *logrus.Entry, db db.DB, hosts ghhost.Hosts, baseURL string) *Feeds {
+	return &Feeds{
+		logger:  logger,
+		db:      db,
+		hosts:   hosts,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// FeedPath returns the path to a user's feed in format, "atom" or "json".
+func FeedPath(feedToken, format string) string {
+	return "/feeds/" + feedToken + "/" + format
+}
+
+// Feed is the handler for a user's feed, the format URL parameter is either
+// "atom" or "json" and the feed can be limited to a single filter tag or
+// repository with the tag and repository query parameters. Conditional GET
+// requests are supported via the Last-Modified and ETag headers.
+func (f *Feeds) Feed(w http.ResponseWriter, r *http.Request) {
+	logger := f.logger.WithFields(logrus.Fields{
+		"requestURI":    r.RequestURI,
+		"requestMethod": r.Method,
+	})
+
+	format := chi.URLParam(r, "format")
+	if format != "atom" && format != "json" {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, err := f.db.UserByFeedToken(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		logger.WithError(err).Error("could not get user by feed token")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.NotFound(w, r)
+		return
+	}
+	logger = logger.WithField("userID", user.ID)
+
+	host := f.hosts.Get(user.GitHubHost)
+	if host == nil {
+		logger.Errorf("unknown GitHub host %q", user.GitHubHost)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	query := db.EventQuery{
+		Status:     db.EventStatusAccepted,
+		Tag:        r.URL.Query().Get("tag"),
+		Repository: r.URL.Query().Get("repository"),
+		PerPage:    feedLength,
+	}
+
+	events, err := f.db.UsersEvents(r.Context(), user.ID, query)
+	if err != nil {
+		logger.WithError(err).Error("could not get user's events")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	var updated time.Time
+	if len(events) > 0 {
+		updated = events[0].CreatedAt // events are sorted newest first
+	}
+
+	title := "Maintainer.Me events for " + user.GitHubLogin
+	switch {
+	case query.Tag != "" && query.Repository != "":
+		title += fmt.Sprintf(" tagged %s in %s", query.Tag, query.Repository)
+	case query.Tag != "":
+		title += " tagged " + query.Tag
+	case query.Repository != "":
+		title += " in " + query.Repository
+	}
+
+	var (
+		buf         = &bytes.Buffer{}
+		contentType string
+		feedURL     = f.baseURL + r.URL.RequestURI()
+	)
+	switch format {
+	case "atom":
+		contentType = "application/atom+xml; charset=utf-8"
+		err = f.atom(buf, host, feedURL, title, updated, events)
+	case "json":
+		contentType = "application/json; charset=utf-8"
+		err = f.jsonFeed(buf, host, feedURL, title, events)
+	}
+	if err != nil {
+		logger.WithError(err).Error("could not encode feed")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	hash := sha256.Sum256(buf.Bytes())
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(hash[:16])+`"`)
+	w.Header().Set("Cache-Control", "private, max-age=60")
+
+	// ServeContent handles the If-None-Match and If-Modified-Since headers.
+	http.ServeContent(w, r, "", updated, bytes.NewReader(buf.Bytes()))
+}
+
+// eventID returns a stable and unique identifier for an event.
+func (f *Feeds) eventID(event db.Event) string {
+	return fmt.Sprintf("%s/events/%d", f.baseURL, event.ID)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published"`
+	Link      atomLink    `xml:"link"`
+	Author    atomAuthor  `xml:"author"`
+	Category  *atomTerm   `xml:"category,omitempty"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomTerm struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// atom writes events as an Atom feed to buf.
+func (f *Feeds) atom(buf *bytes.Buffer, host *ghhost.Host, feedURL, title string, updated time.Time, events []db.Event) error {
+	feed := atomFeed{
+		ID:      feedURL,
+		Title:   title,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Link:    atomLink{Href: feedURL, Rel: "self"},
+	}
+	for _, event := range events {
+		entry := atomEntry{
+			ID:        f.eventID(event),
+			Title:     event.Title,
+			Updated:   event.CreatedAt.UTC().Format(time.RFC3339),
+			Published: event.CreatedAt.UTC().Format(time.RFC3339),
+			Link:      atomLink{Href: event.URL(host.WebURL)},
+			Author:    atomAuthor{Name: event.Actor},
+			Content:   atomContent{Type: "text", Body: event.Body},
+		}
+		if event.Tag != "" {
+			entry.Category = &atomTerm{Term: event.Tag}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	buf.WriteString(xml.Header)
+	return xml.NewEncoder(buf).Encode(feed)
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	FeedURL     string         `json:"feed_url"`
+	HomePageURL string         `json:"home_page_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string             `json:"id"`
+	URL           string             `json:"url"`
+	Title         string             `json:"title"`
+	ContentText   string             `json:"content_text"`
+	DatePublished time.Time          `json:"date_published"`
+	Author        jsonFeedItemAuthor `json:"author"`
+	Tags          []string           `json:"tags,omitempty"`
+}
+
+type jsonFeedItemAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// jsonFeed writes events as a JSON Feed (https://jsonfeed.org/version/1) to
+// buf.
+func (f *Feeds) jsonFeed(buf *bytes.Buffer, host *ghhost.Host, feedURL, title string, events []db.Event) error {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1",
+		Title:       title,
+		FeedURL:     feedURL,
+		HomePageURL: f.baseURL + "/console/events",
+		Items:       []jsonFeedItem{},
+	}
+	for _, event := range events {
+		item := jsonFeedItem{
+			ID:            f.eventID(event),
+			URL:           event.URL(host.WebURL),
+			Title:         event.Title,
+			ContentText:   event.Body,
+			DatePublished: event.CreatedAt.UTC(),
+			Author:        jsonFeedItemAuthor{Name: event.Actor, URL: host.WebURL + event.Actor},
+		}
+		if event.Tag != "" {
+			item.Tags = []string{event.Tag}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return json.NewEncoder(buf).Encode(feed)
+}
@@ -0,0 +1,95 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bradleyfalzon/maintainer.me/db"
+	"github.com/bradleyfalzon/maintainer.me/events"
+	"github.com/bradleyfalzon/maintainer.me/ghhost"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// notificationThreads marks a user's GitHub notification threads as read
+// when their events are read, if the user has enabled
+// db.User.NotificationsMarkRead.
+type notificationThreads struct {
+	hosts ghhost.Hosts
+	rt    http.RoundTripper
+}
+
+// markRead marks the notification threads of a user's events as read on
+// GitHub, events not created from notifications are ignored.
+func (nt notificationThreads) markRead(ctx context.Context, db db.DB, user *db.User, eventIDs []int) error {
+	if !user.NotificationsMarkRead {
+		return nil
+	}
+
+	dbEvents, err := db.UsersEventsByID(ctx, user.ID, eventIDs)
+	if err != nil {
+		return err
+	}
+
+	client := nt.client(ctx, user)
+	for _, event := range dbEvents {
+		if event.Type != events.NotificationEventType {
+			continue
+		}
+		if client == nil {
+			return errors.Errorf("unknown GitHub host %q", user.GitHubHost)
+		}
+		// The event's GitHub ID is the notification's thread ID.
+		if _, err := client.Activity.MarkThreadRead(ctx, event.GitHubID); err != nil {
+			return errors.Wrapf(err, "could not mark notification thread %v read", event.GitHubID)
+		}
+	}
+	return nil
+}
+
+// client returns a GitHub client authenticated as the user, or nil if the
+// user's host is not configured.
+func (nt notificationThreads) client(ctx context.Context, user *db.User) *github.Client {
+	host := nt.hosts.Get(user.GitHubHost)
+	if host == nil {
+		return nil
+	}
+	return host.UserClient(ctx, nt.rt, user.GitHubToken)
+}
+
+// granted returns true if the user's token was granted access to their
+// notifications, which tokens from before notifications were supported were
+// not. The scopes aren't cached, as they change when the user logs in again.
+func (nt notificationThreads) granted(ctx context.Context, user *db.User) (bool, error) {
+	host := nt.hosts.Get(user.GitHubHost)
+	if host == nil {
+		return false, errors.Errorf("unknown GitHub host %q", user.GitHubHost)
+	}
+	scopes, err := host.TokenScopes(ctx, http.DefaultTransport, user.GitHubToken)
+	if err != nil {
+		return false, err
+	}
+	return ghhost.CanReadNotifications(scopes), nil
+}
+
+// markRepositoryRead marks all a user's notifications in a repository as read
+// on GitHub.
+func (nt notificationThreads) markRepositoryRead(ctx context.Context, user *db.User, repository string) error {
+	if !user.NotificationsEnabled || !user.NotificationsMarkRead {
+		return nil
+	}
+
+	client := nt.client(ctx, user)
+	if client == nil {
+		return errors.Errorf("unknown GitHub host %q", user.GitHubHost)
+	}
+
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) != 2 {
+		return errors.Errorf("invalid repository %q", repository)
+	}
+	_, err := client.Activity.MarkRepositoryNotificationsRead(ctx, parts[0], parts[1], time.Now())
+	return errors.Wrapf(err, "could not mark notifications in %v read", repository)
+}
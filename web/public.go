@@ -7,15 +7,17 @@ import (
 	"net/http"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/bradleyfalzon/maintainer.me/ghhost"
 )
 
 type Public struct {
 	logger    *logrus.Entry
 	templates *template.Template
+	hosts     ghhost.Hosts
 }
 
-// NewPublic returns a new web instance.
-func NewPublic(logger *logrus.Entry) (*Public, error) {
+// NewPublic returns a new web instance, users may log in with any of hosts.
+func NewPublic(logger *logrus.Entry, hosts ghhost.Hosts) (*Public, error) {
 	templates, err := template.ParseGlob("web/templates/public-*.tmpl")
 	if err != nil {
 		return nil, err
@@ -24,6 +26,7 @@ func NewPublic(logger *logrus.Entry) (*Public, error) {
 	return &Public{
 		logger:    logger,
 		templates: templates,
+		hosts:     hosts,
 	}, nil
 }
 
@@ -40,5 +43,10 @@ func (p *Public) render(w http.ResponseWriter, logger *logrus.Entry, template st
 // Home is the handler to view the console page.
 func (p *Public) Home(w http.ResponseWriter, r *http.Request) {
 	logger := p.logger.WithField("requestURI", r.RequestURI)
-	p.render(w, logger, "public-home.tmpl", nil)
+	page := struct {
+		Title string
+		Hosts ghhost.Hosts
+	}{"Maintainer.Me", p.hosts}
+
+	p.render(w, logger, "public-home.tmpl", page)
 }
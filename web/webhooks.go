@@ -0,0 +1,244 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/bradleyfalzon/maintainer.me/db"
+	"github.com/bradleyfalzon/maintainer.me/events"
+	"github.com/bradleyfalzon/maintainer.me/ghhost"
+	"github.com/go-chi/chi"
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// EventProcessor filters, stores and notifies a user's new events, see
+// events.Poller.Process.
+type EventProcessor interface {
+	Process(ctx context.Context, logger *logrus.Entry, user db.User, events events.Events) error
+}
+
+// Webhooks receives GitHub repository and organisation webhooks, as an
+// alternative to polling a user's events.
+type Webhooks struct {
+	logger    *logrus.Entry
+	db        db.DB
+	processor EventProcessor
+	appSecret string
+}
+
+// NewWebhooks returns a new Webhooks instance, sending received events to
+// processor. appSecret is the GitHub App's webhook secret, if blank GitHub App
+// webhooks are not accepted.
+func NewWebhooks(logger *logrus.Entry, db db.DB, processor EventProcessor, appSecret string) *Webhooks {
+	return &Webhooks{
+		logger:    logger,
+		db:        db,
+		processor: processor,
+		appSecret: appSecret,
+	}
+}
+
+// WebhookPath returns the path GitHub should send a user's webhooks to.
+func WebhookPath(userID int) string {
+	return "/webhooks/github/" + strconv.Itoa(userID)
+}
+
+// GitHub is the handler for a user's GitHub webhooks, each request must be
+// signed with the user's webhook secret via the X-Hub-Signature header.
+func (wh *Webhooks) GitHub(w http.ResponseWriter, r *http.Request) {
+	logger := wh.logger.WithFields(logrus.Fields{
+		"requestURI":    r.RequestURI,
+		"requestMethod": r.Method,
+		"hookType":      github.WebHookType(r),
+		"deliveryID":    r.Header.Get("X-GitHub-Delivery"),
+	})
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, err := wh.db.User(r.Context(), int(userID))
+	if err != nil {
+		logger.WithError(err).Error("could not get user")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if user == nil || user.WebhookSecret == "" {
+		http.NotFound(w, r)
+		return
+	}
+	logger = logger.WithField("userID", user.ID)
+
+	payload, err := github.ValidatePayload(r, []byte(user.WebhookSecret))
+	if err != nil {
+		logger.WithError(err).Info("could not validate webhook payload")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	if github.WebHookType(r) == "ping" {
+		logger.Info("received webhook ping")
+		return
+	}
+
+	event, err := events.ParseWebhook(github.WebHookType(r), r.Header.Get("X-GitHub-Delivery"), payload)
+	if err != nil {
+		logger.WithError(err).Error("could not parse webhook")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if err := wh.processor.Process(r.Context(), logger, *user, events.Events{event}); err != nil {
+		logger.WithError(err).Error("could not process webhook event")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Debugf("processed webhook event %q", event)
+}
+
+// App is the handler for the GitHub App's webhooks. Installation events
+// update the repositories the app is installed on, other events are sent to
+// the user who installed the app.
+func (wh *Webhooks) App(w http.ResponseWriter, r *http.Request) {
+	logger := wh.logger.WithFields(logrus.Fields{
+		"requestURI":    r.RequestURI,
+		"requestMethod": r.Method,
+		"hookType":      github.WebHookType(r),
+		"deliveryID":    r.Header.Get("X-GitHub-Delivery"),
+	})
+
+	if wh.appSecret == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	payload, err := github.ValidatePayload(r, []byte(wh.appSecret))
+	if err != nil {
+		logger.WithError(err).Info("could not validate webhook payload")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	hookType := github.WebHookType(r)
+	if hookType == "ping" {
+		logger.Info("received webhook ping")
+		return
+	}
+
+	switch hookType {
+	case "installation", "installation_repositories":
+		if err := wh.installation(r.Context(), hookType, payload); err != nil {
+			logger.WithError(err).Error("could not handle installation webhook")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	installationID, err := events.WebhookInstallationID(payload)
+	if err != nil {
+		logger.WithError(err).Error("could not parse webhook")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	logger = logger.WithField("installationID", installationID)
+
+	installation, err := wh.db.Installation(r.Context(), installationID)
+	if err != nil {
+		logger.WithError(err).Error("could not get installation")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if installation == nil {
+		// Such as an installation deleted event.
+		logger.Debug("ignoring webhook for unknown installation")
+		return
+	}
+
+	// The GitHub App is registered on GitHub.com.
+	user, err := wh.db.UserByGitHubID(r.Context(), ghhost.GitHubCom, installation.SenderGitHubID)
+	if err != nil {
+		logger.WithError(err).Error("could not get installation's user")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		logger.Debugf("ignoring webhook as no user for installation sender %d", installation.SenderGitHubID)
+		return
+	}
+	logger = logger.WithField("userID", user.ID)
+
+	event, err := events.ParseWebhook(hookType, r.Header.Get("X-GitHub-Delivery"), payload)
+	if err != nil {
+		logger.WithError(err).Error("could not parse webhook")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if err := wh.processor.Process(r.Context(), logger, *user, events.Events{event}); err != nil {
+		logger.WithError(err).Error("could not process webhook event")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	logger.Debugf("processed webhook event %q", event)
+}
+
+// installation updates the GitHub App's installations and their repositories
+// from an installation or installation_repositories webhook.
+func (wh *Webhooks) installation(ctx context.Context, hookType string, payload []byte) error {
+	parsed, err := github.ParseWebHook(hookType, payload)
+	if err != nil {
+		return errors.Wrap(err, "could not parse webhook")
+	}
+
+	switch p := parsed.(type) {
+	case *github.InstallationEvent:
+		installationID := p.Installation.GetID()
+		switch p.GetAction() {
+		case "created":
+			err := wh.db.InstallationCreate(ctx, &db.Installation{
+				ID:             installationID,
+				AccountID:      p.Installation.Account.GetID(),
+				AccountLogin:   p.Installation.Account.GetLogin(),
+				SenderGitHubID: p.Sender.GetID(),
+			})
+			if err != nil {
+				return err
+			}
+			return wh.db.InstallationRepositoriesCreate(ctx, installationRepositories(installationID, p.Repositories))
+		case "deleted":
+			return wh.db.InstallationDelete(ctx, installationID)
+		}
+	case *github.InstallationRepositoriesEvent:
+		installationID := p.Installation.GetID()
+		if err := wh.db.InstallationRepositoriesCreate(ctx, installationRepositories(installationID, p.RepositoriesAdded)); err != nil {
+			return err
+		}
+		var removed []int
+		for _, repo := range p.RepositoriesRemoved {
+			removed = append(removed, repo.GetID())
+		}
+		return wh.db.InstallationRepositoriesDelete(ctx, installationID, removed)
+	}
+	return nil
+}
+
+// installationRepositories returns the db.InstallationRepository for each of
+// an installation's repos.
+func installationRepositories(installationID int, repos []*github.Repository) []db.InstallationRepository {
+	var irepos []db.InstallationRepository
+	for _, repo := range repos {
+		irepos = append(irepos, db.InstallationRepository{
+			InstallationID: installationID,
+			RepositoryID:   repo.GetID(),
+			FullName:       repo.GetFullName(),
+		})
+	}
+	return irepos
+}